@@ -0,0 +1,110 @@
+package netconf
+
+import "encoding/xml"
+
+// The Build functions return the `<rpc>` message for an operation exactly as
+// a [Session] would send it, without needing a session or transport.  This is
+// useful for testing and for generating config archives.
+//
+// The returned bytes are the message before framing (End-of-Message or
+// Chunked) is applied.  These don't have access to the capabilities of
+// a device so checks that depend on them (i.e `:url` schemes) are not done.
+//
+// The attributes of the `<rpc>` element are always written in the same order,
+// `xmlns` and then `message-id`, so the output can be used as a golden file.
+// The operation itself is marshaled by encoding/xml as usual.
+
+// BuildRPC returns the `<rpc>` message for an arbitrary operation with the
+// given message-id.  `op` is anything accepted by [Session.Do].
+func BuildRPC(messageID uint64, op any) ([]byte, error) {
+	return xml.Marshal(&request{
+		MessageID: messageID,
+		Operation: op,
+	})
+}
+
+// buildFirstRPC builds the message as it would be sent as the first rpc of
+// a session.
+func buildFirstRPC(op any) ([]byte, error) {
+	return BuildRPC(1, op)
+}
+
+// BuildGet returns the `<rpc>` message [Session.Get] would send with
+// a message-id of 1.
+func BuildGet(filter *Filter) ([]byte, error) {
+	return buildFirstRPC(&GetReq{Filter: filter})
+}
+
+// BuildGetConfig returns the `<rpc>` message [Session.GetConfig] would send
+// with a message-id of 1.
+func BuildGetConfig(source Datastore) ([]byte, error) {
+	return buildFirstRPC(&GetConfigReq{Source: source})
+}
+
+// BuildEditConfig returns the `<rpc>` message [Session.EditConfig] would send
+// with a message-id of 1.
+func BuildEditConfig(target Datastore, config any, opts ...EditConfigOption) ([]byte, error) {
+	req, err := newEditConfigReq(target, config, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return buildFirstRPC(req)
+}
+
+// BuildCopyConfig returns the `<rpc>` message [Session.CopyConfig] would send
+// with a message-id of 1.
+func BuildCopyConfig(source, target any) ([]byte, error) {
+	return buildFirstRPC(&CopyConfigReq{Source: source, Target: target})
+}
+
+// BuildDeleteConfig returns the `<rpc>` message [Session.DeleteConfig] would
+// send with a message-id of 1.
+func BuildDeleteConfig(target any) ([]byte, error) {
+	return buildFirstRPC(&DeleteConfigReq{Target: target})
+}
+
+// BuildLock returns the `<rpc>` message [Session.Lock] would send with
+// a message-id of 1.
+func BuildLock(target Datastore) ([]byte, error) {
+	return buildFirstRPC(&LockReq{XMLName: xml.Name{Local: "lock"}, Target: target})
+}
+
+// BuildUnlock returns the `<rpc>` message [Session.Unlock] would send with
+// a message-id of 1.
+func BuildUnlock(target Datastore) ([]byte, error) {
+	return buildFirstRPC(&LockReq{XMLName: xml.Name{Local: "unlock"}, Target: target})
+}
+
+// BuildKillSession returns the `<rpc>` message [Session.KillSession] would send
+// with a message-id of 1.
+func BuildKillSession(sessionID uint32) ([]byte, error) {
+	return buildFirstRPC(&KillSessionReq{SessionID: sessionID})
+}
+
+// BuildValidate returns the `<rpc>` message [Session.Validate] would send with
+// a message-id of 1.
+func BuildValidate(source any) ([]byte, error) {
+	return buildFirstRPC(&ValidateReq{Source: source})
+}
+
+// BuildCommit returns the `<rpc>` message [Session.Commit] would send with
+// a message-id of 1.
+func BuildCommit(opts ...CommitOption) ([]byte, error) {
+	req, err := newCommitReq(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return buildFirstRPC(req)
+}
+
+// BuildCancelCommit returns the `<rpc>` message [Session.CancelCommit] would
+// send with a message-id of 1.
+func BuildCancelCommit(opts ...CancelCommitOption) ([]byte, error) {
+	return buildFirstRPC(newCancelCommitReq(opts...))
+}
+
+// BuildCreateSubscription returns the `<rpc>` message
+// [Session.CreateSubscription] would send with a message-id of 1.
+func BuildCreateSubscription(opts ...CreateSubscriptionOption) ([]byte, error) {
+	return buildFirstRPC(newCreateSubscriptionReq(opts...))
+}
@@ -0,0 +1,108 @@
+package netconf
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	const rpcStart = `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">`
+
+	tt := []struct {
+		name  string
+		build func() ([]byte, error)
+		// send is the same operation on a live session
+		send func(context.Context, *Session) error
+		want string
+	}{
+		{
+			name:  "get-config",
+			build: func() ([]byte, error) { return BuildGetConfig(Running) },
+			send: func(ctx context.Context, s *Session) error {
+				_, err := s.GetConfig(ctx, Running)
+				return err
+			},
+			want: rpcStart + `<get-config><source><running/></source></get-config></rpc>`,
+		},
+		{
+			name:  "get",
+			build: func() ([]byte, error) { return BuildGet(SubtreeFilter("<interfaces/>", "<system/>")) },
+			send: func(ctx context.Context, s *Session) error {
+				_, err := s.Get(ctx, SubtreeFilter("<interfaces/>", "<system/>"))
+				return err
+			},
+			want: rpcStart + `<get><filter type="subtree"><interfaces/><system/></filter></get></rpc>`,
+		},
+		{
+			name: "edit-config",
+			build: func() ([]byte, error) {
+				return BuildEditConfig(Candidate, "<system/>", WithDefaultMergeStrategy(ReplaceConfig))
+			},
+			send: func(ctx context.Context, s *Session) error {
+				return s.EditConfig(ctx, Candidate, "<system/>", WithDefaultMergeStrategy(ReplaceConfig))
+			},
+			want: rpcStart + `<edit-config><target><candidate/></target><default-operation>replace</default-operation><config><system/></config></edit-config></rpc>`,
+		},
+		{
+			name:  "copy-config",
+			build: func() ([]byte, error) { return BuildCopyConfig(Running, Startup) },
+			send:  func(ctx context.Context, s *Session) error { return s.CopyConfig(ctx, Running, Startup) },
+			want:  rpcStart + `<copy-config><source><running/></source><target><startup/></target></copy-config></rpc>`,
+		},
+		{
+			name:  "lock",
+			build: func() ([]byte, error) { return BuildLock(Candidate) },
+			send:  func(ctx context.Context, s *Session) error { return s.Lock(ctx, Candidate) },
+			want:  rpcStart + `<lock><target><candidate/></target></lock></rpc>`,
+		},
+		{
+			name:  "commit",
+			build: func() ([]byte, error) { return BuildCommit(WithConfirmedTimeout(time.Minute)) },
+			send:  func(ctx context.Context, s *Session) error { return s.Commit(ctx, WithConfirmedTimeout(time.Minute)) },
+			want:  rpcStart + `<commit><confirmed></confirmed><confirm-timeout>60</confirm-timeout></commit></rpc>`,
+		},
+		{
+			name:  "create-subscription",
+			build: func() ([]byte, error) { return BuildCreateSubscription(WithStreamOption("NETCONF")) },
+			send: func(ctx context.Context, s *Session) error {
+				return s.CreateSubscription(ctx, WithStreamOption("NETCONF"))
+			},
+			want: rpcStart + `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><stream>NETCONF</stream></create-subscription></rpc>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.build()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+
+			// the built message must match what the session sends
+			client, server := newPipeTransports()
+			defer server.Close()
+			sent := make(chan []byte, 1)
+			go serveOKRecorded(server, sent)
+
+			sess := newSession(client)
+			sess.serverCaps = newCapabilitySet(":notification:1.0")
+			go sess.recv()
+
+			// the newline before `]]>]]>` is part of the eom framing.
+			_ = tc.send(context.Background(), sess)
+			assert.Equal(t, tc.want, strings.TrimSuffix(string(<-sent), "\n"))
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	_, err := BuildCommit(WithConfirmed(), WithPersistID("foo"))
+	assert.Error(t, err)
+
+	_, err = BuildRPC(1, nil)
+	assert.Error(t, err)
+}
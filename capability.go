@@ -1,8 +1,25 @@
 package netconf
 
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
 const (
 	baseCap      = "urn:ietf:params:netconf:base"
+	baseCap10    = baseCap + ":1.0"
+	baseCap11    = baseCap + ":1.1"
 	stdCapPrefix = "urn:ietf:params:netconf:capability"
+	urlCap       = stdCapPrefix + ":url:1.0"
+
+	rollbackOnErrorCap = stdCapPrefix + ":rollback-on-error:1.0"
+	interleaveCap      = stdCapPrefix + ":interleave:1.0"
+	validateCap10      = stdCapPrefix + ":validate:1.0"
+	validateCap11      = stdCapPrefix + ":validate:1.1"
+
+	yangLibCap10 = stdCapPrefix + ":yang-library:1.0"
+	yangLibCap11 = stdCapPrefix + ":yang-library:1.1"
 )
 
 // DefaultCapabilities are the capabilities sent by the client during the hello
@@ -45,6 +62,8 @@ func ExpandCapability(s string) string {
 // stabilized?
 type capabilitySet struct {
 	caps map[string]struct{}
+	// raw are the capabilities exactly as they were added in order.
+	raw []string
 }
 
 func newCapabilitySet(capabilities ...string) capabilitySet {
@@ -56,6 +75,7 @@ func newCapabilitySet(capabilities ...string) capabilitySet {
 }
 
 func (cs *capabilitySet) Add(capabilities ...string) {
+	cs.raw = append(cs.raw, capabilities...)
 	for _, cap := range capabilities {
 		cap = ExpandCapability(cap)
 		cs.caps[cap] = struct{}{}
@@ -77,3 +97,145 @@ func (cs capabilitySet) All() []string {
 	}
 	return out
 }
+
+// Params returns the query parameters of the capability matching `uri` (i.e
+// `revision` from `...:yang-library:1.0?revision=2016-06-21`).  The second
+// return value reports if the capability was present at all.
+func (cs capabilitySet) Params(uri string) (url.Values, bool) {
+	uri = ExpandCapability(uri)
+	for cap := range cs.caps {
+		capURI, query, _ := strings.Cut(cap, "?")
+		if capURI != uri {
+			continue
+		}
+
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			return url.Values{}, true
+		}
+		return params, true
+	}
+	return nil, false
+}
+
+// URLSchemes returns the schemes advertised with the `:url` capability (i.e
+// `urn:ietf:params:netconf:capability:url:1.0?scheme=http,ftp,file`) in the
+// order they were listed.  The second return value reports if the `:url`
+// capability was present at all; it may be present without any schemes.
+func (cs capabilitySet) URLSchemes() ([]string, bool) {
+	params, ok := cs.Params(urlCap)
+	if !ok {
+		return nil, false
+	}
+
+	var schemes []string
+	for _, v := range params["scheme"] {
+		for _, scheme := range strings.Split(v, ",") {
+			if scheme = strings.TrimSpace(scheme); scheme != "" {
+				schemes = append(schemes, strings.ToLower(scheme))
+			}
+		}
+	}
+	return schemes, true
+}
+
+// advertises reports if the capability is in the set ignoring any parameters
+// on it (i.e `?scheme=file`) unless `urn` has parameters of it's own.
+func (cs capabilitySet) advertises(urn string) bool {
+	if strings.Contains(urn, "?") {
+		return cs.Has(urn)
+	}
+	_, ok := cs.Params(urn)
+	return ok
+}
+
+// Capabilities are the capabilities a device advertised in it's hello as
+// given to a guard set with [WithCapabilityGuard] or returned from
+// [Session.Capabilities].
+type Capabilities struct {
+	set capabilitySet
+}
+
+// NewCapabilities returns Capabilities from a list of capability URIs.  The
+// standard prefix is added the same as [ExpandCapability].
+func NewCapabilities(urns ...string) Capabilities {
+	return Capabilities{set: newCapabilitySet(urns...)}
+}
+
+// Has reports if the device advertised the capability.  It is matched the same
+// as [Session.RequireCapabilities].
+func (c Capabilities) Has(urn string) bool { return c.set.advertises(urn) }
+
+// Params returns the query parameters of the advertised capability matching
+// `uri` and if it was advertised at all.
+func (c Capabilities) Params(uri string) (url.Values, bool) { return c.set.Params(uri) }
+
+// All returns the capabilities exactly as the device advertised them.
+func (c Capabilities) All() []string {
+	return append([]string(nil), c.set.raw...)
+}
+
+// CapabilityDiff is the result of [CompareCapabilities].  Each list is sorted.
+type CapabilityDiff struct {
+	// Common are the capabilities in both sets.
+	Common []string
+	// OnlyFirst are the capabilities only in the first set.
+	OnlyFirst []string
+	// OnlySecond are the capabilities only in the second set.
+	OnlySecond []string
+}
+
+// normalizeCapability returns the capability with the standard prefix added
+// and the query parameters sorted so the same capability advertised with the
+// parameters in a different order compares equal.
+func normalizeCapability(urn string) string {
+	uri, query, ok := strings.Cut(urn, "?")
+	if !ok {
+		return urn
+	}
+	params := strings.Split(query, "&")
+	sort.Strings(params)
+	return uri + "?" + strings.Join(params, "&")
+}
+
+func normalizedCapabilities(c Capabilities) map[string]struct{} {
+	out := make(map[string]struct{}, len(c.set.caps))
+	for cap := range c.set.caps {
+		out[normalizeCapability(cap)] = struct{}{}
+	}
+	return out
+}
+
+// CompareCapabilities compares two sets of capabilities (i.e of two devices a
+// config is being migrated between).  Capabilities are matched exactly
+// including parameters such as the `revision` of a YANG module so a module
+// with different revisions on each device is in both OnlyFirst and
+// OnlySecond.  The order of the parameters doesn't matter.
+func CompareCapabilities(a, b Capabilities) CapabilityDiff {
+	aCaps, bCaps := normalizedCapabilities(a), normalizedCapabilities(b)
+
+	var diff CapabilityDiff
+	for cap := range aCaps {
+		if _, ok := bCaps[cap]; ok {
+			diff.Common = append(diff.Common, cap)
+		} else {
+			diff.OnlyFirst = append(diff.OnlyFirst, cap)
+		}
+	}
+	for cap := range bCaps {
+		if _, ok := aCaps[cap]; !ok {
+			diff.OnlySecond = append(diff.OnlySecond, cap)
+		}
+	}
+
+	sort.Strings(diff.Common)
+	sort.Strings(diff.OnlyFirst)
+	sort.Strings(diff.OnlySecond)
+	return diff
+}
+
+// IntersectCapabilities returns the capabilities in both sets (see
+// [CompareCapabilities]).
+func IntersectCapabilities(a, b Capabilities) Capabilities {
+	return NewCapabilities(CompareCapabilities(a, b).Common...)
+}
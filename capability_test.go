@@ -0,0 +1,100 @@
+package netconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLSchemes(t *testing.T) {
+	tt := []struct {
+		name    string
+		caps    []string
+		want    []string
+		wantURL bool
+	}{
+		{
+			name: "no url capability",
+			caps: []string{":base:1.0", ":candidate:1.0"},
+		},
+		{
+			name:    "multiple schemes",
+			caps:    []string{":base:1.1", ":url:1.0?scheme=file,https,sftp"},
+			want:    []string{"file", "https", "sftp"},
+			wantURL: true,
+		},
+		{
+			name:    "single scheme",
+			caps:    []string{"urn:ietf:params:netconf:capability:url:1.0?scheme=ftp"},
+			want:    []string{"ftp"},
+			wantURL: true,
+		},
+		{
+			name:    "mixed case and spaces",
+			caps:    []string{":url:1.0?scheme=FILE,%20http"},
+			want:    []string{"file", "http"},
+			wantURL: true,
+		},
+		{
+			name:    "no schemes",
+			caps:    []string{":url:1.0"},
+			wantURL: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := newCapabilitySet(tc.caps...)
+			got, ok := cs.URLSchemes()
+			assert.Equal(t, tc.wantURL, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestCompareCapabilities(t *testing.T) {
+	junos := NewCapabilities(
+		"urn:ietf:params:netconf:base:1.0",
+		"urn:ietf:params:netconf:base:1.1",
+		":candidate:1.0",
+		":confirmed-commit:1.0",
+		":validate:1.0",
+		"urn:ietf:params:netconf:capability:url:1.0?scheme=http,ftp,file",
+		"urn:ietf:params:xml:ns:yang:ietf-interfaces?module=ietf-interfaces&revision=2018-02-20",
+		"http://xml.juniper.net/netconf/junos/1.0",
+	)
+	iosxr := NewCapabilities(
+		"urn:ietf:params:netconf:base:1.1",
+		"urn:ietf:params:netconf:capability:candidate:1.0",
+		"urn:ietf:params:netconf:capability:confirmed-commit:1.1",
+		"urn:ietf:params:netconf:capability:validate:1.0",
+		"urn:ietf:params:netconf:capability:url:1.0?scheme=http,ftp,file",
+		"urn:ietf:params:xml:ns:yang:ietf-interfaces?revision=2018-02-20&module=ietf-interfaces",
+		"http://cisco.com/ns/yang/Cisco-IOS-XR-ifmgr-cfg?module=Cisco-IOS-XR-ifmgr-cfg&revision=2019-04-05",
+	)
+
+	diff := CompareCapabilities(junos, iosxr)
+	assert.Equal(t, []string{
+		"urn:ietf:params:netconf:base:1.1",
+		"urn:ietf:params:netconf:capability:candidate:1.0",
+		"urn:ietf:params:netconf:capability:url:1.0?scheme=http,ftp,file",
+		"urn:ietf:params:netconf:capability:validate:1.0",
+		"urn:ietf:params:xml:ns:yang:ietf-interfaces?module=ietf-interfaces&revision=2018-02-20",
+	}, diff.Common)
+	assert.Equal(t, []string{
+		"http://xml.juniper.net/netconf/junos/1.0",
+		"urn:ietf:params:netconf:base:1.0",
+		"urn:ietf:params:netconf:capability:confirmed-commit:1.0",
+	}, diff.OnlyFirst)
+	assert.Equal(t, []string{
+		"http://cisco.com/ns/yang/Cisco-IOS-XR-ifmgr-cfg?module=Cisco-IOS-XR-ifmgr-cfg&revision=2019-04-05",
+		"urn:ietf:params:netconf:capability:confirmed-commit:1.1",
+	}, diff.OnlySecond)
+
+	common := IntersectCapabilities(junos, iosxr)
+	assert.True(t, common.Has(":candidate:1.0"))
+	assert.True(t, common.Has(":url:1.0"))
+	schemes, _ := common.set.URLSchemes()
+	assert.Equal(t, []string{"http", "ftp", "file"}, schemes)
+	assert.False(t, common.Has(":confirmed-commit:1.0"))
+}
@@ -0,0 +1,142 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Element is a single element captured from a larger xml document as raw xml
+// so that it can be decoded on it's own.
+type Element struct {
+	// Name is the namespace and local name of the element.
+	Name xml.Name
+
+	// XML is the raw xml of the element including the start and end tags.
+	XML []byte
+}
+
+// Decode will decode the element into the value pointed at by v using
+// xml.Unmarshal.
+func (e Element) Decode(v any) error {
+	return xml.Unmarshal(e.XML, v)
+}
+
+// SplitElements splits an xml fragment (i.e the contents of `<data>`
+// returned from [Session.GetConfig]) into it's top-level elements in document
+// order.  Text and comments between elements are ignored.
+func SplitElements(fragment []byte) ([]Element, error) {
+	var elems []Element
+
+	dec := xml.NewDecoder(bytes.NewReader(fragment))
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return elems, nil
+			}
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if err := dec.Skip(); err != nil {
+			return nil, err
+		}
+		elems = append(elems, Element{
+			Name: start.Name,
+			XML:  bytes.TrimSpace(fragment[offset:dec.InputOffset()]),
+		})
+	}
+}
+
+// DataElements returns the children of the `<data>` element of the reply (as
+// returned from `<get>` and `<get-config>`) in the order the device sent them.
+// Namespace prefixes declared on `<rpc-reply>` or `<data>` are re-declared on
+// each element so they can be decoded independently.
+func (r Reply) DataElements() ([]Element, error) {
+	var data GetConfigReply
+	if err := r.Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode data: %w", err)
+	}
+	return SplitElements(data.Config)
+}
+
+const withDefaultsNamespace = "urn:ietf:params:xml:ns:netconf:default:1.0"
+
+// DefaultPaths returns the paths of the elements in an xml fragment that are
+// tagged as default values with the `wd:default="true"` attribute used by the
+// `report-all-tagged` mode of with-defaults ([RFC6243 3.4]).  This can be used
+// to tell values that were explicitly set apart from defaults.
+//
+// Paths are made up of the local names of the elements from the top of the
+// fragment (i.e `/interfaces/interface/mtu`).  Elements that are not the first
+// with their name under the same parent have a 1-based position appended (i.e
+// `/interfaces/interface[2]/mtu`).  The paths are in document order.
+//
+// [RFC6243 3.4]: https://www.rfc-editor.org/rfc/rfc6243.html#section-3.4
+func DefaultPaths(fragment []byte) ([]string, error) {
+	type level struct {
+		path  string
+		names map[string]int
+	}
+	stack := []level{{}}
+
+	var paths []string
+	dec := xml.NewDecoder(bytes.NewReader(fragment))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return paths, nil
+			}
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			parent := &stack[len(stack)-1]
+			if parent.names == nil {
+				parent.names = make(map[string]int)
+			}
+			parent.names[tok.Name.Local]++
+
+			path := parent.path + "/" + tok.Name.Local
+			if n := parent.names[tok.Name.Local]; n > 1 {
+				path += "[" + strconv.Itoa(n) + "]"
+			}
+			if isTaggedDefault(tok.Attr) {
+				paths = append(paths, path)
+			}
+			stack = append(stack, level{path: path})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func isTaggedDefault(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Space == withDefaultsNamespace && attr.Name.Local == "default" {
+			return attr.Value == "true" || attr.Value == "1"
+		}
+	}
+	return false
+}
+
+// DataDefaults returns the paths of the elements in `<data>` of the reply that
+// are tagged as default values.  See [DefaultPaths].
+func (r Reply) DataDefaults() ([]string, error) {
+	var data GetConfigReply
+	if err := r.Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode data: %w", err)
+	}
+	return DefaultPaths(data.Config)
+}
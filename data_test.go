@@ -0,0 +1,127 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitElements(t *testing.T) {
+	fragment := []byte(`
+  <interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name></interface></interfaces>
+  <!-- comment -->
+  <routing xmlns="urn:ietf:params:xml:ns:yang:ietf-routing"/>
+  <system xmlns="urn:ietf:params:xml:ns:yang:ietf-system"><hostname>r1</hostname></system>
+`)
+
+	elems, err := SplitElements(fragment)
+	require.NoError(t, err)
+
+	want := []Element{
+		{
+			Name: xml.Name{Space: "urn:ietf:params:xml:ns:yang:ietf-interfaces", Local: "interfaces"},
+			XML:  []byte(`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name></interface></interfaces>`),
+		},
+		{
+			Name: xml.Name{Space: "urn:ietf:params:xml:ns:yang:ietf-routing", Local: "routing"},
+			XML:  []byte(`<routing xmlns="urn:ietf:params:xml:ns:yang:ietf-routing"/>`),
+		},
+		{
+			Name: xml.Name{Space: "urn:ietf:params:xml:ns:yang:ietf-system", Local: "system"},
+			XML:  []byte(`<system xmlns="urn:ietf:params:xml:ns:yang:ietf-system"><hostname>r1</hostname></system>`),
+		},
+	}
+	assert.Equal(t, want, elems)
+
+	_, err = SplitElements([]byte(`<interfaces><interface>`))
+	assert.Error(t, err)
+}
+
+func TestReplyDataElements(t *testing.T) {
+	const replyXML = `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:sys="urn:ietf:params:xml:ns:yang:ietf-system" message-id="1">
+<data xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type">
+  <interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name><type>ianaift:ethernetCsmacd</type></interface></interfaces>
+  <routing xmlns="urn:ietf:params:xml:ns:yang:ietf-routing"><router-id>10.0.0.1</router-id></routing>
+  <sys:system><sys:hostname>r1</sys:hostname></sys:system>
+</data>
+</rpc-reply>`
+
+	var reply Reply
+	require.NoError(t, xml.Unmarshal([]byte(replyXML), &reply))
+	reply.nsDecls = []xml.Attr{{Name: xml.Name{Space: "xmlns", Local: "sys"}, Value: "urn:ietf:params:xml:ns:yang:ietf-system"}}
+
+	elems, err := reply.DataElements()
+	require.NoError(t, err)
+	require.Len(t, elems, 3)
+
+	var names []string
+	for _, elem := range elems {
+		names = append(names, elem.Name.Local)
+	}
+	assert.Equal(t, []string{"interfaces", "routing", "system"}, names)
+
+	var ifaces struct {
+		Interfaces []struct {
+			Name string `xml:"name"`
+			Type string `xml:"type"`
+		} `xml:"interface"`
+	}
+	require.NoError(t, elems[0].Decode(&ifaces))
+	assert.Equal(t, "eth0", ifaces.Interfaces[0].Name)
+	assert.Contains(t, string(elems[0].XML), `xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type"`)
+
+	var routing struct {
+		RouterID string `xml:"router-id"`
+	}
+	require.NoError(t, elems[1].Decode(&routing))
+	assert.Equal(t, "10.0.0.1", routing.RouterID)
+
+	// prefixes declared on the rpc-reply still resolve
+	var system struct {
+		XMLName  xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-system system"`
+		Hostname string   `xml:"urn:ietf:params:xml:ns:yang:ietf-system hostname"`
+	}
+	require.NoError(t, elems[2].Decode(&system))
+	assert.Equal(t, "r1", system.Hostname)
+}
+
+func TestDefaultPaths(t *testing.T) {
+	const replyXML = `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:wd="urn:ietf:params:xml:ns:netconf:default:1.0" message-id="1">
+<data>
+  <interfaces xmlns="urn:example:interfaces">
+    <interface>
+      <name>eth0</name>
+      <mtu wd:default="true">1500</mtu>
+      <status>up</status>
+    </interface>
+    <interface>
+      <name>eth1</name>
+      <mtu>9000</mtu>
+      <status wd:default="1">up</status>
+    </interface>
+  </interfaces>
+  <system xmlns="urn:example:system"><hostname wd:default="false">r1</hostname></system>
+</data>
+</rpc-reply>`
+
+	var reply Reply
+	require.NoError(t, xml.Unmarshal([]byte(replyXML), &reply))
+	reply.nsDecls = []xml.Attr{{Name: xml.Name{Space: "xmlns", Local: "wd"}, Value: "urn:ietf:params:xml:ns:netconf:default:1.0"}}
+
+	paths, err := reply.DataDefaults()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/interfaces/interface/mtu",
+		"/interfaces/interface[2]/status",
+	}, paths)
+
+	// an undeclared prefix is not the with-defaults namespace
+	paths, err = DefaultPaths([]byte(`<mtu wd:default="true">1500</mtu>`))
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+
+	_, err = DefaultPaths([]byte(`<interfaces><interface>`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDeployNotConfirmed is returned from [Session.SafeDeploy] when the change
+// was rolled back because it was not confirmed in time.
+var ErrDeployNotConfirmed = errors.New("netconf: deploy was not confirmed")
+
+type DiscardChangesReq struct {
+	XMLName xml.Name `xml:"discard-changes"`
+}
+
+// DiscardChanges issues the `<discard-changes>` operation as defined in
+// [RFC6241 8.3.4.2] to revert the candidate datastore to the current running
+// configuration.  This requires the device to support the `:candidate`
+// capability.
+//
+// [RFC6241 8.3.4.2]: https://www.rfc-editor.org/rfc/rfc6241.html#section-8.3.4.2
+func (s *Session) DiscardChanges(ctx context.Context) error {
+	var resp OKResp
+	return s.Call(ctx, &DiscardChangesReq{}, &resp)
+}
+
+// SafeDeploy applies `edits` to the running configuration through the
+// candidate datastore using the common safe-deploy sequence:
+//
+//  1. `<lock>` the candidate
+//  2. `<edit-config>` the candidate with each of the edits in order
+//  3. `<validate>` the candidate
+//  4. `<commit>` with `<confirmed>` using `timeout` as the confirm timeout
+//  5. call `confirm` (i.e to run health checks against the device)
+//  6. `<commit>` again to make the change permanent
+//
+// If any step fails the changes are rolled back: before the confirmed commit
+// the candidate is discarded and after it the commit is canceled (reverting
+// running) and then the candidate is discarded.  The same happens when
+// confirm returns false or takes longer than `timeout` (at which point the
+// device has already reverted on it's own) in which case
+// [ErrDeployNotConfirmed] is returned.  The candidate is always unlocked
+// before returning.
+//
+// This requires the device to support the `:candidate` and
+// `:confirmed-commit` capabilities.
+func (s *Session) SafeDeploy(ctx context.Context, edits []any, confirm func() bool, timeout time.Duration) error {
+	if err := s.enforceCapability(s.RequireCapabilities(":candidate:1.0")); err != nil {
+		return err
+	}
+	if s.RequireCapabilities(":confirmed-commit:1.1") != nil && s.RequireCapabilities(":confirmed-commit:1.0") != nil {
+		if err := s.enforceCapability(&MissingCapabilitiesError{Missing: []string{":confirmed-commit:1.1"}}); err != nil {
+			return err
+		}
+	}
+
+	// cleanup is still attempted when ctx has been canceled.
+	cleanupCtx := context.WithoutCancel(ctx)
+
+	if err := s.Lock(ctx, Candidate); err != nil {
+		return fmt.Errorf("failed to lock candidate: %w", err)
+	}
+	err := s.deploy(ctx, cleanupCtx, edits, confirm, timeout)
+	if unlockErr := s.Unlock(cleanupCtx, Candidate); unlockErr != nil && err == nil {
+		err = fmt.Errorf("failed to unlock candidate: %w", unlockErr)
+	}
+	return err
+}
+
+func (s *Session) deploy(ctx, cleanupCtx context.Context, edits []any, confirm func() bool, timeout time.Duration) error {
+	discard := func(err error) error {
+		if discardErr := s.DiscardChanges(cleanupCtx); discardErr != nil {
+			return fmt.Errorf("%w (failed to discard changes: %v)", err, discardErr)
+		}
+		return err
+	}
+	cancel := func(err error) error {
+		if cancelErr := s.CancelCommit(cleanupCtx); cancelErr != nil {
+			return discard(fmt.Errorf("%w (failed to cancel commit: %v)", err, cancelErr))
+		}
+		return discard(err)
+	}
+
+	for i, edit := range edits {
+		if err := s.EditConfig(ctx, Candidate, edit); err != nil {
+			return discard(fmt.Errorf("failed to apply edit %d: %w", i, err))
+		}
+	}
+
+	if err := s.Validate(ctx, Candidate); err != nil {
+		return discard(fmt.Errorf("failed to validate candidate: %w", err))
+	}
+
+	if err := s.Commit(ctx, WithConfirmedTimeout(timeout)); err != nil {
+		return discard(fmt.Errorf("failed to commit candidate: %w", err))
+	}
+
+	start := time.Now()
+	if !confirm() {
+		return cancel(ErrDeployNotConfirmed)
+	}
+	if time.Since(start) >= timeout {
+		// the device has already rolled back so there is nothing to cancel
+		return discard(fmt.Errorf("%w: confirmation took longer than %s", ErrDeployNotConfirmed, timeout))
+	}
+
+	if err := s.Commit(ctx); err != nil {
+		return cancel(fmt.Errorf("failed to confirm commit: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var opRe = regexp.MustCompile(`<rpc [^>]*><([a-z-]+)`)
+
+// serveDeploy replies `<ok/>` to every rpc except `failOp` which gets an
+// `<rpc-error>`.  The name of each operation (with confirmed commits as
+// `commit-confirmed`) is sent to `ops`.
+func serveDeploy(tr *pipeTransport, failOp string, ops chan<- string) {
+	for {
+		r, err := tr.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+
+		var op string
+		if m := opRe.FindSubmatch(msg); m != nil {
+			op = string(m[1])
+		}
+		if op == "commit" && bytes.Contains(msg, []byte("<confirmed>")) {
+			op = "commit-confirmed"
+		}
+		ops <- op
+
+		var msgID []byte
+		if m := msgIDRe.FindSubmatch(msg); m != nil {
+			msgID = m[1]
+		}
+
+		body := "<ok/>"
+		if op == failOp {
+			body = `<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>error</error-severity></rpc-error>`
+		}
+
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s">%s</rpc-reply>`, msgID, body)
+		if err := w.Close(); err != nil {
+			return
+		}
+	}
+}
+
+func TestSafeDeploy(t *testing.T) {
+	tt := []struct {
+		name    string
+		failOp  string
+		confirm bool
+		wantErr error
+		wantOps []string
+	}{
+		{
+			name:    "confirmed",
+			confirm: true,
+			wantOps: []string{"lock", "edit-config", "edit-config", "validate", "commit-confirmed", "commit", "unlock"},
+		},
+		{
+			name:    "validation failed",
+			failOp:  "validate",
+			confirm: true,
+			wantErr: RPCError{},
+			wantOps: []string{"lock", "edit-config", "edit-config", "validate", "discard-changes", "unlock"},
+		},
+		{
+			name:    "not confirmed",
+			confirm: false,
+			wantErr: ErrDeployNotConfirmed,
+			wantOps: []string{"lock", "edit-config", "edit-config", "validate", "commit-confirmed", "cancel-commit", "discard-changes", "unlock"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+
+			ops := make(chan string, 16)
+			go serveDeploy(server, tc.failOp, ops)
+
+			sess := newSession(client)
+			sess.serverCaps = newCapabilitySet(":candidate:1.0", ":confirmed-commit:1.1")
+			go sess.recv()
+
+			edits := []any{
+				"<config><system><hostname>r1</hostname></system></config>",
+				"<config><system><location>lab</location></system></config>",
+			}
+			var confirmCalled bool
+			err := sess.SafeDeploy(context.Background(), edits, func() bool {
+				confirmCalled = true
+				return tc.confirm
+			}, time.Minute)
+
+			switch want := tc.wantErr.(type) {
+			case nil:
+				require.NoError(t, err)
+			case RPCError:
+				assert.ErrorAs(t, err, &want)
+				assert.False(t, confirmCalled)
+			default:
+				assert.ErrorIs(t, err, want)
+				assert.True(t, confirmCalled)
+			}
+
+			var got []string
+			for range tc.wantOps {
+				got = append(got, <-ops)
+			}
+			assert.Equal(t, tc.wantOps, got)
+		})
+	}
+}
+
+func TestSafeDeployMissingCapabilities(t *testing.T) {
+	sess := newSession(&pipeTransport{})
+	sess.serverCaps = newCapabilitySet(":candidate:1.0")
+
+	err := sess.SafeDeploy(context.Background(), nil, func() bool { return true }, time.Minute)
+	var capErr *MissingCapabilitiesError
+	require.ErrorAs(t, err, &capErr)
+	assert.Equal(t, []string{":confirmed-commit:1.1"}, capErr.Missing)
+}
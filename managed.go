@@ -0,0 +1,486 @@
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrLockLost is wrapped by the errors reported to the state callback (see
+// [WithStateCallback]) for a lock held with [ManagedSession.Lock] that was not
+// re-acquired after reconnecting.
+var ErrLockLost = errors.New("netconf: lock lost on reconnect")
+
+// ConnState is the state of the connection of a [ManagedSession] reported to
+// the callback set with [WithStateCallback].
+type ConnState int
+
+const (
+	// StateDisconnected is reported when the session has gone away and again
+	// with the error for every failed attempt to dial a new one.
+	StateDisconnected ConnState = iota
+
+	// StateConnected is reported once a new session has been dialed and the
+	// locks and subscriptions restored on it.  The error reports anything that
+	// couldn't be restored.
+	StateConnected
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+type managedConfig struct {
+	stateCallback  func(ConnState, error)
+	relock         bool
+	reconnectDelay time.Duration
+}
+
+// ManagedOption is an optional argument to [NewManagedSession].
+type ManagedOption interface {
+	apply(*managedConfig)
+}
+
+type (
+	stateCallbackOpt  func(ConnState, error)
+	relockOpt         struct{}
+	reconnectDelayOpt time.Duration
+)
+
+func (o stateCallbackOpt) apply(cfg *managedConfig)  { cfg.stateCallback = o }
+func (o relockOpt) apply(cfg *managedConfig)         { cfg.relock = true }
+func (o reconnectDelayOpt) apply(cfg *managedConfig) { cfg.reconnectDelay = time.Duration(o) }
+
+// WithStateCallback sets a function called (from the reconnecting goroutine)
+// on every change to the connection of a [ManagedSession].  Without one the
+// errors are logged.
+func WithStateCallback(fn func(state ConnState, err error)) ManagedOption {
+	return stateCallbackOpt(fn)
+}
+
+// WithRelock re-acquires the locks taken with [ManagedSession.Lock] after
+// reconnecting.  Without it the locks are dropped and reported as lost.
+func WithRelock() ManagedOption { return relockOpt{} }
+
+// WithReconnectDelay sets how long to wait between attempts to dial a new
+// session.  Defaults to 1 second.
+func WithReconnectDelay(d time.Duration) ManagedOption { return reconnectDelayOpt(d) }
+
+// ManagedSession keeps a session to a single target open by dialing a new one
+// whenever the transport fails and restoring the state set up through it:
+// subscriptions created with [ManagedSession.Subscribe] are created again
+// (replaying from the last notification received) and, with [WithRelock],
+// locks taken with [ManagedSession.Lock] are taken again.
+//
+// A lock that isn't re-acquired may have let someone else change the
+// datastore, so it is dropped and reported to the state callback with an
+// error wrapping [ErrLockLost] instead of carrying on as if it was held.
+//
+// Sessions must be asynchronous (i.e not opened [WithSynchronous]) so that a
+// failed transport is noticed.  A ManagedSession is safe for concurrent use.
+type ManagedSession struct {
+	dialer Dialer
+	target string
+	cfg    managedConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	exited chan struct{}
+
+	// restoreMu serializes changes to the locks and subscriptions with
+	// restoring them on a new session.
+	restoreMu sync.Mutex
+
+	mu    sync.Mutex
+	sess  *Session
+	locks []Datastore
+	subs  []*ManagedSubscription
+}
+
+// NewManagedSession dials a session to `target` with `dialer` and returns
+// a ManagedSession keeping it connected.
+func NewManagedSession(ctx context.Context, dialer Dialer, target string, opts ...ManagedOption) (*ManagedSession, error) {
+	cfg := managedConfig{
+		reconnectDelay: time.Second,
+	}
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+
+	s, err := dialer.Dial(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %q: %w", target, err)
+	}
+
+	m := &ManagedSession{
+		dialer: dialer,
+		target: target,
+		cfg:    cfg,
+		exited: make(chan struct{}),
+		sess:   s,
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	go m.supervise(s)
+	return m, nil
+}
+
+// Session returns the current session.  It may be one that has just gone away
+// in which case rpcs on it fail until the new session is dialed.
+func (m *ManagedSession) Session() *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sess
+}
+
+// Lock locks the datastore (see [Session.Lock]) and remembers the lock to
+// restore it after reconnecting.
+func (m *ManagedSession) Lock(ctx context.Context, target Datastore) error {
+	m.restoreMu.Lock()
+	defer m.restoreMu.Unlock()
+
+	if err := m.Session().Lock(ctx, target); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ds := range m.locks {
+		if ds == target {
+			return nil
+		}
+	}
+	m.locks = append(m.locks, target)
+	return nil
+}
+
+// Unlock unlocks the datastore (see [Session.Unlock]).  The lock is forgotten
+// even if the unlock fails.
+func (m *ManagedSession) Unlock(ctx context.Context, target Datastore) error {
+	m.restoreMu.Lock()
+	defer m.restoreMu.Unlock()
+
+	m.forgetLock(target)
+	return m.Session().Unlock(ctx, target)
+}
+
+func (m *ManagedSession) forgetLock(target Datastore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, ds := range m.locks {
+		if ds == target {
+			m.locks = append(m.locks[:i:i], m.locks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Subscribe creates a subscription (see [Session.Subscribe]) that is created
+// again on every new session.  When notifications have been received the new
+// subscription replays the stream from the time of the last one (see
+// [WithStartTimeOption]) so nothing is missed while disconnected; the
+// replayed notifications that were already received are skipped.  This needs
+// the stream to support replay.
+func (m *ManagedSession) Subscribe(ctx context.Context, match func(Notification) bool, opts ...CreateSubscriptionOption) (*ManagedSubscription, error) {
+	m.restoreMu.Lock()
+	defer m.restoreMu.Unlock()
+
+	sub, err := m.Session().subscribe(ctx, m.ctx, match, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := &ManagedSubscription{
+		m:     m,
+		match: match,
+		opts:  opts,
+		ch:    make(chan Notification, subscriptionBuffer),
+		stop:  make(chan struct{}),
+	}
+	ms.start(sub, false)
+
+	m.mu.Lock()
+	m.subs = append(m.subs, ms)
+	m.mu.Unlock()
+	return ms, nil
+}
+
+func (m *ManagedSession) removeSub(ms *ManagedSubscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, other := range m.subs {
+		if other == ms {
+			m.subs = append(m.subs[:i:i], m.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *ManagedSession) notify(state ConnState, err error) {
+	if m.cfg.stateCallback != nil {
+		m.cfg.stateCallback(state, err)
+		return
+	}
+	if err != nil {
+		log.Printf("netconf: managed session to %q %s: %v", m.target, state, err)
+	}
+}
+
+// supervise waits for the session to go away and replaces it until the
+// ManagedSession is closed.
+func (m *ManagedSession) supervise(s *Session) {
+	defer close(m.exited)
+
+	for {
+		select {
+		case <-s.done:
+		case <-m.ctx.Done():
+			return
+		}
+		m.notify(StateDisconnected, nil)
+
+		s = m.redial()
+		if s == nil {
+			return
+		}
+
+		m.restoreMu.Lock()
+		m.mu.Lock()
+		m.sess = s
+		m.mu.Unlock()
+		err := m.restore(s)
+		m.restoreMu.Unlock()
+
+		m.notify(StateConnected, err)
+	}
+}
+
+// redial dials a new session until it succeeds returning nil if the
+// ManagedSession is closed first.
+func (m *ManagedSession) redial() *Session {
+	for {
+		s, err := m.dialer.Dial(m.ctx, m.target)
+		if m.ctx.Err() != nil {
+			if err == nil {
+				s.tr.Close()
+			}
+			return nil
+		}
+		if err == nil {
+			return s
+		}
+		m.notify(StateDisconnected, fmt.Errorf("failed to dial %q: %w", m.target, err))
+
+		select {
+		case <-time.After(m.cfg.reconnectDelay):
+		case <-m.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// restore takes the locks and creates the subscriptions on the new session.
+// m.restoreMu must be held.
+func (m *ManagedSession) restore(s *Session) error {
+	m.mu.Lock()
+	locks := append([]Datastore(nil), m.locks...)
+	subs := append([]*ManagedSubscription(nil), m.subs...)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, ds := range locks {
+		var err error
+		if m.cfg.relock {
+			err = s.Lock(m.ctx, ds)
+		} else {
+			err = errors.New("not re-acquired")
+		}
+		if err != nil {
+			m.forgetLock(ds)
+			errs = append(errs, fmt.Errorf("%w on %s: %w", ErrLockLost, ds, err))
+		}
+	}
+
+	for _, ms := range subs {
+		if err := ms.resubscribe(m.ctx, s); err != nil {
+			m.removeSub(ms)
+			ms.finish(err)
+			errs = append(errs, fmt.Errorf("failed to resubscribe: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops reconnecting and closes the current session (see
+// [Session.Close]) and subscriptions.
+func (m *ManagedSession) Close(ctx context.Context) error {
+	m.cancel()
+	<-m.exited
+
+	m.mu.Lock()
+	s := m.sess
+	subs := m.subs
+	m.subs = nil
+	m.mu.Unlock()
+
+	var err error
+	if s.alive() {
+		err = s.Close(ctx)
+	} else {
+		s.tr.Close()
+	}
+
+	for _, ms := range subs {
+		ms.finish(nil)
+	}
+	return err
+}
+
+// ManagedSubscription is a subscription created with
+// [ManagedSession.Subscribe] that carries on across reconnects.
+type ManagedSubscription struct {
+	m     *ManagedSession
+	match func(Notification) bool
+	opts  []CreateSubscriptionOption
+	ch    chan Notification
+
+	stop       chan struct{}
+	finishOnce sync.Once
+
+	mu     sync.Mutex
+	sub    *Subscription
+	pumped chan struct{}
+	last   Notification
+	err    error
+}
+
+// Notifications returns the channel the matching notifications are sent on.
+// It is closed when the subscription or the ManagedSession is closed or the
+// subscription could not be created again after reconnecting (see
+// [ManagedSubscription.Err]).  It must be drained the same as
+// [Subscription.Notifications].
+func (ms *ManagedSubscription) Notifications() <-chan Notification { return ms.ch }
+
+// Err returns the error from creating the subscription again once
+// [ManagedSubscription.Notifications] has been closed because of it.
+func (ms *ManagedSubscription) Err() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.err
+}
+
+// Close stops notifications being routed to this subscription (see
+// [Subscription.Close]) and closes the channel.  It is not created again after
+// reconnecting.
+func (ms *ManagedSubscription) Close() {
+	ms.m.restoreMu.Lock()
+	defer ms.m.restoreMu.Unlock()
+
+	ms.m.removeSub(ms)
+	ms.finish(nil)
+}
+
+// start forwards the notifications of sub once the ones of the previous
+// subscription have been forwarded.  When `replay` is set the notifications
+// from before the last one forwarded are skipped.
+func (ms *ManagedSubscription) start(sub *Subscription, replay bool) {
+	pumped := make(chan struct{})
+	ms.mu.Lock()
+	prev := ms.pumped
+	ms.sub = sub
+	ms.pumped = pumped
+	ms.mu.Unlock()
+
+	go func() {
+		defer close(pumped)
+		// this waits here rather than in resubscribe as the previous
+		// subscription may be blocked on a consumer that isn't reading which
+		// must not hold up restoring the session.
+		if prev != nil {
+			<-prev
+		}
+
+		ms.mu.Lock()
+		last := ms.last
+		ms.mu.Unlock()
+
+		replaying := replay
+		for {
+			var n Notification
+			var ok bool
+			select {
+			case n, ok = <-sub.Notifications():
+				if !ok {
+					// closed with the session
+					return
+				}
+			case <-ms.stop:
+				return
+			}
+
+			if replaying {
+				if n.EventTime.Before(last.EventTime) ||
+					(n.EventTimeRaw == last.EventTimeRaw && bytes.Equal(n.Body, last.Body)) {
+					continue
+				}
+				replaying = false
+			}
+
+			ms.mu.Lock()
+			ms.last = n
+			ms.mu.Unlock()
+
+			select {
+			case ms.ch <- n:
+			case <-ms.stop:
+				return
+			}
+		}
+	}()
+}
+
+// resubscribe creates the subscription on the new session replaying the
+// stream from the last notification forwarded so far.  The previous
+// subscription may still forward a few more which are then skipped.
+func (ms *ManagedSubscription) resubscribe(ctx context.Context, s *Session) error {
+	ms.mu.Lock()
+	since := ms.last.EventTime
+	ms.mu.Unlock()
+
+	opts := ms.opts
+	if !since.IsZero() {
+		opts = append(opts[:len(opts):len(opts)], WithStartTimeOption(since))
+	}
+
+	sub, err := s.subscribe(ctx, ms.m.ctx, ms.match, opts...)
+	if err != nil {
+		return err
+	}
+	ms.start(sub, !since.IsZero())
+	return nil
+}
+
+// finish stops forwarding and closes the channel.
+func (ms *ManagedSubscription) finish(err error) {
+	ms.finishOnce.Do(func() {
+		close(ms.stop)
+
+		ms.mu.Lock()
+		sub, pumped := ms.sub, ms.pumped
+		ms.err = err
+		ms.mu.Unlock()
+
+		sub.Close()
+		<-pumped
+		close(ms.ch)
+	})
+}
@@ -0,0 +1,223 @@
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveManaged replies to `<lock>` with `<ok/>` or a lock-denied error and
+// to everything else with `<ok/>` sending the notifications after the reply to
+// `<create-subscription>`.  Every request is sent to `sent`.
+func serveManaged(tr *pipeTransport, lockOK bool, sent chan<- string, notifs ...string) {
+	for {
+		r, err := tr.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+		sent <- string(msg)
+
+		var msgID []byte
+		if m := msgIDRe.FindSubmatch(msg); m != nil {
+			msgID = m[1]
+		}
+		body := "<ok/>"
+		if strings.Contains(string(msg), "<lock>") && !lockOK {
+			body = `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity><error-message>locked by session 7</error-message></rpc-error>`
+		}
+
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s">%s</rpc-reply>`, msgID, body)
+		if err := w.Close(); err != nil {
+			return
+		}
+
+		if strings.Contains(string(msg), "<create-subscription") {
+			for _, notif := range notifs {
+				w, err := tr.MsgWriter()
+				if err != nil {
+					return
+				}
+				_, _ = io.WriteString(w, notif)
+				if err := w.Close(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+type connStateReport struct {
+	state ConnState
+	err   error
+}
+
+func TestManagedSessionReconnect(t *testing.T) {
+	servers := make(chan *pipeTransport, 2)
+	sent := make(chan string, 16)
+
+	var dials int
+	dialer := DialerFunc(func(ctx context.Context, target string) (*Session, error) {
+		dials++
+		client, server := newPipeTransports()
+		servers <- server
+		if dials == 1 {
+			go serveManaged(server, true, sent, notifLinkDown)
+		} else {
+			// the lock is taken by someone else while disconnected and
+			// the already received link-down is replayed.
+			go serveManaged(server, false, sent, notifLinkDown, notifUnknown)
+		}
+
+		s := newSession(client)
+		s.serverCaps = newCapabilitySet(":notification:1.0")
+		go s.recv()
+		return s, nil
+	})
+
+	states := make(chan connStateReport, 4)
+	ctx := context.Background()
+	m, err := NewManagedSession(ctx, dialer, "router1",
+		WithRelock(),
+		WithReconnectDelay(time.Millisecond),
+		WithStateCallback(func(state ConnState, err error) {
+			states <- connStateReport{state, err}
+		}))
+	require.NoError(t, err)
+	defer m.Close(ctx)
+
+	require.NoError(t, m.Lock(ctx, Candidate))
+	assert.Contains(t, <-sent, "<lock><target><candidate/></target></lock>")
+
+	sub, err := m.Subscribe(ctx, nil, WithStreamOption("links"))
+	require.NoError(t, err)
+	assert.Contains(t, <-sent, "<create-subscription")
+
+	recv := func() Notification {
+		t.Helper()
+		select {
+		case n, ok := <-sub.Notifications():
+			require.True(t, ok, "subscription closed")
+			return n
+		case <-time.After(time.Second):
+			t.Fatal("no notification received")
+			return Notification{}
+		}
+	}
+	assert.True(t, isEvent("link-down")(recv()))
+
+	// the transport fails
+	(<-servers).Close()
+
+	assert.Equal(t, StateDisconnected, (<-states).state)
+	assert.Contains(t, <-sent, "<lock><target><candidate/></target></lock>")
+	assert.Contains(t, <-sent, `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">`+
+		`<stream>links</stream><startTime>2023-06-07T18:32:00Z</startTime></create-subscription>`)
+
+	report := <-states
+	assert.Equal(t, StateConnected, report.state)
+	assert.ErrorIs(t, report.err, ErrLockLost)
+	assert.ErrorContains(t, report.err, "locked by session 7")
+
+	// the replayed link-down is skipped
+	assert.True(t, isEvent("something-else")(recv()))
+	assert.Equal(t, 2, dials)
+
+	// the lost lock is not restored again
+	m.mu.Lock()
+	assert.Empty(t, m.locks)
+	m.mu.Unlock()
+}
+
+func TestManagedSessionReconnectBlocked(t *testing.T) {
+	// more notifications than are buffered so forwarding them blocks on the
+	// consumer that isn't reading.
+	var notifs []string
+	for i := 0; i < subscriptionBuffer+2; i++ {
+		notifs = append(notifs, fmt.Sprintf(`<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">`+
+			`<eventTime>2023-06-07T18:32:%02dZ</eventTime><link-down xmlns="urn:example:links"/></notification>`, i))
+	}
+
+	servers := make(chan *pipeTransport, 2)
+	sent := make(chan string, 16)
+
+	var dials int
+	dialer := DialerFunc(func(ctx context.Context, target string) (*Session, error) {
+		dials++
+		client, server := newPipeTransports()
+		servers <- server
+		if dials == 1 {
+			go serveManaged(server, true, sent, notifs...)
+		} else {
+			go serveManaged(server, true, sent)
+		}
+
+		s := newSession(client)
+		s.serverCaps = newCapabilitySet(":notification:1.0")
+		go s.recv()
+		return s, nil
+	})
+
+	states := make(chan connStateReport, 4)
+	ctx := context.Background()
+	m, err := NewManagedSession(ctx, dialer, "router1",
+		WithReconnectDelay(time.Millisecond),
+		WithStateCallback(func(state ConnState, err error) {
+			states <- connStateReport{state, err}
+		}))
+	require.NoError(t, err)
+
+	sub, err := m.Subscribe(ctx, nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(sub.ch) == cap(sub.ch) }, time.Second, time.Millisecond)
+
+	// the transport fails while the subscription is blocked
+	(<-servers).Close()
+
+	waitState := func(want ConnState) {
+		t.Helper()
+		select {
+		case report := <-states:
+			assert.Equal(t, want, report.state)
+			assert.NoError(t, report.err)
+		case <-time.After(time.Second):
+			t.Fatalf("no %s report", want)
+		}
+	}
+	waitState(StateDisconnected)
+	waitState(StateConnected)
+
+	lockCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, m.Lock(lockCtx, Candidate))
+	require.NoError(t, m.Unlock(lockCtx, Candidate))
+
+	closed := make(chan error, 1)
+	go func() { closed <- m.Close(ctx) }()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on the subscription that isn't read")
+	}
+
+	// what was forwarded before closing is still in order
+	var last time.Time
+	for n := range sub.Notifications() {
+		assert.True(t, n.EventTime.After(last))
+		last = n.EventTime
+	}
+}
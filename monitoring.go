@@ -0,0 +1,93 @@
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+const monitoringNamespace = "urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"
+
+// DatastoreState is a datastore exposed by a device and it's current lock
+// state as reported in `/netconf-state/datastores` from ietf-netconf-monitoring
+// ([RFC6022]).
+//
+// [RFC6022]: https://www.rfc-editor.org/rfc/rfc6022.html
+type DatastoreState struct {
+	Name Datastore
+
+	// Lock is the global lock (i.e from [Session.Lock]) held on the datastore
+	// or nil if it is not locked.
+	Lock *DatastoreLock
+
+	// PartialLocks are any partial locks ([RFC5717]) held on the datastore.
+	//
+	// [RFC5717]: https://www.rfc-editor.org/rfc/rfc5717.html
+	PartialLocks []DatastoreLock
+}
+
+// DatastoreLock is a lock held on a datastore.
+type DatastoreLock struct {
+	// SessionID is the id of the session holding the lock.
+	SessionID uint64
+
+	// Time is when the lock was acquired.  It is the zero time if the device
+	// sent a value that could not be parsed; the original value is kept in
+	// TimeRaw.
+	Time    time.Time
+	TimeRaw string
+}
+
+type monitoringLock struct {
+	LockedBySession uint64 `xml:"locked-by-session"`
+	LockedTime      string `xml:"locked-time"`
+}
+
+func (l monitoringLock) lock() DatastoreLock {
+	lock := DatastoreLock{SessionID: l.LockedBySession, TimeRaw: l.LockedTime}
+	lock.Time, _ = parseEventTime(l.LockedTime)
+	return lock
+}
+
+// datastoresReply maps `/netconf-state/datastores` from RFC6022.
+type datastoresReply struct {
+	XMLName    xml.Name `xml:"data"`
+	Datastores []struct {
+		Name  string `xml:"name"`
+		Locks *struct {
+			GlobalLock  *monitoringLock  `xml:"global-lock"`
+			PartialLock []monitoringLock `xml:"partial-lock"`
+		} `xml:"locks"`
+	} `xml:"urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring netconf-state>datastores>datastore"`
+}
+
+// Datastores queries the datastores exposed by the device along with their
+// lock state from ietf-netconf-monitoring.  This can be used to check if
+// a datastore is locked (and by which session) before attempting to lock it.
+func (s *Session) Datastores(ctx context.Context) ([]DatastoreState, error) {
+	req := GetReq{
+		Filter: SubtreeFilter(fmt.Sprintf(`<netconf-state xmlns="%s"><datastores/></netconf-state>`, monitoringNamespace)),
+	}
+
+	var resp datastoresReply
+	if err := s.Call(ctx, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	states := make([]DatastoreState, 0, len(resp.Datastores))
+	for _, ds := range resp.Datastores {
+		state := DatastoreState{Name: Datastore(ds.Name)}
+		if ds.Locks != nil {
+			if ds.Locks.GlobalLock != nil {
+				lock := ds.Locks.GlobalLock.lock()
+				state.Lock = &lock
+			}
+			for _, l := range ds.Locks.PartialLock {
+				state.PartialLocks = append(state.PartialLocks, l.lock())
+			}
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
@@ -0,0 +1,68 @@
+package netconf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatastores(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>
+  <netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring">
+    <datastores>
+      <datastore><name>running</name></datastore>
+      <datastore>
+        <name>candidate</name>
+        <locks>
+          <global-lock>
+            <locked-by-session>42</locked-by-session>
+            <locked-time>2024-03-01T12:30:00Z</locked-time>
+          </global-lock>
+        </locks>
+      </datastore>
+      <datastore>
+        <name>startup</name>
+        <locks>
+          <partial-lock>
+            <lock-id>1</lock-id>
+            <locked-by-session>7</locked-by-session>
+            <locked-time>bogus</locked-time>
+            <select>/interfaces</select>
+          </partial-lock>
+        </locks>
+      </datastore>
+    </datastores>
+  </netconf-state>
+</data></rpc-reply>`)
+
+	got, err := sess.Datastores(context.Background())
+	require.NoError(t, err)
+
+	sentMsg, err := ts.popReqString()
+	require.NoError(t, err)
+	assert.Contains(t, sentMsg, `<get><filter type="subtree"><netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><datastores/></netconf-state></filter></get>`)
+
+	want := []DatastoreState{
+		{Name: Running},
+		{
+			Name: Candidate,
+			Lock: &DatastoreLock{
+				SessionID: 42,
+				Time:      time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+				TimeRaw:   "2024-03-01T12:30:00Z",
+			},
+		},
+		{
+			Name:         Startup,
+			PartialLocks: []DatastoreLock{{SessionID: 7, TimeRaw: "bogus"}},
+		},
+	}
+	assert.Equal(t, want, got)
+}
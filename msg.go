@@ -1,8 +1,11 @@
 package netconf
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,6 +40,13 @@ func (x *RawXML) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	return e.EncodeElement(&inner, start)
 }
 
+// baseNamespace is the namespace for the base NETCONF protocol (RFC6241).
+// The same namespace is used for both `:base:1.0` and `:base:1.1` sessions,
+// the negotiated version only changes the framing.
+//
+// Struct tags can't reference constants so the messages below spell it out.
+const baseNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
 // helloMsg maps the xml value of the <hello> message in RFC6241
 type helloMsg struct {
 	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
@@ -49,6 +59,22 @@ type request struct {
 	XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 rpc"`
 	MessageID uint64   `xml:"message-id,attr"`
 	Operation any      `xml:",innerxml"`
+
+	// spool is where the contents of `<data>` in the reply is streamed to
+	// instead of being kept in memory (see Session.GetConfigToFile).
+	spool io.Writer
+
+	// onError is called with each `<rpc-error>` as it is decoded from the
+	// reply (see Session.EditConfigProgress).
+	onError func(RPCError)
+
+	// stream is set to marshal the request straight into the transport (see
+	// Session.EncodeRPC).
+	stream bool
+
+	// envelope replaces `rpc` as the name of the outermost element when set
+	// (see WithEnvelope).
+	envelope string
 }
 
 func (msg *request) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
@@ -58,10 +84,28 @@ func (msg *request) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 
 	// TODO: validate operation is named?
 
-	// alias the type to not cause recursion calling e.Encode
-	type rpcMsg request
-	inner := rpcMsg(*msg)
-	return e.Encode(&inner)
+	// The `<rpc>` element carries the base namespace and message-id for every
+	// operation so operations should not set their own (an un-namespaced
+	// operation element inherits the base namespace from here).
+	//
+	// The start element is built by hand so the attributes are always written
+	// as `xmlns` followed by `message-id` no matter how encoding/xml orders
+	// them.  This keeps golden files of the envelope stable.
+	name := "rpc"
+	if msg.envelope != "" {
+		name = msg.envelope
+	}
+	start = xml.StartElement{
+		Name: xml.Name{Local: name},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns"}, Value: baseNamespace},
+			{Name: xml.Name{Local: "message-id"}, Value: strconv.FormatUint(msg.MessageID, 10)},
+		},
+	}
+	inner := struct {
+		Operation any `xml:",innerxml"`
+	}{Operation: msg.Operation}
+	return e.EncodeElement(&inner, start)
 }
 
 // Reply maps the xml value of <rpc-reply> in RFC6241
@@ -70,12 +114,82 @@ type Reply struct {
 	MessageID uint64    `xml:"message-id,attr"`
 	Errors    RPCErrors `xml:"rpc-error,omitempty"`
 	Body      []byte    `xml:",innerxml"`
+
+	// nsDecls are the prefixed namespace declarations on the `<rpc-reply>`
+	// element which are lost when capturing the body.
+	nsDecls []xml.Attr
 }
 
-// Decode will decode the body of a reply into a value pointed to by v.  This is
-// a simple wrapper around xml.Unmarshal.
+// Decode will decode the first element in the body of a reply that isn't an
+// `<rpc-error>` (i.e `<data>`, `<ok/>` or a vendor specific element) into
+// a value pointed to by v using the same rules as xml.Unmarshal.  Before
+// decoding, any namespace prefixes declared on the `<rpc-reply>` element are
+// re-declared on the top-level elements of the body so that prefixes inside of
+// values can still be resolved.
 func (r Reply) Decode(v interface{}) error {
-	return xml.Unmarshal(r.Body, v)
+	d := xml.NewDecoder(bytes.NewReader(injectNamespaces(r.Body, r.nsDecls)))
+	for {
+		start, err := startElement(d)
+		if err != nil {
+			return err
+		}
+
+		// warnings may come before the data.  The default namespace from
+		// `<rpc-reply>` is not in scope of the body on it's own.
+		if start.Name.Local == "rpc-error" && (start.Name.Space == baseNamespace || start.Name.Space == "") {
+			if err := d.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		return d.DecodeElement(v, start)
+	}
+}
+
+// Extras returns the raw XML of the top-level elements of the body after the
+// one decoded by [Reply.Decode] (i.e vendor specific elements some devices add
+// after `<data>`), skipping any `<rpc-error>`.  The namespace prefixes declared
+// on the `<rpc-reply>` are re-declared on them the same as for Decode.
+func (r Reply) Extras() ([]RawXML, error) {
+	body := injectNamespaces(r.Body, r.nsDecls)
+	d := xml.NewDecoder(bytes.NewReader(body))
+
+	var extras []RawXML
+	first := true
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			return extras, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+
+		if start.Name.Local == "rpc-error" && (start.Name.Space == baseNamespace || start.Name.Space == "") {
+			continue
+		}
+		if first {
+			first = false
+			continue
+		}
+		extras = append(extras, RawXML(body[offset:d.InputOffset()]))
+	}
+}
+
+// Warnings returns the `<rpc-error>`s in the reply with a severity of warning.
+// Warnings don't fail an rpc (they are not returned from [Reply.Err] by
+// default) even when the reply is an `<ok/>`.
+func (r Reply) Warnings() RPCErrors {
+	return r.Errors.Filter(SevWarning)
 }
 
 // Err will return go error(s) from a Reply that are of the given severities. If
@@ -119,9 +233,66 @@ func (r Reply) Err(severity ...ErrSeverity) error {
 }
 
 type Notification struct {
-	XMLName   xml.Name  `xml:"urn:ietf:params:xml:ns:netconf:notification:1.0 notification"`
-	EventTime time.Time `xml:"eventTime"`
-	Body      []byte    `xml:",innerxml"`
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:netconf:notification:1.0 notification"`
+
+	// EventTime is the parsed `<eventTime>`.  It is the zero time if the
+	// device sent a value that couldn't be parsed.
+	EventTime time.Time `xml:"-"`
+
+	// EventTimeRaw is the `<eventTime>` exactly as the device sent it.
+	EventTimeRaw string `xml:"eventTime"`
+
+	Body []byte `xml:",innerxml"`
+
+	// nsDecls are the prefixed namespace declarations on the `<notification>`
+	// element which are lost when capturing the body.
+	nsDecls []xml.Attr
+}
+
+// UnmarshalXML implements xml.Unmarshaler.  The eventTime is parsed leniently
+// with parseEventTime instead of failing the whole notification.
+func (n *Notification) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// alias the type to not cause recursion calling d.DecodeElement
+	type notification Notification
+	var inner notification
+	if err := d.DecodeElement(&inner, &start); err != nil {
+		return err
+	}
+
+	inner.EventTime, _ = parseEventTime(inner.EventTimeRaw)
+	*n = Notification(inner)
+	return nil
+}
+
+// eventTimeLayouts are tried in order by parseEventTime.  Fractional seconds
+// of any precision are accepted by time.Parse when the layout doesn't include
+// them.
+var eventTimeLayouts = []string{
+	time.RFC3339,
+	// offset without the colon (i.e `+0530`)
+	"2006-01-02T15:04:05Z0700",
+	// no timezone at all, assumed to be UTC
+	"2006-01-02T15:04:05",
+}
+
+// parseEventTime parses a notification eventTime which is a yang
+// `date-and-time` (RFC3339).  Some devices deviate from RFC3339 by using
+// a lowercase `t`/`z`, a space instead of `T`, an offset without a colon or
+// no offset which are accepted as well.
+func parseEventTime(s string) (time.Time, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) > 10 && s[10] == ' ' {
+		s = s[:10] + "T" + s[11:]
+	}
+
+	var err error
+	for _, layout := range eventTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid eventTime %q: %w", s, err)
 }
 
 // Decode will decode the body of a noticiation into a value pointed to by v.
@@ -179,6 +350,67 @@ type RPCError struct {
 	Path     string      `xml:"error-path,omitempty"`
 	Message  string      `xml:"error-message,omitempty"`
 	Info     RawXML      `xml:"error-info,omitempty"`
+
+	// PathNamespaces maps the namespace prefixes in scope for Path (declared
+	// on `<error-path>`, `<rpc-error>` or `<rpc-reply>`) to their namespace
+	// so the instance-identifier can be resolved to a data node.  Nil when
+	// there is no `<error-path>`.
+	PathNamespaces map[string]string `xml:"-"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler.  The severity is normalized so that
+// only warnings are treated as non-fatal: surrounding whitespace and case are
+// ignored, a `severity` attribute on `<rpc-error>` (sent by some devices instead
+// of `<error-severity>`) is used as a fallback and a missing severity is
+// treated as an error.
+func (e *RPCError) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type rpcError RPCError
+	var inner struct {
+		rpcError
+		// shadows rpcError.Path to get at the namespace declarations.
+		ErrorPath *struct {
+			Value string     `xml:",chardata"`
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"error-path"`
+	}
+	if err := d.DecodeElement(&inner, &start); err != nil {
+		return err
+	}
+
+	sev := strings.ToLower(strings.TrimSpace(string(inner.Severity)))
+	if sev == "" {
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "severity" {
+				sev = strings.ToLower(strings.TrimSpace(attr.Value))
+			}
+		}
+	}
+	if sev == "" {
+		sev = string(SevError)
+	}
+	inner.Severity = ErrSeverity(sev)
+
+	*e = RPCError(inner.rpcError)
+	if inner.ErrorPath != nil {
+		e.Path = inner.ErrorPath.Value
+		e.PathNamespaces = make(map[string]string)
+		e.inheritPathNamespaces(inner.ErrorPath.Attrs)
+		e.inheritPathNamespaces(start.Attr)
+	}
+	return nil
+}
+
+// inheritPathNamespaces adds the prefixes declared in attrs (from an enclosing
+// element) to PathNamespaces unless they are already set.
+func (e *RPCError) inheritPathNamespaces(attrs []xml.Attr) {
+	if e.PathNamespaces == nil {
+		return
+	}
+	for _, attr := range prefixDecls(attrs) {
+		if _, ok := e.PathNamespaces[attr.Name.Local]; !ok {
+			e.PathNamespaces[attr.Name.Local] = attr.Value
+		}
+	}
 }
 
 func (e RPCError) Error() string {
@@ -206,6 +438,14 @@ func (errs RPCErrors) Filter(severity ...ErrSeverity) RPCErrors {
 	return filteredErrs
 }
 
+// inheritPathNamespaces adds the prefixes declared on the `<rpc-reply>` to
+// the path namespaces of each error.
+func (errs RPCErrors) inheritPathNamespaces(decls []xml.Attr) {
+	for i := range errs {
+		errs[i].inheritPathNamespaces(decls)
+	}
+}
+
 func (errs RPCErrors) Error() string {
 	var sb strings.Builder
 	for i, err := range errs {
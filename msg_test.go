@@ -1,10 +1,15 @@
 package netconf
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var rawXMLTests = []struct {
@@ -211,6 +216,28 @@ func TestMarshalRPCMsg(t *testing.T) {
 	}
 }
 
+func TestMarshalRPCAttrOrder(t *testing.T) {
+	ops := []any{
+		"<get/>",
+		&GetConfigReq{Source: Running},
+		&CreateSubscriptionReq{Stream: "NETCONF"},
+	}
+
+	for _, op := range ops {
+		var first []byte
+		for i := 0; i < 50; i++ {
+			out, err := BuildRPC(18446744073709551615, op)
+			require.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(out, []byte(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="18446744073709551615">`)), "got %s", out)
+
+			if first == nil {
+				first = out
+			}
+			assert.Equal(t, first, out)
+		}
+	}
+}
+
 var replyJunosGetConfigError = []byte(`
 <rpc-reply xmlns:junos="http://xml.juniper.net/junos/20.3R0/junos" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
 <rpc-error>
@@ -276,3 +303,233 @@ func TestUnmarshalRPCReply(t *testing.T) {
 	}
 
 }
+
+func TestNotificationEventTime(t *testing.T) {
+	ist := time.FixedZone("", 5*60*60+30*60)
+
+	tt := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"2023-06-07T18:31:48Z", time.Date(2023, 6, 7, 18, 31, 48, 0, time.UTC)},
+		{"2023-06-07T18:31:48.123456Z", time.Date(2023, 6, 7, 18, 31, 48, 123456000, time.UTC)},
+		{"2023-06-07T18:31:48.123456789-07:00", time.Date(2023, 6, 8, 1, 31, 48, 123456789, time.UTC)},
+		{"2023-06-07T18:31:48.123456+05:30", time.Date(2023, 6, 7, 18, 31, 48, 123456000, ist)},
+		{"2023-06-07T18:31:48.1+0530", time.Date(2023, 6, 7, 18, 31, 48, 100000000, ist)},
+		{"2023-06-07t18:31:48z", time.Date(2023, 6, 7, 18, 31, 48, 0, time.UTC)},
+		{"2023-06-07 18:31:48Z", time.Date(2023, 6, 7, 18, 31, 48, 0, time.UTC)},
+		{" 2023-06-07T18:31:48 ", time.Date(2023, 6, 7, 18, 31, 48, 0, time.UTC)},
+		{"yesterday", time.Time{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.raw, func(t *testing.T) {
+			in := `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>` + tc.raw + `</eventTime><event/></notification>`
+
+			var notif Notification
+			assert.NoError(t, xml.Unmarshal([]byte(in), &notif))
+			assert.Equal(t, tc.raw, notif.EventTimeRaw)
+			assert.True(t, tc.want.Equal(notif.EventTime), "want %s, got %s", tc.want, notif.EventTime)
+		})
+	}
+}
+
+func TestReplyWarnings(t *testing.T) {
+	tt := []struct {
+		name         string
+		reply        string
+		wantErr      bool
+		wantWarnings int
+	}{
+		{
+			name: "ok with warning",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity> warning </error-severity><error-message>interface is down</error-message></rpc-error>
+<ok/>
+</rpc-reply>`,
+			wantWarnings: 1,
+		},
+		{
+			name: "severity attribute",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+<rpc-error severity="warning"><error-type>application</error-type><error-tag>operation-failed</error-tag></rpc-error>
+<ok/>
+</rpc-reply>`,
+			wantWarnings: 1,
+		},
+		{
+			name: "warning and error",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity></rpc-error>
+<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity></rpc-error>
+</rpc-reply>`,
+			wantErr:      true,
+			wantWarnings: 1,
+		},
+		{
+			name: "missing severity",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag></rpc-error>
+</rpc-reply>`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var reply Reply
+			require.NoError(t, xml.Unmarshal([]byte(tc.reply), &reply))
+
+			if tc.wantErr {
+				assert.Error(t, reply.Err())
+			} else {
+				assert.NoError(t, reply.Err())
+			}
+			assert.Len(t, reply.Warnings(), tc.wantWarnings)
+			for _, w := range reply.Warnings() {
+				assert.Equal(t, SevWarning, w.Severity)
+			}
+		})
+	}
+
+	// typed operations succeed on an `<ok/>` with warnings
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+	ts.queueRespString(tt[0].reply)
+	assert.NoError(t, sess.Lock(context.Background(), Candidate))
+}
+
+func TestReplyExtras(t *testing.T) {
+	tt := []struct {
+		name  string
+		reply string
+		want  []RawXML
+	}{
+		{
+			name: "vendor element after data",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:v="urn:example:vendor" message-id="1">
+<data><system xmlns="urn:example:system"><hostname>r1</hostname></system></data>
+<v:commit-info><v:user>admin</v:user></v:commit-info>
+</rpc-reply>`,
+			want: []RawXML{RawXML(`<v:commit-info xmlns:v="urn:example:vendor"><v:user>admin</v:user></v:commit-info>`)},
+		},
+		{
+			name: "warning before data",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity></rpc-error>
+<data/><timing xmlns="urn:example:vendor">12ms</timing>
+</rpc-reply>`,
+			want: []RawXML{RawXML(`<timing xmlns="urn:example:vendor">12ms</timing>`)},
+		},
+		{
+			name:  "nothing extra",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			go sess.recv()
+			ts.queueRespString(tc.reply)
+
+			reply, err := sess.Do(context.Background(), "<get/>")
+			require.NoError(t, err)
+
+			got, err := reply.Extras()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRPCErrorPath(t *testing.T) {
+	const replyXML = `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:sys="urn:example:system" message-id="1">
+<rpc-error xmlns:t="urn:example:top">
+  <error-type>application</error-type>
+  <error-tag>invalid-value</error-tag>
+  <error-severity>error</error-severity>
+  <error-path xmlns:if="urn:example:interfaces" xmlns:t="urn:example:top-override">/t:top/if:interface[if:name="eth0"]/sys:mtu</error-path>
+</rpc-error>
+<rpc-error>
+  <error-type>protocol</error-type>
+  <error-tag>operation-failed</error-tag>
+  <error-severity>error</error-severity>
+</rpc-error>
+</rpc-reply>`
+
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+	ts.queueRespString(replyXML)
+
+	reply, err := sess.Do(context.Background(), "<get/>")
+	require.NoError(t, err)
+	require.Len(t, reply.Errors, 2)
+
+	pathErr := reply.Errors[0]
+	assert.Equal(t, `/t:top/if:interface[if:name="eth0"]/sys:mtu`, pathErr.Path)
+	assert.Equal(t, map[string]string{
+		"if":  "urn:example:interfaces",
+		"t":   "urn:example:top-override",
+		"sys": "urn:example:system",
+	}, pathErr.PathNamespaces)
+
+	assert.Empty(t, reply.Errors[1].Path)
+	assert.Nil(t, reply.Errors[1].PathNamespaces)
+}
+
+func FuzzHelloMsg(f *testing.F) {
+	for _, tc := range helloMsgTestTable {
+		f.Add(tc.raw)
+	}
+	for _, hello := range []string{helloGood, helloBadXML, helloNoSessID, helloNoCaps} {
+		f.Add([]byte(hello))
+	}
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		var hello helloMsg
+		if err := xml.Unmarshal(input, &hello); err != nil {
+			return
+		}
+
+		out, err := xml.Marshal(&hello)
+		if err != nil {
+			t.Fatalf("failed to marshal decoded hello: %v", err)
+		}
+		var again helloMsg
+		if err := xml.Unmarshal(out, &again); err != nil {
+			t.Fatalf("failed to decode re-encoded hello %q: %v", out, err)
+		}
+		if hello.SessionID != again.SessionID || !slices.Equal(hello.Capabilities, again.Capabilities) {
+			t.Fatalf("re-encoded hello changed: %+v != %+v", again, hello)
+		}
+	})
+}
+
+func FuzzReply(f *testing.F) {
+	f.Add(replyJunosGetConfigError)
+	f.Add([]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:v="urn:example:vendor" message-id="1"><data><v:system/></data><v:extra/></rpc-reply>`))
+	f.Add([]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><rpc-error severity="warning"><error-type>application</error-type><error-tag>operation-failed</error-tag><error-path xmlns:if="urn:example:if">/if:interfaces</error-path></rpc-error><ok/></rpc-reply>`))
+	f.Add([]byte(`<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>2023-06-07T18:32:00Z</eventTime><link-down xmlns="urn:example:links"/></notification>`))
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		// the decoding done by the receive loop of a session
+		sess := newSession(&syncTransport{pending: [][]byte{input}})
+		_ = sess.recvMsg(context.Background())
+
+		var reply Reply
+		if err := xml.Unmarshal(input, &reply); err != nil {
+			return
+		}
+		_ = reply.Err()
+		_ = reply.Warnings()
+		_, _ = reply.Extras()
+		var body struct {
+			Inner []byte `xml:",innerxml"`
+		}
+		_ = reply.Decode(&body)
+	})
+}
@@ -0,0 +1,132 @@
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"sync"
+)
+
+// maxBufferedMsg is the largest message that is fully buffered before being
+// written to the transport.  Anything larger is streamed.
+const maxBufferedMsg = 32 * 1024
+
+// msgBuffer buffers a marshaled message so that small messages (which is most
+// rpcs) are handed to the transport in a single write.  Once the message grows
+// past maxBufferedMsg the transport's writer is opened and the rest of the
+// message is streamed to it.
+type msgBuffer struct {
+	buf  bytes.Buffer
+	open func() (io.WriteCloser, error)
+	w    io.WriteCloser
+}
+
+func (b *msgBuffer) Write(p []byte) (int, error) {
+	if b.w == nil && b.buf.Len()+len(p) > maxBufferedMsg {
+		w, err := b.open()
+		if err != nil {
+			return 0, err
+		}
+		b.w = w
+		if _, err := b.w.Write(b.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		b.buf.Reset()
+	}
+
+	if b.w != nil {
+		return b.w.Write(p)
+	}
+	return b.buf.Write(p)
+}
+
+// Close writes out any buffered message and ends the message.
+func (b *msgBuffer) Close() error {
+	if b.w == nil {
+		w, err := b.open()
+		if err != nil {
+			return err
+		}
+		b.w = w
+		if _, err := b.w.Write(b.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return b.w.Close()
+}
+
+// msgEncoder is a reusable xml.Encoder writing into a msgBuffer.
+type msgEncoder struct {
+	buf *msgBuffer
+	enc *xml.Encoder
+}
+
+var msgEncoders = sync.Pool{
+	New: func() any {
+		buf := &msgBuffer{}
+		return &msgEncoder{buf: buf, enc: xml.NewEncoder(buf)}
+	},
+}
+
+// encodeMsg marshals v (indented with `indent` unless empty) and writes it as
+// a single message to the writer returned from `open`.  The writer is only
+// opened once the message has been marshaled (or is too large to buffer) so a
+// marshaling error of a small message doesn't leave a partial message on the
+// transport.
+func encodeMsg(open func() (io.WriteCloser, error), v any, indent string) error {
+	me := msgEncoders.Get().(*msgEncoder)
+	me.buf.open = open
+
+	// the pooled encoders stay compact as an encoder that has indented
+	// starts the next message on a new line.
+	enc := me.enc
+	if indent != "" {
+		enc = xml.NewEncoder(me.buf)
+		enc.Indent("", indent)
+	}
+
+	err := enc.Encode(v)
+	if err == nil {
+		err = me.buf.Close()
+	}
+
+	// encoders that failed may be in a bad state and large buffers are not
+	// worth holding on to.
+	if err != nil || me.buf.buf.Cap() > maxBufferedMsg {
+		return err
+	}
+
+	me.buf.buf.Reset()
+	me.buf.open = nil
+	me.buf.w = nil
+	msgEncoders.Put(me)
+	return nil
+}
+
+// readAllContext is like io.ReadAll but checks ctx between reads so that a
+// message trickling in from a device that has stalled can be abandoned.  The
+// partially read data is discarded and ctx.Err() returned.  A single read that
+// blocks forever is not interrupted; use a transport deadline for that.
+func readAllContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	b := make([]byte, 0, 512)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return b, err
+		}
+
+		if len(b) == cap(b) {
+			// let append pick the next size
+			b = append(b, 0)[:len(b)]
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingWriter struct {
+	bytes.Buffer
+	writes int
+	closed bool
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+type failMarshal struct{}
+
+func (failMarshal) MarshalXML(*xml.Encoder, xml.StartElement) error {
+	return errors.New("marshal failed")
+}
+
+func TestEncodeMsg(t *testing.T) {
+	tt := []struct {
+		name       string
+		v          any
+		wantErr    bool
+		wantOpened bool
+		wantWrites int
+	}{
+		{
+			name:       "small",
+			v:          &LockReq{XMLName: xml.Name{Local: "lock"}, Target: Running},
+			wantOpened: true,
+			wantWrites: 1,
+		},
+		{
+			name: "large",
+			v: &struct {
+				XMLName xml.Name `xml:"config"`
+				Data    string   `xml:"data"`
+			}{Data: strings.Repeat("x", 3*maxBufferedMsg)},
+			wantOpened: true,
+		},
+		{
+			name:    "marshal error",
+			v:       &request{MessageID: 1, Operation: failMarshal{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				w      recordingWriter
+				opened bool
+			)
+			open := func() (io.WriteCloser, error) {
+				opened = true
+				return &w, nil
+			}
+
+			err := encodeMsg(open, tc.v, "")
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.False(t, opened, "writer opened for a message that failed to marshal")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOpened, opened)
+			assert.True(t, w.closed)
+
+			want, err := xml.Marshal(tc.v)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), w.String())
+			if tc.wantWrites > 0 {
+				assert.Equal(t, tc.wantWrites, w.writes)
+			}
+		})
+	}
+}
+
+// dripReader returns one byte per read, waiting for a tick before each.
+type dripReader struct {
+	data []byte
+	tick <-chan struct{}
+}
+
+func (r *dripReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	<-r.tick
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func TestReadAllContext(t *testing.T) {
+	reply := []byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+
+	t.Run("complete", func(t *testing.T) {
+		got, err := readAllContext(context.Background(), iotest.OneByteReader(bytes.NewReader(reply)))
+		require.NoError(t, err)
+		assert.Equal(t, reply, got)
+	})
+
+	t.Run("canceled mid-read", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		tick := make(chan struct{})
+		r := &dripReader{data: reply, tick: tick}
+
+		type result struct {
+			data []byte
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			data, err := readAllContext(ctx, r)
+			done <- result{data, err}
+		}()
+
+		// let a few bytes through and then give up on the rest
+		for i := 0; i < 10; i++ {
+			tick <- struct{}{}
+		}
+		cancel()
+		close(tick)
+
+		select {
+		case res := <-done:
+			assert.ErrorIs(t, res.err, context.Canceled)
+			assert.Nil(t, res.data)
+		case <-time.After(time.Second):
+			t.Fatal("read was not abandoned")
+		}
+		assert.NotEmpty(t, r.data, "the whole reply was read")
+	})
+}
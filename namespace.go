@@ -0,0 +1,260 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+)
+
+// prefixDecls returns the prefixed namespace declarations (i.e `xmlns:foo="..."`)
+// found in the given attributes.  Default namespace declarations are not
+// included.
+func prefixDecls(attrs []xml.Attr) []xml.Attr {
+	var decls []xml.Attr
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" {
+			decls = append(decls, attr)
+		}
+	}
+	return decls
+}
+
+// declaresPrefix reports if the start element itself declares the given
+// namespace prefix.
+func declaresPrefix(start xml.StartElement, prefix string) bool {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" && attr.Name.Local == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// injectNamespaces will add the prefixed namespace declarations in `decls` to
+// every top-level element of the xml fragment `inner`.
+//
+// encoding/xml drops the namespace declarations of ancestor elements when
+// capturing inner xml, which means prefixes used in values (i.e
+// instance-identifiers, identityrefs, or xpath in leafrefs) of the captured
+// xml can no longer be resolved. Re-declaring the in-scope prefixes on each
+// top-level element makes the fragment self contained so that it can be
+// decoded or sent back to a device and have the same meaning.
+//
+// Prefixes already declared on the element are left alone and everything else
+// is passed through byte-for-byte.  If the fragment cannot be tokenized then
+// it is returned as-is.
+func injectNamespaces(inner []byte, decls []xml.Attr) []byte {
+	if len(decls) == 0 || len(inner) == 0 {
+		return inner
+	}
+
+	var (
+		out   bytes.Buffer
+		last  int
+		depth int
+	)
+
+	// RawToken is used as it doesn't do any namespace translation (or
+	// validation) and so leaves the prefixes alone.
+	dec := xml.NewDecoder(bytes.NewReader(inner))
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			break
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				// offset is just past the closing '>' of the start tag
+				end := int(dec.InputOffset())
+				insertAt := end - 1
+				if inner[end-2] == '/' {
+					insertAt = end - 2
+				}
+
+				out.Write(inner[last:insertAt])
+				for _, decl := range decls {
+					if declaresPrefix(tok, decl.Name.Local) {
+						continue
+					}
+					out.WriteString(" xmlns:")
+					out.WriteString(decl.Name.Local)
+					out.WriteString(`="`)
+					_ = xml.EscapeText(&out, []byte(decl.Value))
+					out.WriteByte('"')
+				}
+				last = insertAt
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	if last == 0 {
+		return inner
+	}
+
+	out.Write(inner[last:])
+	return out.Bytes()
+}
+
+var xmlNameType = reflect.TypeOf(xml.Name{})
+
+// namespaceFixer is a xml.TokenReader for decoding into a Go type whose
+// struct tags may not have the same namespaces as the document.  Elements are
+// matched to fields of the type being decoded by local name only and renamed
+// to the namespace the field expects (from it's tag or the XMLName of it's
+// type) so encoding/xml accepts them.  Elements without a matching field keep
+// their namespace.  Namespace declarations are dropped as the names are
+// already resolved.
+type namespaceFixer struct {
+	d *xml.Decoder
+	// root is returned before reading from d when set.
+	root *xml.StartElement
+	typ  reflect.Type
+
+	stack []nsFrame
+}
+
+type nsFrame struct {
+	// name is the (renamed) name of the element to use for it's end element.
+	name xml.Name
+	// typ is the struct type the element is decoded into or nil if unknown.
+	typ reflect.Type
+}
+
+func newNamespaceFixer(d *xml.Decoder, root *xml.StartElement, v any) *namespaceFixer {
+	return &namespaceFixer{d: d, root: root, typ: reflect.TypeOf(v)}
+}
+
+func (f *namespaceFixer) Token() (xml.Token, error) {
+	var tok xml.Token
+	if f.root != nil {
+		tok, f.root = *f.root, nil
+	} else {
+		var err error
+		if tok, err = f.d.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch t := tok.(type) {
+	case xml.StartElement:
+		var space string
+		var typ reflect.Type
+		if len(f.stack) == 0 {
+			typ = structType(f.typ)
+			space = xmlNameSpace(typ)
+		} else if parent := f.stack[len(f.stack)-1].typ; parent != nil {
+			space, typ = fieldFor(parent, t.Name.Local)
+		}
+		if space != "" {
+			t.Name.Space = space
+		}
+
+		attrs := t.Attr[:0:0]
+		for _, attr := range t.Attr {
+			if attr.Name.Space != "xmlns" && !(attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+				attrs = append(attrs, attr)
+			}
+		}
+		t.Attr = attrs
+
+		f.stack = append(f.stack, nsFrame{name: t.Name, typ: typ})
+		return t, nil
+	case xml.EndElement:
+		if len(f.stack) > 0 {
+			t.Name = f.stack[len(f.stack)-1].name
+			f.stack = f.stack[:len(f.stack)-1]
+		}
+		return t, nil
+	}
+	return xml.CopyToken(tok), nil
+}
+
+// structType returns the struct type that elements of t are decoded into
+// (through pointers, slices and arrays) or nil if it isn't one.
+func structType(t reflect.Type) reflect.Type {
+	for t != nil {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		case reflect.Struct:
+			if t == xmlNameType {
+				return nil
+			}
+			return t
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// xmlNameSpace returns the namespace in the tag of the XMLName field of the
+// struct type t.
+func xmlNameSpace(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	field, ok := t.FieldByName("XMLName")
+	if !ok || field.Type != xmlNameType {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("xml"), ",")
+	space, _, _ := strings.Cut(name, " ")
+	if space == name {
+		return ""
+	}
+	return space
+}
+
+// fieldFor returns the namespace expected for the element with the local name
+// by the matching field of struct type t along with the struct type the
+// element is decoded into.
+func fieldFor(t reflect.Type, local string) (string, reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("xml")
+		if tag == "-" || field.Name == "XMLName" {
+			continue
+		}
+		if field.Anonymous && !ok {
+			if embedded := structType(field.Type); embedded != nil {
+				if space, typ := fieldFor(embedded, local); space != "" || typ != nil {
+					return space, typ
+				}
+			}
+			continue
+		}
+
+		name, flags, _ := strings.Cut(tag, ",")
+		if flags != "" && flags != "omitempty" {
+			// attributes, chardata, innerxml, any
+			continue
+		}
+		if strings.Contains(name, ">") {
+			continue
+		}
+		space, fieldLocal, ok := strings.Cut(name, " ")
+		if !ok {
+			space, fieldLocal = "", name
+		}
+		if fieldLocal == "" {
+			fieldLocal = field.Name
+		}
+		if fieldLocal != local {
+			continue
+		}
+
+		typ := structType(field.Type)
+		if space == "" {
+			space = xmlNameSpace(typ)
+		}
+		return space, typ
+	}
+	return "", nil
+}
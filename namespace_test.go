@@ -0,0 +1,61 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectNamespaces(t *testing.T) {
+	decls := []xml.Attr{
+		{Name: xml.Name{Space: "xmlns", Local: "if"}, Value: "urn:ietf:params:xml:ns:yang:ietf-interfaces"},
+		{Name: xml.Name{Space: "xmlns", Local: "ianaift"}, Value: "urn:ietf:params:xml:ns:yang:iana-if-type"},
+	}
+
+	tt := []struct {
+		name  string
+		inner string
+		decls []xml.Attr
+		want  string
+	}{
+		{
+			name:  "no decls",
+			inner: `<if:interfaces/>`,
+			want:  `<if:interfaces/>`,
+		},
+		{
+			name:  "text only",
+			inner: `foo`,
+			decls: decls,
+			want:  `foo`,
+		},
+		{
+			name:  "self closing",
+			inner: `<if:interfaces/>`,
+			decls: decls,
+			want:  `<if:interfaces xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type"/>`,
+		},
+		{
+			name:  "only top level",
+			inner: "\n<if:interfaces><if:interface><if:type>ianaift:ethernetCsmacd</if:type></if:interface></if:interfaces>\n<system/>",
+			decls: decls,
+			want: "\n" + `<if:interfaces xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type">` +
+				`<if:interface><if:type>ianaift:ethernetCsmacd</if:type></if:interface></if:interfaces>` + "\n" +
+				`<system xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type"/>`,
+		},
+		{
+			name:  "already declared",
+			inner: `<if:interfaces xmlns:if="urn:other"></if:interfaces>`,
+			decls: decls,
+			want:  `<if:interfaces xmlns:if="urn:other" xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type"></if:interfaces>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := injectNamespaces([]byte(tc.inner), tc.decls)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Package netconftest provides assertions for tests of code using netconf
+// against mock or real devices.
+package netconftest
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/dau71/netconf"
+)
+
+// rpcErrors returns the `<rpc-error>`s in err or any of the errors it wraps.
+func rpcErrors(err error) netconf.RPCErrors {
+	var multi netconf.RPCErrors
+	var single netconf.RPCError
+	switch {
+	case errors.As(err, &multi):
+		return multi
+	case errors.As(err, &single):
+		return netconf.RPCErrors{single}
+	}
+	return nil
+}
+
+// AssertOK fails the test unless reply is an `<ok/>` without any
+// `<rpc-error>`s of severity error.  Warnings are allowed.  It returns whether
+// the assertion passed.
+func AssertOK(t testing.TB, reply *netconf.Reply) bool {
+	t.Helper()
+
+	if reply == nil {
+		t.Errorf("expected an <ok/> reply but got no reply")
+		return false
+	}
+	if err := reply.Err(); err != nil {
+		t.Errorf("expected an <ok/> reply but got errors:\n%v", err)
+		return false
+	}
+
+	var elem struct{ XMLName xml.Name }
+	if err := reply.Decode(&elem); err != nil {
+		t.Errorf("expected an <ok/> reply but failed to decode the reply: %v\n%s", err, reply.Body)
+		return false
+	}
+	if elem.XMLName.Local != "ok" {
+		t.Errorf("expected an <ok/> reply but got <%s>", elem.XMLName.Local)
+		return false
+	}
+	return true
+}
+
+// AssertErrorTag fails the test unless err is (or wraps) an
+// [netconf.RPCError] or [netconf.RPCErrors] with at least one error with the
+// given tag.  It returns whether the assertion passed.
+func AssertErrorTag(t testing.TB, err error, tag netconf.ErrTag) bool {
+	t.Helper()
+
+	if err == nil {
+		t.Errorf("expected an rpc-error with tag %q but got no error", tag)
+		return false
+	}
+
+	rpcErrs := rpcErrors(err)
+	if len(rpcErrs) == 0 {
+		t.Errorf("expected an rpc-error with tag %q but got: %v", tag, err)
+		return false
+	}
+	for _, rpcErr := range rpcErrs {
+		if rpcErr.Tag == tag {
+			return true
+		}
+	}
+	t.Errorf("expected an rpc-error with tag %q but got:\n%v", tag, rpcErrs)
+	return false
+}
@@ -0,0 +1,90 @@
+package netconftest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"testing"
+
+	"github.com/dau71/netconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT records failures instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func parseReply(t *testing.T, body string) *netconf.Reply {
+	t.Helper()
+
+	var reply netconf.Reply
+	err := xml.Unmarshal([]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">`+body+`</rpc-reply>`), &reply)
+	require.NoError(t, err)
+	return &reply
+}
+
+const (
+	inUseErr   = `<rpc-error><error-type>protocol</error-type><error-tag>in-use</error-tag><error-severity>error</error-severity></rpc-error>`
+	warningErr = `<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity></rpc-error>`
+)
+
+func TestAssertOK(t *testing.T) {
+	tt := []struct {
+		name  string
+		reply *netconf.Reply
+		want  bool
+	}{
+		{"ok", parseReply(t, "<ok/>"), true},
+		{"ok with warning", parseReply(t, warningErr+"<ok/>"), true},
+		{"error", parseReply(t, inUseErr), false},
+		{"data", parseReply(t, "<data/>"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := &recordingT{}
+			assert.Equal(t, tc.want, AssertOK(rt, tc.reply))
+			assert.Equal(t, tc.want, len(rt.errors) == 0, rt.errors)
+		})
+	}
+}
+
+func TestAssertErrorTag(t *testing.T) {
+	single := netconf.RPCError{Tag: netconf.ErrInUse, Severity: netconf.SevError}
+	multi := netconf.RPCErrors{
+		{Tag: netconf.ErrDataMissing, Severity: netconf.SevError},
+		{Tag: netconf.ErrLockDenied, Severity: netconf.SevError},
+	}
+
+	tt := []struct {
+		name string
+		err  error
+		tag  netconf.ErrTag
+		want bool
+	}{
+		{"single", single, netconf.ErrInUse, true},
+		{"single wrong tag", single, netconf.ErrLockDenied, false},
+		{"multiple", multi, netconf.ErrLockDenied, true},
+		{"multiple wrong tag", multi, netconf.ErrInUse, false},
+		{"wrapped", fmt.Errorf("%w: %w", netconf.ErrCommitInUse, single), netconf.ErrInUse, true},
+		{"not an rpc-error", fmt.Errorf("connection reset"), netconf.ErrInUse, false},
+		{"nil", nil, netconf.ErrInUse, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := &recordingT{}
+			assert.Equal(t, tc.want, AssertErrorTag(rt, tc.err, tc.tag))
+			assert.Equal(t, tc.want, len(rt.errors) == 0, rt.errors)
+		})
+	}
+}
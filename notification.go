@@ -0,0 +1,325 @@
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const notifNamespace = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+
+// Event returns the name and raw xml of the event element of the notification
+// (the element following `<eventTime>`).  Namespace prefixes declared on the
+// `<notification>` element are re-declared on the returned element.
+func (n Notification) Event() (xml.Name, []byte, error) {
+	elems, err := SplitElements(n.Body)
+	if err != nil {
+		return xml.Name{}, nil, err
+	}
+
+	for _, elem := range elems {
+		// Body is the inner xml of `<notification>` so the default namespace
+		// declared there is gone and eventTime may show up without one.
+		if elem.Name.Local == "eventTime" &&
+			(elem.Name.Space == notifNamespace || elem.Name.Space == "") {
+			continue
+		}
+		return elem.Name, injectNamespaces(elem.XML, n.nsDecls), nil
+	}
+	return xml.Name{}, nil, fmt.Errorf("notification has no event element")
+}
+
+// NotificationMux dispatches notifications to handlers registered by the name
+// of the event element.  It can be used with [WithNotificationHandler] as
+// `WithNotificationHandler(mux.Notify)`.
+type NotificationMux struct {
+	mu       sync.RWMutex
+	handlers map[xml.Name]func([]byte) error
+	fallback NotificationHandler
+	onError  func(Notification, error)
+}
+
+// NewNotificationMux returns a new, empty, NotificationMux.
+func NewNotificationMux() *NotificationMux {
+	return &NotificationMux{
+		handlers: make(map[xml.Name]func([]byte) error),
+	}
+}
+
+// Handle registers a handler for notifications whose event element matches
+// the given name.  The handler is called with the raw xml of the event element
+// and any errors returned are passed to the error handler set with
+// [NotificationMux.HandleError].
+func (m *NotificationMux) Handle(name xml.Name, handler func([]byte) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[name] = handler
+}
+
+// HandleFallback registers a handler for notifications that don't match any
+// other registered handler.  Unmatched notifications are dropped if no
+// fallback is set.
+func (m *NotificationMux) HandleFallback(handler NotificationHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = handler
+}
+
+// HandleError registers a function called with the notification and the error
+// when a notification cannot be dispatched or a handler returns an error.
+// Errors are dropped if no error handler is set.
+func (m *NotificationMux) HandleError(handler func(Notification, error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onError = handler
+}
+
+// HandleNotification registers a handler on the mux for notifications whose
+// event element matches the given name decoding the event element into a new
+// value of type T.
+func HandleNotification[T any](m *NotificationMux, name xml.Name, handler func(T) error) {
+	m.Handle(name, func(raw []byte) error {
+		var v T
+		if err := xml.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("failed to decode notification %q: %w", name.Local, err)
+		}
+		return handler(v)
+	})
+}
+
+// Notify dispatches the notification to the matching handler.
+func (m *NotificationMux) Notify(msg Notification) {
+	m.mu.RLock()
+	fallback, onError := m.fallback, m.onError
+	m.mu.RUnlock()
+
+	name, raw, err := msg.Event()
+	if err != nil {
+		if onError != nil {
+			onError(msg, fmt.Errorf("failed to dispatch notification: %w", err))
+		}
+		return
+	}
+
+	m.mu.RLock()
+	handler, ok := m.handlers[name]
+	m.mu.RUnlock()
+
+	if !ok {
+		if fallback != nil {
+			fallback(msg)
+		}
+		return
+	}
+
+	if err := handler(raw); err != nil && onError != nil {
+		onError(msg, fmt.Errorf("notification handler for %q failed: %w", name.Local, err))
+	}
+}
+
+// NotificationPolicy decides what happens when a notification arrives while
+// the buffer set with [WithNotificationBuffer] is full.
+type NotificationPolicy int
+
+const (
+	// NotificationBlock stops reading from the device until the handler makes
+	// room in the buffer.  No notifications are lost but rpc replies are held
+	// up behind them.
+	NotificationBlock NotificationPolicy = iota
+
+	// NotificationDropOldest drops the oldest buffered notification to make
+	// room so the session keeps reading.  Dropped notifications are counted in
+	// [Stats].
+	NotificationDropOldest
+)
+
+// notificationQueue buffers notifications between the receive loop and the
+// notification handler.
+type notificationQueue struct {
+	ch      chan Notification
+	policy  NotificationPolicy
+	dropped atomic.Uint64
+}
+
+func newNotificationQueue(size int, policy NotificationPolicy) *notificationQueue {
+	return &notificationQueue{
+		ch:     make(chan Notification, size),
+		policy: policy,
+	}
+}
+
+// push is only called from the receive loop so with NotificationDropOldest
+// there is always room after dropping one.
+func (q *notificationQueue) push(n Notification) {
+	if q.policy == NotificationDropOldest {
+		select {
+		case q.ch <- n:
+			return
+		default:
+		}
+		select {
+		case <-q.ch:
+			q.dropped.Add(1)
+		default:
+		}
+	}
+	q.ch <- n
+}
+
+// run calls the handler for every buffered notification until the queue is
+// closed.
+func (q *notificationQueue) run(handler NotificationHandler) {
+	for n := range q.ch {
+		handler(n)
+	}
+}
+
+func (q *notificationQueue) close() { close(q.ch) }
+
+type notifWaiter struct {
+	match func(Notification) bool
+	ch    chan Notification
+}
+
+// WaitForNotification blocks until a notification for which `match` returns
+// true is received or ctx is done.  Notifications are not taken away from the
+// notification handler: every notification (including the matching one) is
+// still passed to it as usual so waiting never loses notifications meant for
+// the main stream.  Only notifications received after the call are matched.
+//
+// `match` is called from the receive loop and must not block.  Notifications
+// are not supported in synchronous mode so this only returns once ctx is done
+// or the session is closed.
+func (s *Session) WaitForNotification(ctx context.Context, match func(Notification) bool) (Notification, error) {
+	w := &notifWaiter{
+		match: match,
+		ch:    make(chan Notification, 1),
+	}
+
+	s.notifMu.Lock()
+	if s.notifWaiters == nil {
+		s.notifWaiters = make(map[*notifWaiter]struct{})
+	}
+	s.notifWaiters[w] = struct{}{}
+	s.notifMu.Unlock()
+
+	defer func() {
+		s.notifMu.Lock()
+		delete(s.notifWaiters, w)
+		s.notifMu.Unlock()
+	}()
+
+	select {
+	case n := <-w.ch:
+		return n, nil
+	case <-ctx.Done():
+		return Notification{}, ctx.Err()
+	case <-s.done:
+		return Notification{}, ErrClosed
+	}
+}
+
+func (s *Session) hasNotifWaiters() bool {
+	s.notifMu.Lock()
+	defer s.notifMu.Unlock()
+	return len(s.notifWaiters) > 0
+}
+
+// wakeNotifWaiters hands the notification to every waiter it matches.  Each
+// waiter only takes the first match.
+func (s *Session) wakeNotifWaiters(n Notification) {
+	s.notifMu.Lock()
+	waiters := make([]*notifWaiter, 0, len(s.notifWaiters))
+	for w := range s.notifWaiters {
+		waiters = append(waiters, w)
+	}
+	s.notifMu.Unlock()
+
+	for _, w := range waiters {
+		if !w.match(n) {
+			continue
+		}
+		select {
+		case w.ch <- n:
+		default:
+		}
+	}
+}
+
+// ncNotificationsNamespace is the namespace of the notifications defined in
+// RFC6470.
+const ncNotificationsNamespace = "urn:ietf:params:xml:ns:yang:ietf-netconf-notifications"
+
+// ConfigChange is the `<netconf-config-change>` notification defined in
+// [RFC6470 2.1] sent when a configuration datastore has been changed.
+//
+// [RFC6470 2.1]: https://www.rfc-editor.org/rfc/rfc6470.html#section-2.1
+type ConfigChange struct {
+	XMLName   xml.Name           `xml:"urn:ietf:params:xml:ns:yang:ietf-netconf-notifications netconf-config-change"`
+	ChangedBy ChangedBy          `xml:"changed-by"`
+	Datastore Datastore          `xml:"datastore"`
+	Edits     []ConfigChangeEdit `xml:"edit"`
+}
+
+// ChangedBy identifies who made a change reported in a RFC6470 notification.
+// Either Server is set (the change was made by the device itself) or the
+// session fields are.
+type ChangedBy struct {
+	// Server is true if the change was made by the device itself.
+	Server bool
+
+	Username   string `xml:"username"`
+	SessionID  uint64 `xml:"session-id"`
+	SourceHost string `xml:"source-host"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler to decode the `<server/>` leaf.
+func (c *ChangedBy) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v struct {
+		Server     *struct{} `xml:"server"`
+		Username   string    `xml:"username"`
+		SessionID  uint64    `xml:"session-id"`
+		SourceHost string    `xml:"source-host"`
+	}
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	*c = ChangedBy{
+		Server:     v.Server != nil,
+		Username:   v.Username,
+		SessionID:  v.SessionID,
+		SourceHost: v.SourceHost,
+	}
+	return nil
+}
+
+// ConfigChangeEdit is one of the edits in a [ConfigChange].
+type ConfigChangeEdit struct {
+	// Target is the instance-identifier of the changed node.  The prefixes
+	// are the ones used by the device.
+	Target string `xml:"target"`
+
+	// Operation is the kind of change (i.e `merge`, `replace`, `create`,
+	// `delete` or `remove`).
+	Operation string `xml:"operation"`
+}
+
+// ConfigChange decodes the notification as a [ConfigChange].  An error is
+// returned if it is a different notification.
+func (n Notification) ConfigChange() (*ConfigChange, error) {
+	name, raw, err := n.Event()
+	if err != nil {
+		return nil, err
+	}
+	if name != (xml.Name{Space: ncNotificationsNamespace, Local: "netconf-config-change"}) {
+		return nil, fmt.Errorf("notification is %q not netconf-config-change", name.Local)
+	}
+
+	var cc ConfigChange
+	if err := xml.Unmarshal(raw, &cc); err != nil {
+		return nil, fmt.Errorf("failed to decode netconf-config-change: %w", err)
+	}
+	return &cc, nil
+}
@@ -0,0 +1,384 @@
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	notifConfigChange = `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">
+  <eventTime>2023-06-07T18:31:48Z</eventTime>
+  <netconf-config-change xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-notifications">
+    <changed-by><username>admin</username></changed-by>
+    <datastore>running</datastore>
+  </netconf-config-change>
+</notification>`
+
+	notifLinkDown = `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">
+  <eventTime>2023-06-07T18:32:00Z</eventTime>
+  <link-down xmlns="urn:example:links"><if-name>eth0</if-name></link-down>
+</notification>`
+
+	notifUnknown = `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">
+  <eventTime>2023-06-07T18:33:00Z</eventTime>
+  <something-else xmlns="urn:example:other"/>
+</notification>`
+)
+
+func TestNotificationEvent(t *testing.T) {
+	var notif Notification
+	require.NoError(t, xml.Unmarshal([]byte(notifLinkDown), &notif))
+
+	name, raw, err := notif.Event()
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Name{Space: "urn:example:links", Local: "link-down"}, name)
+	assert.Equal(t, `<link-down xmlns="urn:example:links"><if-name>eth0</if-name></link-down>`, string(raw))
+}
+
+func TestNotificationEventPrefixes(t *testing.T) {
+	notif := Notification{
+		Body: []byte(`<eventTime>2023-06-07T18:32:00Z</eventTime><links:link-down xmlns:links="urn:example:links"><links:type>if:ethernet</links:type></links:link-down>`),
+		nsDecls: []xml.Attr{
+			{Name: xml.Name{Space: "xmlns", Local: "if"}, Value: "urn:example:if"},
+		},
+	}
+
+	name, raw, err := notif.Event()
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Name{Space: "urn:example:links", Local: "link-down"}, name)
+	assert.Equal(t, `<links:link-down xmlns:links="urn:example:links" xmlns:if="urn:example:if"><links:type>if:ethernet</links:type></links:link-down>`, string(raw))
+}
+
+func TestNotificationConfigChange(t *testing.T) {
+	const raw = `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">
+  <eventTime>2023-06-07T18:31:48Z</eventTime>
+  <netconf-config-change xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-notifications">
+    <changed-by><server/></changed-by>
+    <datastore>candidate</datastore>
+    <edit>
+      <target xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces">/if:interfaces/if:interface[if:name='eth0']</target>
+      <operation>merge</operation>
+    </edit>
+    <edit>
+      <target xmlns:sys="urn:ietf:params:xml:ns:yang:ietf-system">/sys:system/sys:location</target>
+      <operation>delete</operation>
+    </edit>
+  </netconf-config-change>
+</notification>`
+
+	var notif Notification
+	require.NoError(t, xml.Unmarshal([]byte(raw), &notif))
+
+	change, err := notif.ConfigChange()
+	require.NoError(t, err)
+	assert.Equal(t, ChangedBy{Server: true}, change.ChangedBy)
+	assert.Equal(t, Candidate, change.Datastore)
+	assert.Equal(t, []ConfigChangeEdit{
+		{Target: "/if:interfaces/if:interface[if:name='eth0']", Operation: "merge"},
+		{Target: "/sys:system/sys:location", Operation: "delete"},
+	}, change.Edits)
+
+	var session Notification
+	require.NoError(t, xml.Unmarshal([]byte(notifConfigChange), &session))
+	change, err = session.ConfigChange()
+	require.NoError(t, err)
+	assert.Equal(t, ChangedBy{Username: "admin"}, change.ChangedBy)
+	assert.Equal(t, Running, change.Datastore)
+
+	var other Notification
+	require.NoError(t, xml.Unmarshal([]byte(notifLinkDown), &other))
+	_, err = other.ConfigChange()
+	assert.ErrorContains(t, err, "not netconf-config-change")
+}
+
+func TestNotificationMuxErrors(t *testing.T) {
+	errBad := errors.New("bad notification")
+
+	var got []error
+	mux := NewNotificationMux()
+	mux.Handle(xml.Name{Space: "urn:example:links", Local: "link-down"}, func([]byte) error {
+		return errBad
+	})
+	mux.HandleError(func(_ Notification, err error) { got = append(got, err) })
+
+	var notif Notification
+	require.NoError(t, xml.Unmarshal([]byte(notifLinkDown), &notif))
+	mux.Notify(notif)
+
+	// no event element
+	mux.Notify(Notification{Body: []byte(`<eventTime>2023-06-07T18:32:00Z</eventTime>`)})
+
+	require.Len(t, got, 2)
+	assert.ErrorIs(t, got[0], errBad)
+	assert.Error(t, got[1])
+}
+
+func TestNotificationMux(t *testing.T) {
+	type configChange struct {
+		Username  string `xml:"changed-by>username"`
+		Datastore string `xml:"datastore"`
+	}
+	type linkDown struct {
+		IfName string `xml:"if-name"`
+	}
+
+	changes := make(chan configChange, 1)
+	links := make(chan linkDown, 1)
+	unmatched := make(chan Notification, 1)
+
+	mux := NewNotificationMux()
+	HandleNotification(mux,
+		xml.Name{Space: "urn:ietf:params:xml:ns:yang:ietf-netconf-notifications", Local: "netconf-config-change"},
+		func(v configChange) error {
+			changes <- v
+			return nil
+		})
+	HandleNotification(mux,
+		xml.Name{Space: "urn:example:links", Local: "link-down"},
+		func(v linkDown) error {
+			links <- v
+			return nil
+		})
+	mux.HandleFallback(func(n Notification) { unmatched <- n })
+
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	sess := newSession(client, WithNotificationHandler(mux.Notify))
+	go sess.recv()
+
+	for _, msg := range []string{notifConfigChange, notifLinkDown, notifUnknown} {
+		w, err := server.MsgWriter()
+		require.NoError(t, err)
+		_, err = io.WriteString(w, msg)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	select {
+	case got := <-changes:
+		assert.Equal(t, configChange{Username: "admin", Datastore: "running"}, got)
+	case <-time.After(time.Second):
+		t.Fatal("config change notification not dispatched")
+	}
+
+	select {
+	case got := <-links:
+		assert.Equal(t, linkDown{IfName: "eth0"}, got)
+	case <-time.After(time.Second):
+		t.Fatal("link-down notification not dispatched")
+	}
+
+	select {
+	case got := <-unmatched:
+		name, _, err := got.Event()
+		assert.NoError(t, err)
+		assert.Equal(t, "something-else", name.Local)
+	case <-time.After(time.Second):
+		t.Fatal("unmatched notification not sent to fallback")
+	}
+}
+
+var seqRe = regexp.MustCompile(`<seq>(\d+)</seq>`)
+
+func writeSeqNotification(tr *pipeTransport, seq int) error {
+	w, err := tr.MsgWriter()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">`+
+		`<eventTime>2026-01-01T00:00:00Z</eventTime><tick xmlns="urn:example:ticks"><seq>%d</seq></tick></notification>`, seq)
+	return w.Close()
+}
+
+func TestNotificationBuffer(t *testing.T) {
+	tt := []struct {
+		name   string
+		size   int
+		policy NotificationPolicy
+		// rpcOK is if an rpc completes while the handler is stuck
+		rpcOK       bool
+		wantSeqs    []int
+		wantDropped uint64
+	}{
+		{
+			name:     "block",
+			size:     1,
+			policy:   NotificationBlock,
+			rpcOK:    false,
+			wantSeqs: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		},
+		{
+			name:        "drop oldest",
+			size:        2,
+			policy:      NotificationDropOldest,
+			rpcOK:       true,
+			wantSeqs:    []int{1, 9, 10},
+			wantDropped: 7,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			seqs := make(chan int, 16)
+			handler := func(msg Notification) {
+				m := seqRe.FindSubmatch(msg.Body)
+				if !assert.NotNil(t, m) {
+					return
+				}
+				seq, _ := strconv.Atoi(string(m[1]))
+				if seq == 1 {
+					close(started)
+					<-release
+				}
+				seqs <- seq
+			}
+
+			sess := newSession(client, WithNotificationHandler(handler), WithNotificationBuffer(tc.size, tc.policy))
+			go sess.recv()
+
+			// the device floods notifications while the handler is stuck on
+			// the first one and then replies to an rpc.
+			go func() {
+				if writeSeqNotification(server, 1) != nil {
+					return
+				}
+				<-started
+				for seq := 2; seq <= 10; seq++ {
+					if writeSeqNotification(server, seq) != nil {
+						return
+					}
+				}
+				serveOK(server)
+			}()
+
+			rpcErr := make(chan error, 1)
+			go func() {
+				_, err := sess.Do(context.Background(), "<get/>")
+				rpcErr <- err
+			}()
+
+			if tc.rpcOK {
+				select {
+				case err := <-rpcErr:
+					require.NoError(t, err)
+				case <-time.After(time.Second):
+					t.Fatal("rpc was held up by the notification handler")
+				}
+				close(release)
+			} else {
+				select {
+				case <-rpcErr:
+					t.Fatal("rpc completed while the notification buffer was full")
+				case <-time.After(100 * time.Millisecond):
+				}
+				close(release)
+				require.NoError(t, <-rpcErr)
+			}
+
+			var got []int
+			for range tc.wantSeqs {
+				got = append(got, <-seqs)
+			}
+			assert.Equal(t, tc.wantSeqs, got)
+			assert.Equal(t, tc.wantDropped, sess.Stats().NotificationsDropped)
+		})
+	}
+}
+
+func TestWaitForNotification(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	seqs := make(chan int, 16)
+	handler := func(msg Notification) {
+		m := seqRe.FindSubmatch(msg.Body)
+		if !assert.NotNil(t, m) {
+			return
+		}
+		seq, _ := strconv.Atoi(string(m[1]))
+		seqs <- seq
+	}
+
+	sess := newSession(client, WithNotificationHandler(handler))
+	go sess.recv()
+
+	isSeq := func(want string) func(Notification) bool {
+		return func(n Notification) bool {
+			m := seqRe.FindSubmatch(n.Body)
+			return m != nil && string(m[1]) == want
+		}
+	}
+
+	type result struct {
+		notif Notification
+		err   error
+	}
+	got := make(chan result, 1)
+	go func() {
+		n, err := sess.WaitForNotification(context.Background(), isSeq("3"))
+		got <- result{n, err}
+	}()
+	require.Eventually(t, sess.hasNotifWaiters, time.Second, time.Millisecond)
+
+	for seq := 1; seq <= 5; seq++ {
+		require.NoError(t, writeSeqNotification(server, seq))
+	}
+
+	res := <-got
+	require.NoError(t, res.err)
+	assert.True(t, isSeq("3")(res.notif))
+
+	// the handler still sees every notification
+	var handled []int
+	for i := 0; i < 5; i++ {
+		handled = append(handled, <-seqs)
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, handled)
+	assert.False(t, sess.hasNotifWaiters())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := sess.WaitForNotification(ctx, isSeq("99"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBatchedNotifications(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	got := make(chan Notification, 2)
+	sess := newSession(client, WithNotificationHandler(func(n Notification) { got <- n }))
+	go sess.recv()
+
+	w, err := server.MsgWriter()
+	require.NoError(t, err)
+	_, err = io.WriteString(w, notifConfigChange+"\n"+notifLinkDown)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	first, second := <-got, <-got
+	assert.Equal(t, time.Date(2023, 6, 7, 18, 31, 48, 0, time.UTC), first.EventTime)
+	assert.Contains(t, string(first.Body), "<netconf-config-change")
+	assert.Equal(t, time.Date(2023, 6, 7, 18, 32, 0, 0, time.UTC), second.EventTime)
+	assert.Contains(t, string(second.Body), "<link-down")
+
+	// the session is still usable afterwards
+	require.NoError(t, writeSeqNotification(server, 1))
+	assert.Contains(t, string((<-got).Body), "<seq>1</seq>")
+}
@@ -1,9 +1,16 @@
 package netconf
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 )
@@ -75,6 +82,41 @@ func (u URL) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	return e.EncodeElement(&v, start)
 }
 
+// checkURL verifies that if `v` is a [URL] its scheme is one advertised by the
+// device with the `:url` capability.  Any scheme is allowed when the capability
+// doesn't list them.  Any other value is ignored.
+func (s *Session) checkURL(v any) error {
+	u, ok := v.(URL)
+	if !ok {
+		return nil
+	}
+
+	schemes, ok := s.serverCapSet().URLSchemes()
+	if !ok {
+		return s.enforceCapability(fmt.Errorf("cannot use url %q: device does not support the :url capability", string(u)))
+	}
+
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", string(u), err)
+	}
+
+	// some devices advertise `:url` without listing the schemes so any
+	// scheme may work.
+	if len(schemes) == 0 {
+		return nil
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	for _, supported := range schemes {
+		if supported == scheme {
+			return nil
+		}
+	}
+	return s.enforceCapability(fmt.Errorf("url scheme %q is not supported by the device (supported schemes: %s)",
+		parsed.Scheme, strings.Join(schemes, ", ")))
+}
+
 const (
 	// Running configuration datastore. Required by RFC6241
 	Running Datastore = "running"
@@ -91,7 +133,7 @@ const (
 type GetConfigReq struct {
 	XMLName xml.Name  `xml:"get-config"`
 	Source  Datastore `xml:"source"`
-	// Filter
+	Filter  *Filter   `xml:"filter,omitempty"`
 }
 
 type GetConfigReply struct {
@@ -99,6 +141,22 @@ type GetConfigReply struct {
 	Config  []byte   `xml:",innerxml"`
 }
 
+// UnmarshalXML implements xml.Unmarshaler.  The namespace prefixes in scope
+// for `<data>` are re-declared on each top-level config element so the
+// returned config keeps its meaning when sent back to the device (i.e prefixed
+// instance-identifier values).
+func (r *GetConfigReply) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type getConfigReply GetConfigReply
+	var inner getConfigReply
+	if err := d.DecodeElement(&inner, &start); err != nil {
+		return err
+	}
+
+	*r = GetConfigReply(inner)
+	r.Config = injectNamespaces(r.Config, prefixDecls(start.Attr))
+	return nil
+}
+
 // GetConfig implements the <get-config> rpc operation defined in [RFC6241 7.1].
 // `source` is the datastore to query.
 //
@@ -116,6 +174,108 @@ func (s *Session) GetConfig(ctx context.Context, source Datastore) ([]byte, erro
 	return resp.Config, nil
 }
 
+// GetConfigModel is like [Session.GetConfig] but only fetches the config under
+// the top-level element `root` of the model with namespace `ns` (see
+// [ModelFilter]).
+func (s *Session) GetConfigModel(ctx context.Context, source Datastore, ns, root string) ([]byte, error) {
+	req := GetConfigReq{
+		Source: source,
+		Filter: ModelFilter(ns, root),
+	}
+
+	var resp GetConfigReply
+	if err := s.Call(ctx, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Config, nil
+}
+
+// GetConfigInto is like [Session.GetConfig] but decodes the config into `v`
+// with [DecodeData] (using `opts`) so `v` only has to model the config itself
+// and not the `<rpc-reply>` and `<data>` around it.  `filter` is optional.
+func (s *Session) GetConfigInto(ctx context.Context, source Datastore, filter *Filter, v any, opts ...DecodeOption) error {
+	req := GetConfigReq{
+		Source: source,
+		Filter: filter,
+	}
+
+	var resp GetConfigReply
+	if err := s.Call(ctx, &req, &resp); err != nil {
+		return err
+	}
+
+	return DecodeData(resp.Config, v, opts...)
+}
+
+// DecodeOption is an optional argument to [DecodeData] and
+// [Session.GetConfigInto].
+type DecodeOption interface {
+	apply(*decodeConfig)
+}
+
+type decodeConfig struct {
+	lenientNamespaces bool
+}
+
+type lenientNamespacesOpt struct{}
+
+func (o lenientNamespacesOpt) apply(cfg *decodeConfig) { cfg.lenientNamespaces = true }
+
+// WithLenientNamespaces matches the elements of the config to the fields of
+// `v` by their local name only.  By default encoding/xml requires an element
+// to be in the namespace given in the struct tag (or XMLName) which silently
+// drops elements when the namespace the device uses differs from what the
+// struct assumes, i.e an augment in another module's namespace or a model
+// that moved namespace between revisions.  Elements that don't match a field
+// are still decoded the same as before (i.e with `,any` or `,innerxml`).
+//
+// As namespaces are ignored, elements with the same local name in different
+// namespaces can no longer be told apart.
+func WithLenientNamespaces() DecodeOption { return lenientNamespacesOpt{} }
+
+// DecodeData decodes `v` from one of the top-level elements of the contents
+// of `<data>` (i.e as returned by [Session.GetConfig] or [Session.Get]).  When
+// `v` is a struct with an XMLName the first element with that name is used
+// (the namespace is only compared if the XMLName has one and
+// [WithLenientNamespaces] isn't used) otherwise the first element is.  `v` is
+// left as is when there is no such element as that is how a device returns an
+// empty part of the config.
+func DecodeData(data []byte, v any, opts ...DecodeOption) error {
+	var cfg decodeConfig
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+
+	want, named := xmlNameOf(v)
+	if cfg.lenientNamespaces {
+		want.Space = ""
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		start, err := startElement(d)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if named && (start.Name.Local != want.Local || (want.Space != "" && start.Name.Space != want.Space)) {
+			if err := d.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if cfg.lenientNamespaces {
+			return xml.NewTokenDecoder(newNamespaceFixer(d, start, v)).Decode(v)
+		}
+		return d.DecodeElement(v, start)
+	}
+}
+
 // MergeStrategy defines the strategies for merging configuration in a
 // `<edit-config> operation`.
 //
@@ -160,6 +320,111 @@ const (
 	RemoveConfig MergeStrategy = "remove"
 )
 
+// OperationElem wraps a value inside of an `<edit-config>` `<config>` subtree
+// so that the element it is marshaled as has the `operation` attribute set to
+// the given strategy.  This is used to replace, create, delete, or remove
+// specific subtrees and composes with the default set with
+// [WithDefaultMergeStrategy] (i.e using [NoMergeStrategy] as the default and
+// only touching the annotated elements).
+//
+// Value may be a struct (or anything able to be marshaled) or a string or
+// []byte of raw xml which is used as the contents of the element.  When Value
+// is a struct with an `XMLName` field that name (and namespace) is used for
+// the element, otherwise the element is named by the field holding the
+// wrapper.  An OperationElem can also be passed directly as the config to
+// [Session.EditConfig] as long as the value has an `XMLName`.
+//
+//	type Interfaces struct {
+//		XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces"`
+//		Interface any      `xml:"interface"`
+//	}
+//
+//	cfg := Interfaces{
+//		Interface: netconf.OperationElem{
+//			Operation: netconf.DeleteConfig,
+//			Value:     "<name>eth0</name>",
+//		},
+//	}
+//
+// The attribute is always qualified with the base namespace (as
+// `xc:operation`) regardless of the namespace of the element it is on.
+type OperationElem struct {
+	Operation MergeStrategy
+	Value     any
+}
+
+// MarshalXML implements xml.Marshaler.
+func (o OperationElem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	switch o.Operation {
+	case MergeConfig, ReplaceConfig, CreateConfig, DeleteConfig, RemoveConfig:
+	default:
+		return fmt.Errorf("invalid operation attribute %q", o.Operation)
+	}
+
+	// a value with it's own XMLName is the element being annotated and not
+	// the element the wrapper happens to be marshaled as.
+	if name, ok := xmlNameOf(o.Value); ok {
+		start.Name = name
+	}
+
+	// encoding/xml would generate it's own prefix for a namespaced attribute
+	// so the prefix and declaration are written out by hand.  Copy the
+	// attributes so the caller's slice is never modified.
+	attrs := make([]xml.Attr, 0, len(start.Attr)+2)
+	attrs = append(attrs, start.Attr...)
+	start.Attr = append(attrs,
+		xml.Attr{Name: xml.Name{Local: "xmlns:xc"}, Value: baseNamespace},
+		xml.Attr{Name: xml.Name{Local: "xc:operation"}, Value: string(o.Operation)},
+	)
+
+	var v any
+	switch val := o.Value.(type) {
+	case nil:
+		v = struct{}{}
+	case string:
+		v = struct {
+			Inner string `xml:",innerxml"`
+		}{Inner: val}
+	case []byte:
+		v = struct {
+			Inner []byte `xml:",innerxml"`
+		}{Inner: val}
+	default:
+		v = val
+	}
+	return e.EncodeElement(v, start)
+}
+
+// xmlNameOf returns the element name defined by the `XMLName` field of a struct
+// (or pointer to a struct), preferring the field's tag over it's value.
+func xmlNameOf(v any) (xml.Name, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return xml.Name{}, false
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return xml.Name{}, false
+	}
+
+	field, ok := rv.Type().FieldByName("XMLName")
+	if !ok || field.Type != reflect.TypeOf(xml.Name{}) {
+		return xml.Name{}, false
+	}
+
+	if tag, _, _ := strings.Cut(field.Tag.Get("xml"), ","); tag != "" {
+		if space, local, ok := strings.Cut(tag, " "); ok {
+			return xml.Name{Space: space, Local: local}, true
+		}
+		return xml.Name{Local: tag}, true
+	}
+
+	name := rv.FieldByIndex(field.Index).Interface().(xml.Name)
+	return name, name.Local != ""
+}
+
 // TestStrategy defines the beahvior for testing configuration before applying it in a `<edit-config>` operation.
 //
 // *Note*: in RFC6241 7.2 this is called the `test-option` parameter. Since the `option` term is already
@@ -196,7 +461,8 @@ const (
 
 	// RollbackOnError will restore the configuration back to before the
 	// `<edit-config>` operation took place.  This requires the device to
-	// support the `:rollback-on-error` capabilitiy.
+	// support the `:rollback-on-error` capability which is checked by
+	// [Session.EditConfig] before the request is sent.
 	RollbackOnError ErrorStrategy = "rollback-on-error"
 )
 
@@ -248,6 +514,135 @@ type EditConfigOption interface {
 //
 // [RFC6241 7.2]: https://www.rfc-editor.org/rfc/rfc6241.html#section-7.2
 func (s *Session) EditConfig(ctx context.Context, target Datastore, config any, opts ...EditConfigOption) error {
+	req, err := s.checkedEditConfigReq(target, config, opts...)
+	if err != nil {
+		return err
+	}
+
+	var resp OKResp
+	return s.Call(ctx, req, &resp)
+}
+
+// EditConfigProgress is like [Session.EditConfig] but calls `onError` for each
+// `<rpc-error>` (including warnings) as soon as it is decoded from the reply
+// instead of only returning them once the whole reply has been received.  This
+// is meant for reporting progress on very large edits with the
+// [ContinueOnError] strategy where the device can send back a lot of errors.
+// The returned error is the same as from [Session.EditConfig].
+//
+// `onError` is called from the session's receive loop so it must return quickly
+// and must not issue rpcs on the session.
+func (s *Session) EditConfigProgress(ctx context.Context, target Datastore, config any, onError func(RPCError), opts ...EditConfigOption) error {
+	req, err := s.checkedEditConfigReq(target, config, opts...)
+	if err != nil {
+		return err
+	}
+
+	msg := &request{
+		MessageID: s.seq.Add(1),
+		Operation: req,
+		onError:   onError,
+	}
+	reply, err := s.doMsg(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return reply.Err()
+}
+
+// checkedEditConfigReq builds the `<edit-config>` checking it against the
+// capabilities of the device.
+func (s *Session) checkedEditConfigReq(target Datastore, config any, opts ...EditConfigOption) (*EditConfigReq, error) {
+	req, err := newEditConfigReq(target, config, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.validateTargets {
+		if err := s.checkWritable(target); err != nil {
+			if err := s.enforceCapability(fmt.Errorf("cannot edit-config %s: %w", target, err)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// devices without the capability treat this as stop-on-error and may
+	// leave a partially applied config behind.
+	if req.ErrorStrategy == RollbackOnError && !s.serverCapSet().Has(rollbackOnErrorCap) {
+		err := fmt.Errorf("cannot use error-option %s: device does not support the :rollback-on-error capability", RollbackOnError)
+		if err := s.enforceCapability(err); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// checkWritable reports a [*MissingCapabilitiesError] if the device does not
+// advertise the capability needed to write to the datastore.  Other datastores
+// are not checked.
+func (s *Session) checkWritable(target Datastore) error {
+	switch target {
+	case Running:
+		return s.RequireCapabilities(":writable-running:1.0")
+	case Candidate:
+		return s.RequireCapabilities(":candidate:1.0")
+	}
+	return nil
+}
+
+// Leaves returns the config for setting a few leaves of a container without
+// having to build a struct or XML for it.  `path` is the `/` separated path of
+// the container from the top-level element (i.e `system/ntp`) and `ns` is the
+// namespace declared on the top-level element.  Each entry of `leaves` is
+// written as a leaf of the container with the value formatted with
+// [fmt.Sprint].  Leaves are written sorted by name so the output is stable.
+//
+// This is only meant for simple cases: lists (which need their keys),
+// choices and leaves in other namespaces are not supported.
+//
+//	netconf.Leaves("urn:example:system", "system/ntp",
+//		map[string]any{"enabled": true, "server": "192.0.2.1"})
+func Leaves(ns, path string, leaves map[string]any) string {
+	var b strings.Builder
+
+	elems := strings.Split(path, "/")
+	for i, elem := range elems {
+		b.WriteString("<" + elem)
+		if i == 0 {
+			b.WriteString(` xmlns="`)
+			_ = xml.EscapeText(&b, []byte(ns))
+			b.WriteString(`"`)
+		}
+		b.WriteString(">")
+	}
+
+	names := make([]string, 0, len(leaves))
+	for name := range leaves {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString("<" + name + ">")
+		// writes to a strings.Builder can't fail
+		_ = xml.EscapeText(&b, []byte(fmt.Sprint(leaves[name])))
+		b.WriteString("</" + name + ">")
+	}
+
+	for i := len(elems) - 1; i >= 0; i-- {
+		b.WriteString("</" + elems[i] + ">")
+	}
+	return b.String()
+}
+
+// SetLeaves is [Session.EditConfig] with the config from [Leaves].  The
+// default operation is `merge` unless changed with [WithDefaultMergeStrategy]
+// so the other leaves of the container are left alone.
+func (s *Session) SetLeaves(ctx context.Context, target Datastore, ns, path string, leaves map[string]any, opts ...EditConfigOption) error {
+	opts = append([]EditConfigOption{WithDefaultMergeStrategy(MergeConfig)}, opts...)
+	return s.EditConfig(ctx, target, Leaves(ns, path, leaves), opts...)
+}
+
+func newEditConfigReq(target Datastore, config any, opts ...EditConfigOption) (*EditConfigReq, error) {
 	req := EditConfigReq{
 		Target: target,
 	}
@@ -264,6 +659,14 @@ func (s *Session) EditConfig(ctx context.Context, target Datastore, config any,
 		}{Inner: v}
 	case URL:
 		req.URL = string(v)
+	case OperationElem:
+		// the element is a child of `<config>` and not `<config>` itself.
+		if _, ok := xmlNameOf(v.Value); !ok {
+			return nil, fmt.Errorf("operation element used as config must have an XMLName")
+		}
+		req.Config = struct {
+			Elem OperationElem
+		}{Elem: v}
 	default:
 		req.Config = config
 	}
@@ -272,8 +675,7 @@ func (s *Session) EditConfig(ctx context.Context, target Datastore, config any,
 		opt.apply(&req)
 	}
 
-	var resp OKResp
-	return s.Call(ctx, &req, &resp)
+	return &req, nil
 }
 
 type CopyConfigReq struct {
@@ -288,10 +690,17 @@ type CopyConfigReq struct {
 // A `<config>` element defining a full config can be used as the source.
 //
 // If a device supports the `:url` capability than a [URL] object can be used
-// for the source or target datastore.
+// for the source or target datastore.  The scheme of the url must be one of the
+// schemes advertised by the device.
 //
 // [RFC6241 7.3] https://www.rfc-editor.org/rfc/rfc6241.html#section-7.3
 func (s *Session) CopyConfig(ctx context.Context, source, target any) error {
+	for _, v := range []any{source, target} {
+		if err := s.checkURL(v); err != nil {
+			return err
+		}
+	}
+
 	req := CopyConfigReq{
 		Source: source,
 		Target: target,
@@ -302,11 +711,23 @@ func (s *Session) CopyConfig(ctx context.Context, source, target any) error {
 }
 
 type DeleteConfigReq struct {
-	XMLName xml.Name  `xml:"delete-config"`
-	Target  Datastore `xml:"target"`
+	XMLName xml.Name `xml:"delete-config"`
+	Target  any      `xml:"target"`
 }
 
-func (s *Session) DeleteConfig(ctx context.Context, target Datastore) error {
+// DeleteConfig issues the `<delete-config>` operation as defined in [RFC6241
+// 7.4] for deleting a configuration datastore.
+//
+// If a device supports the `:url` capability than a [URL] object can be used
+// as the target.  The scheme of the url must be one of the schemes advertised
+// by the device.
+//
+// [RFC6241 7.4] https://www.rfc-editor.org/rfc/rfc6241.html#section-7.4
+func (s *Session) DeleteConfig(ctx context.Context, target any) error {
+	if err := s.checkURL(target); err != nil {
+		return err
+	}
+
 	req := DeleteConfigReq{
 		Target: target,
 	}
@@ -320,6 +741,16 @@ type LockReq struct {
 	Target  Datastore `xml:"target"`
 }
 
+// MarshalXML implements xml.Marshaler.  The start element is rebuilt from the
+// local name only so the encoder doesn't emit an empty `xmlns=""` and the
+// element stays in the base namespace inherited from the enclosing `<rpc>`.
+func (req LockReq) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	inner := struct {
+		Target Datastore `xml:"target"`
+	}{Target: req.Target}
+	return e.EncodeElement(&inner, xml.StartElement{Name: xml.Name{Local: req.XMLName.Local}})
+}
+
 func (s *Session) Lock(ctx context.Context, target Datastore) error {
 	req := LockReq{
 		XMLName: xml.Name{Local: "lock"},
@@ -340,11 +771,159 @@ func (s *Session) Unlock(ctx context.Context, target Datastore) error {
 	return s.Call(ctx, &req, &resp)
 }
 
-/*
-func (s *Session) Get(ctx context.Context,  filter Filter) error {
-	panic("unimplemented")
+// Filter is the `<filter>` element used to select a subset of the data
+// returned by [Session.Get].
+//
+// The size of a filter isn't limited: the message is streamed through the
+// framing of the transport without any fixed-size buffer.  Neither framing
+// has a size limit in the protocol however some devices can't handle very
+// large messages.  With Chunked framing (`:base:1.1`) the size of each chunk
+// can be limited with `WithMaxChunkSize` from the transport package.  With
+// End-of-Message framing (`:base:1.0`) the only way is to split the filter
+// over several rpcs (see [Session.GetConfigSubtrees]).
+type Filter struct {
+	Type string `xml:"type,attr"`
+	// Select is the expression of an `xpath` filter (see [XPathFilter]).
+	Select string `xml:"select,attr,omitempty"`
+	// NamespaceDecls are the `xmlns:<prefix>` attributes declaring the
+	// prefixes used in Select.
+	NamespaceDecls []xml.Attr `xml:",any,attr"`
+	Content        []byte     `xml:",innerxml"`
+}
+
+// SubtreeFilter returns a subtree [Filter] as defined in [RFC6241 6].  Each of
+// the `subtrees` is a XML fragment with one or more top-level elements and they
+// are combined as siblings under a single `<filter>` so that unrelated parts of
+// the data (i.e `/interfaces` and `/system`) can be fetched in one round trip.
+//
+// [RFC6241 6]: https://www.rfc-editor.org/rfc/rfc6241.html#section-6
+func SubtreeFilter(subtrees ...string) *Filter {
+	return &Filter{
+		Type:    "subtree",
+		Content: []byte(strings.Join(subtrees, "")),
+	}
+}
+
+// ModelFilter returns a subtree [Filter] with just the empty top-level element
+// `root` in namespace `ns` selecting everything under it (i.e the whole
+// `interfaces` container of `http://openconfig.net/yang/interfaces`).
+func ModelFilter(ns, root string) *Filter {
+	var b strings.Builder
+	b.WriteString("<" + root + ` xmlns="`)
+	// writes to a strings.Builder can't fail
+	_ = xml.EscapeText(&b, []byte(ns))
+	b.WriteString(`"/>`)
+	return SubtreeFilter(b.String())
+}
+
+// ListEntry returns a subtree filter fragment (see [SubtreeFilter]) selecting
+// the single entry of a list whose key leaf `key` is `value`.  `list` is the
+// `/` separated path of the list from the top-level container (i.e
+// `interfaces/interface`) and `ns` is the namespace of the module defining it
+// which is declared on the top-level element.
+//
+// The key is sent as a content match node.  `fields` are the nodes of the
+// entry to return, also as `/` separated paths (i.e `mtu` or
+// `state/oper-status`), and are sent as selection nodes.  Without any fields
+// the whole entry is returned.  The key leaf is always returned.
+//
+//	netconf.SubtreeFilter(netconf.ListEntry(
+//		"urn:ietf:params:xml:ns:yang:ietf-interfaces",
+//		"interfaces/interface", "name", "eth0", "mtu", "enabled"))
+func ListEntry(ns, list, key, value string, fields ...string) string {
+	var b strings.Builder
+
+	path := strings.Split(list, "/")
+	for i, elem := range path {
+		b.WriteString("<" + elem)
+		if i == 0 {
+			b.WriteString(` xmlns="`)
+			_ = xml.EscapeText(&b, []byte(ns))
+			b.WriteString(`"`)
+		}
+		b.WriteString(">")
+	}
+
+	b.WriteString("<" + key + ">")
+	// writes to a strings.Builder can't fail
+	_ = xml.EscapeText(&b, []byte(value))
+	b.WriteString("</" + key + ">")
+
+	for _, field := range fields {
+		parts := strings.Split(field, "/")
+		for _, part := range parts[:len(parts)-1] {
+			b.WriteString("<" + part + ">")
+		}
+		b.WriteString("<" + parts[len(parts)-1] + "/>")
+		for i := len(parts) - 2; i >= 0; i-- {
+			b.WriteString("</" + parts[i] + ">")
+		}
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		b.WriteString("</" + path[i] + ">")
+	}
+	return b.String()
+}
+
+type GetReq struct {
+	XMLName xml.Name `xml:"get"`
+	Filter  *Filter  `xml:"filter,omitempty"`
+}
+
+// Get implements the `<get>` rpc operation defined in [RFC6241 7.7] returning
+// both the running config and state data selected by `filter`.  A nil filter
+// returns everything.
+//
+// With [WithGetConfigFallback] a `<get>` rejected with `access-denied` is
+// retried as a `<get-config>` of the running datastore with the same filter.
+//
+// [RFC6241 7.7]: https://www.rfc-editor.org/rfc/rfc6241.html#section-7.7
+func (s *Session) Get(ctx context.Context, filter *Filter) ([]byte, error) {
+	req := GetReq{
+		Filter: filter,
+	}
+
+	var resp GetConfigReply
+	if err := s.Call(ctx, &req, &resp); err != nil {
+		if !s.getConfigFallback || !accessDenied(err) {
+			return nil, err
+		}
+		log.Printf("netconf: get was denied, falling back to get-config of running: %v", err)
+		fallback := GetConfigReq{
+			Source: Running,
+			Filter: filter,
+		}
+		if err := s.Call(ctx, &fallback, &resp); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp.Config, nil
+}
+
+func accessDenied(err error) bool {
+	for _, rpcErr := range rpcErrorsOf(err) {
+		if rpcErr.Tag == ErrAccesDenied {
+			return true
+		}
+	}
+	return false
+}
+
+// Ping issues a `<get>` with an empty subtree filter, which selects nothing, to
+// check that the device is still responding.  This is a lightweight liveness
+// probe of the session (i.e for pool health checks) and not an assessment of
+// the health of the device.
+func (s *Session) Ping(ctx context.Context) error {
+	// the reply isn't decoded as devices differ on replying with an empty
+	// `<data/>` or nothing at all.
+	reply, err := s.Do(ctx, &GetReq{Filter: SubtreeFilter()})
+	if err != nil {
+		return err
+	}
+	return reply.Err()
 }
-*/
 
 type KillSessionReq struct {
 	XMLName   xml.Name `xml:"kill-session"`
@@ -365,7 +944,29 @@ type ValidateReq struct {
 	Source  any      `xml:"source"`
 }
 
+// Validate issues the `<validate>` operation as defined in [RFC6241 8.6.4.1]
+// for validating the contents of a datastore or a `<config>` element.
+//
+// If a device supports the `:url` capability than a [URL] object can be used
+// as the source (i.e to validate a config file staged on the device before
+// copying it in).  The device must advertise both `:validate` and `:url` and
+// the scheme of the url must be one of the schemes advertised by the device.
+//
+// [RFC6241 8.6.4.1] https://www.rfc-editor.org/rfc/rfc6241.html#section-8.6.4.1
 func (s *Session) Validate(ctx context.Context, source any) error {
+	if err := s.checkURL(source); err != nil {
+		return err
+	}
+	if u, ok := source.(URL); ok {
+		caps := s.serverCapSet()
+		if !caps.advertises(validateCap11) && !caps.advertises(validateCap10) {
+			err := fmt.Errorf("cannot validate url %q: device does not support the :validate capability", string(u))
+			if err := s.enforceCapability(err); err != nil {
+				return err
+			}
+		}
+	}
+
 	req := ValidateReq{
 		Source: source,
 	}
@@ -432,20 +1033,80 @@ func WithPersist(id string) CommitOption { return persist(id) }
 // sesssion.
 func WithPersistID(id string) persistID { return persistID(id) }
 
+// ErrNoPendingCommit is matched (with errors.Is) by the error from
+// [Session.Commit] with [WithPersistID] or [Session.CancelCommit] when the
+// device rejected it because there is no pending confirmed commit to confirm
+// or cancel (or none with a matching persist-id).  The [RPCError] from the
+// device is still available with errors.As.
+var ErrNoPendingCommit = errors.New("netconf: no matching confirmed commit is pending")
+
+// ErrCommitInUse is matched (with errors.Is) by the error from
+// [Session.Commit] when the device rejected it with `in-use` or `lock-denied`,
+// typically because another session has a pending confirmed commit or holds a
+// lock on the datastores.  The [RPCError] from the device is still available
+// with errors.As.
+var ErrCommitInUse = errors.New("netconf: commit rejected as the datastore is in use by another session")
+
+// rpcErrorsOf returns the rpc errors from the device wrapped in err if any.
+func rpcErrorsOf(err error) []RPCError {
+	var multi RPCErrors
+	var single RPCError
+	switch {
+	case errors.As(err, &multi):
+		return multi
+	case errors.As(err, &single):
+		return []RPCError{single}
+	}
+	return nil
+}
+
+// commitError wraps err with one of the confirmed-commit errors based on the
+// error tags from the device.  `confirming` is set when the rpc refers to
+// a pending confirmed commit (`<persist-id>` or `<cancel-commit>`) as RFC6241
+// 8.4 has devices answer `invalid-value` when there is none to match.  `cancel`
+// is set for `<cancel-commit>` which devices also fail with `operation-failed`
+// when nothing is pending.
+func commitError(err error, confirming, cancel bool) error {
+	for _, rpcErr := range rpcErrorsOf(err) {
+		switch {
+		case confirming && rpcErr.Tag == ErrInvalidValue,
+			cancel && rpcErr.Tag == ErrOperationFailed:
+			return fmt.Errorf("%w: %w", ErrNoPendingCommit, err)
+		case !cancel && (rpcErr.Tag == ErrInUse || rpcErr.Tag == ErrLockDenied):
+			return fmt.Errorf("%w: %w", ErrCommitInUse, err)
+		}
+	}
+	return err
+}
+
 // Commit will commit a canidate config to the running comming. This requires
 // the device to support the `:canidate` capability.
+//
+// Errors around confirmed commits are wrapped with [ErrNoPendingCommit] or
+// [ErrCommitInUse].
 func (s *Session) Commit(ctx context.Context, opts ...CommitOption) error {
+	req, err := newCommitReq(opts...)
+	if err != nil {
+		return err
+	}
+
+	var resp OKResp
+	if err := s.Call(ctx, req, &resp); err != nil {
+		return commitError(err, req.PersistID != "", false)
+	}
+	return nil
+}
+
+func newCommitReq(opts ...CommitOption) (*CommitReq, error) {
 	var req CommitReq
 	for _, opt := range opts {
 		opt.apply(&req)
 	}
 
 	if req.PersistID != "" && req.Confirmed {
-		return fmt.Errorf("PersistID cannot be used with Confirmed/ConfirmedTimeout or Persist options")
+		return nil, fmt.Errorf("PersistID cannot be used with Confirmed/ConfirmedTimeout or Persist options")
 	}
-
-	var resp OKResp
-	return s.Call(ctx, &req, &resp)
+	return &req, nil
 }
 
 // CancelCommitOption is a optional arguments to [Session.CancelCommit] method
@@ -460,14 +1121,23 @@ type CancelCommitReq struct {
 	PersistID string   `xml:"persist-id,omitempty"`
 }
 
+// CancelCommit cancels a pending confirmed commit reverting running to before
+// it.  An error wrapping [ErrNoPendingCommit] is returned when there is no
+// pending confirmed commit (or none matching [WithPersistID]).
 func (s *Session) CancelCommit(ctx context.Context, opts ...CancelCommitOption) error {
+	var resp OKResp
+	if err := s.Call(ctx, newCancelCommitReq(opts...), &resp); err != nil {
+		return commitError(err, true, true)
+	}
+	return nil
+}
+
+func newCancelCommitReq(opts ...CancelCommitOption) *CancelCommitReq {
 	var req CancelCommitReq
 	for _, opt := range opts {
 		opt.applyCancelCommit(&req)
 	}
-
-	var resp OKResp
-	return s.Call(ctx, &req, &resp)
+	return &req
 }
 
 // CreateSubscriptionOption is a optional arguments to [Session.CreateSubscription] method
@@ -476,21 +1146,24 @@ type CreateSubscriptionOption interface {
 }
 
 type CreateSubscriptionReq struct {
-	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:netconf:notification:1.0 create-subscription"`
-	Stream  string   `xml:"stream,omitempty"`
-	// TODO: Implement filter
-	//Filter    int64    `xml:"filter,omitempty"`
-	StartTime string `xml:"startTime,omitempty"`
-	EndTime   string `xml:"endTime,omitempty"`
+	XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:netconf:notification:1.0 create-subscription"`
+	Stream    string   `xml:"stream,omitempty"`
+	Filter    *Filter  `xml:"filter,omitempty"`
+	StartTime string   `xml:"startTime,omitempty"`
+	EndTime   string   `xml:"endTime,omitempty"`
 }
 
 type stream string
 type startTime time.Time
 type endTime time.Time
+type subscriptionFilter struct{ filter *Filter }
 
 func (o stream) apply(req *CreateSubscriptionReq) {
 	req.Stream = string(o)
 }
+func (o subscriptionFilter) apply(req *CreateSubscriptionReq) {
+	req.Filter = o.filter
+}
 func (o startTime) apply(req *CreateSubscriptionReq) {
 	req.StartTime = time.Time(o).Format(time.RFC3339)
 }
@@ -502,13 +1175,42 @@ func WithStreamOption(s string) CreateSubscriptionOption        { return stream(
 func WithStartTimeOption(st time.Time) CreateSubscriptionOption { return startTime(st) }
 func WithEndTimeOption(et time.Time) CreateSubscriptionOption   { return endTime(et) }
 
+// WithFilterOption sets the `<filter>` of the subscription so that only the
+// matching notifications are sent (i.e a [SubtreeFilter] of the event
+// element).
+func WithFilterOption(f *Filter) CreateSubscriptionOption { return subscriptionFilter{f} }
+
+// CreateSubscription issues the `<create-subscription>` operation as defined
+// in [RFC5277 2.1.1].  This requires the device to support the
+// `:notification` capability and, for a subscription with an [XPathFilter],
+// the `:xpath` capability.  A [*MissingCapabilitiesError] is returned without
+// sending anything otherwise.
+//
+// [RFC5277 2.1.1]: https://www.rfc-editor.org/rfc/rfc5277.html#section-2.1.1
 func (s *Session) CreateSubscription(ctx context.Context, opts ...CreateSubscriptionOption) error {
+	req := newCreateSubscriptionReq(opts...)
+	if err := s.enforceCapability(s.checkSubscription(req)); err != nil {
+		return err
+	}
+
+	var resp OKResp
+	return s.Call(ctx, req, &resp)
+}
+
+// checkSubscription reports a [*MissingCapabilitiesError] if the device does
+// not advertise the capabilities needed for the subscription.
+func (s *Session) checkSubscription(req *CreateSubscriptionReq) error {
+	required := []string{":notification:1.0"}
+	if req.Filter != nil && req.Filter.Type == "xpath" {
+		required = append(required, ":xpath:1.0")
+	}
+	return s.RequireCapabilities(required...)
+}
+
+func newCreateSubscriptionReq(opts ...CreateSubscriptionOption) *CreateSubscriptionReq {
 	var req CreateSubscriptionReq
 	for _, opt := range opts {
 		opt.apply(&req)
 	}
-	// TODO: eventual custom notifications rpc logic, e.g. create subscription only if notification capability is present
-
-	var resp OKResp
-	return s.Call(ctx, &req, &resp)
+	return &req
 }
@@ -3,12 +3,17 @@ package netconf
 import (
 	"context"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/dau71/netconf/transport"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUnmarshalOk(t *testing.T) {
@@ -82,6 +87,416 @@ func TestGetConfig(t *testing.T) {
 	assert.Equal(t, want, got)
 }
 
+func TestGetSubtreeFilter(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>` +
+		`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/><system xmlns="urn:ietf:params:xml:ns:yang:ietf-system"/>` +
+		`</data></rpc-reply>`)
+
+	filter := SubtreeFilter(
+		`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/>`,
+		`<system xmlns="urn:ietf:params:xml:ns:yang:ietf-system"/>`,
+	)
+	data, err := sess.Get(context.Background(), filter)
+	require.NoError(t, err)
+
+	sentMsg, err := ts.popReqString()
+	require.NoError(t, err)
+	assert.Contains(t, sentMsg, `<get><filter type="subtree">`+
+		`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/>`+
+		`<system xmlns="urn:ietf:params:xml:ns:yang:ietf-system"/>`+
+		`</filter></get>`)
+
+	elems, err := SplitElements(data)
+	require.NoError(t, err)
+	require.Len(t, elems, 2)
+	assert.Equal(t, "interfaces", elems[0].Name.Local)
+	assert.Equal(t, "system", elems[1].Name.Local)
+}
+
+func TestGetConfigFallback(t *testing.T) {
+	rpcError := func(tag ErrTag) string {
+		return `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><rpc-error>` +
+			`<error-type>protocol</error-type><error-tag>` + string(tag) + `</error-tag>` +
+			`<error-severity>error</error-severity></rpc-error></rpc-reply>`
+	}
+	config := `<system xmlns="urn:example:system"><hostname>r1</hostname></system>`
+	configReply := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="2"><data>` + config + `</data></rpc-reply>`
+
+	tt := []struct {
+		name         string
+		opts         []SessionOption
+		reply        string
+		wantFallback bool
+		wantTag      ErrTag
+	}{
+		{"access denied", []SessionOption{WithGetConfigFallback()}, rpcError(ErrAccesDenied), true, ""},
+		{"other error", []SessionOption{WithGetConfigFallback()}, rpcError(ErrOperationFailed), false, ErrOperationFailed},
+		{"not enabled", nil, rpcError(ErrAccesDenied), false, ErrAccesDenied},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport(), tc.opts...)
+			go sess.recv()
+
+			type result struct {
+				data []byte
+				err  error
+			}
+			res := make(chan result, 1)
+			ts.queueRespString(tc.reply)
+			go func() {
+				data, err := sess.Get(context.Background(), SubtreeFilter(`<system xmlns="urn:example:system"/>`))
+				res <- result{data, err}
+			}()
+
+			sent, err := ts.popReqString()
+			require.NoError(t, err)
+			assert.Contains(t, sent, `<get><filter type="subtree">`)
+
+			if !tc.wantFallback {
+				got := <-res
+				var rpcErr RPCError
+				require.ErrorAs(t, got.err, &rpcErr)
+				assert.Equal(t, tc.wantTag, rpcErr.Tag)
+				return
+			}
+
+			// only queued now so it can't be sent as the reply to the get
+			sent, err = ts.popReqString()
+			require.NoError(t, err)
+			assert.Contains(t, sent, `<get-config><source><running/></source>`+
+				`<filter type="subtree"><system xmlns="urn:example:system"/></filter></get-config>`)
+			ts.queueRespString(configReply)
+
+			got := <-res
+			require.NoError(t, got.err)
+			assert.Equal(t, config, string(got.data))
+		})
+	}
+}
+
+func TestListEntry(t *testing.T) {
+	const ifNS = "urn:ietf:params:xml:ns:yang:ietf-interfaces"
+
+	tt := []struct {
+		name   string
+		list   string
+		value  string
+		fields []string
+		want   string
+	}{
+		{
+			name:  "whole entry",
+			list:  "interfaces/interface",
+			value: "eth0",
+			want:  `<interfaces xmlns="` + ifNS + `"><interface><name>eth0</name></interface></interfaces>`,
+		},
+		{
+			name:   "fields",
+			list:   "interfaces/interface",
+			value:  "eth0",
+			fields: []string{"mtu", "state/oper-status"},
+			want: `<interfaces xmlns="` + ifNS + `"><interface><name>eth0</name>` +
+				`<mtu/><state><oper-status/></state></interface></interfaces>`,
+		},
+		{
+			name:  "escaped value",
+			list:  "interfaces/interface",
+			value: "a<b&c",
+			want:  `<interfaces xmlns="` + ifNS + `"><interface><name>a&lt;b&amp;c</name></interface></interfaces>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ListEntry(ifNS, tc.list, "name", tc.value, tc.fields...))
+		})
+	}
+}
+
+func TestGetListEntry(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>` +
+		`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name><mtu>1500</mtu></interface></interfaces>` +
+		`</data></rpc-reply>`)
+
+	filter := SubtreeFilter(ListEntry("urn:ietf:params:xml:ns:yang:ietf-interfaces", "interfaces/interface", "name", "eth0", "mtu"))
+	data, err := sess.Get(context.Background(), filter)
+	require.NoError(t, err)
+
+	sentMsg, err := ts.popReqString()
+	require.NoError(t, err)
+	assert.Contains(t, sentMsg, `<get><filter type="subtree">`+
+		`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name><mtu/></interface></interfaces>`+
+		`</filter></get>`)
+	assert.Contains(t, string(data), "<mtu>1500</mtu>")
+}
+
+func TestGetConfigModel(t *testing.T) {
+	const ocNS = "http://openconfig.net/yang/interfaces"
+	assert.Equal(t, &Filter{Type: "subtree", Content: []byte(`<interfaces xmlns="` + ocNS + `"/>`)}, ModelFilter(ocNS, "interfaces"))
+
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>` +
+		`<interfaces xmlns="http://openconfig.net/yang/interfaces"><interface><name>eth0</name></interface></interfaces>` +
+		`</data></rpc-reply>`)
+
+	data, err := sess.GetConfigModel(context.Background(), Running, ocNS, "interfaces")
+	require.NoError(t, err)
+
+	sentMsg, err := ts.popReqString()
+	require.NoError(t, err)
+	assert.Contains(t, sentMsg, `<get-config><source><running/></source>`+
+		`<filter type="subtree"><interfaces xmlns="http://openconfig.net/yang/interfaces"/></filter>`+
+		`</get-config>`)
+	assert.Contains(t, string(data), "<name>eth0</name>")
+}
+
+func TestPing(t *testing.T) {
+	client, server := newPipeTransports()
+	sent := make(chan []byte, 1)
+	go serveOKRecorded(server, sent)
+
+	sess := newSession(client)
+	go sess.recv()
+
+	ctx := context.Background()
+	require.NoError(t, sess.Ping(ctx))
+	assert.Contains(t, string(<-sent), `<get><filter type="subtree"></filter></get>`)
+
+	// a dead session fails right away
+	server.Close()
+	select {
+	case <-sess.done:
+	case <-time.After(time.Second):
+		t.Fatal("session did not notice dead transport")
+	}
+	assert.Error(t, sess.Ping(ctx))
+}
+
+func TestGetConfigPrefixRoundTrip(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	// prefixes are declared on the envelope elements and used both in element
+	// names and in values.
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type" message-id="1">` +
+		`<data xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces"><if:interfaces><if:interface>` +
+		`<if:name>eth0</if:name><if:type>ianaift:ethernetCsmacd</if:type>` +
+		`</if:interface></if:interfaces></data></rpc-reply>`)
+
+	cfg, err := sess.GetConfig(context.Background(), Running)
+	assert.NoError(t, err)
+	_, err = ts.popReq()
+	assert.NoError(t, err)
+
+	// the fetched config should be self contained
+	var intfs struct {
+		XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces"`
+		Interface []struct {
+			Name string `xml:"name"`
+			Type string `xml:"type"`
+		} `xml:"interface"`
+	}
+	assert.NoError(t, xml.Unmarshal(cfg, &intfs))
+	assert.Len(t, intfs.Interface, 1)
+	assert.Equal(t, "ianaift:ethernetCsmacd", intfs.Interface[0].Type)
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="2"><ok/></rpc-reply>`)
+	err = sess.EditConfig(context.Background(), Candidate, cfg)
+	assert.NoError(t, err)
+
+	sentMsg, err := ts.popReqString()
+	assert.NoError(t, err)
+	assert.Contains(t, sentMsg,
+		`<config><if:interfaces xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type">`+
+			`<if:interface><if:name>eth0</if:name><if:type>ianaift:ethernetCsmacd</if:type></if:interface></if:interfaces></config>`)
+}
+
+type testInterfaces struct {
+	XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces"`
+	Interface []struct {
+		Name string `xml:"name"`
+		MTU  int    `xml:"mtu"`
+	} `xml:"interface"`
+}
+
+func TestLargeFilter(t *testing.T) {
+	// a filter of several MiB, much larger than any of the buffers
+	var b strings.Builder
+	b.WriteString(`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces">`)
+	for i := 0; b.Len() < 4<<20; i++ {
+		fmt.Fprintf(&b, "<interface><name>ge-0/0/%d</name></interface>", i)
+	}
+	b.WriteString("</interfaces>")
+	subtree := b.String()
+
+	tt := []struct {
+		chunked bool
+		// stream uses EncodeRPC which writes the message as it is marshaled.
+		stream bool
+	}{
+		{false, false},
+		{false, true},
+		{true, false},
+		{true, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("chunked=%t/stream=%t", tc.chunked, tc.stream), func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+			if tc.chunked {
+				client.Upgrade()
+				server.Upgrade()
+			}
+			sent := make(chan []byte, 1)
+			go serveOKRecorded(server, sent)
+
+			sess := newSession(client)
+			go sess.recv()
+
+			req := &GetReq{Filter: SubtreeFilter(subtree)}
+			var err error
+			if tc.stream {
+				_, err = sess.EncodeRPC(context.Background(), req)
+			} else {
+				_, err = sess.Do(context.Background(), req)
+			}
+			require.NoError(t, err)
+
+			msg := string(<-sent)
+			assert.Contains(t, msg, `<filter type="subtree">`+subtree+`</filter>`)
+			assert.True(t, strings.HasSuffix(strings.TrimSpace(msg), "</rpc>"))
+		})
+	}
+}
+
+func TestGetConfigInto(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	// the interfaces aren't the first element of the data and use a prefix
+	// declared on the envelope.
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" message-id="1">` +
+		`<data><system xmlns="urn:example:system"><hostname>r1</hostname></system>` +
+		`<if:interfaces><if:interface><if:name>eth0</if:name><if:mtu>1500</if:mtu></if:interface>` +
+		`<if:interface><if:name>eth1</if:name><if:mtu>9000</if:mtu></if:interface></if:interfaces></data></rpc-reply>`)
+
+	var intfs testInterfaces
+	require.NoError(t, sess.GetConfigInto(context.Background(), Running, nil, &intfs))
+	require.Len(t, intfs.Interface, 2)
+	assert.Equal(t, "eth0", intfs.Interface[0].Name)
+	assert.Equal(t, 1500, intfs.Interface[0].MTU)
+	assert.Equal(t, "eth1", intfs.Interface[1].Name)
+	assert.Equal(t, 9000, intfs.Interface[1].MTU)
+
+	sentMsg, err := ts.popReqString()
+	require.NoError(t, err)
+	assert.NotContains(t, sentMsg, "<filter")
+}
+
+func TestDecodeData(t *testing.T) {
+	const (
+		ifNS  = "urn:ietf:params:xml:ns:yang:ietf-interfaces"
+		ifXML = `<interfaces xmlns="` + ifNS + `"><interface><name>eth0</name></interface></interfaces>`
+	)
+
+	t.Run("named", func(t *testing.T) {
+		var intfs testInterfaces
+		require.NoError(t, DecodeData([]byte(`<system xmlns="urn:example:system"/>`+ifXML), &intfs))
+		require.Len(t, intfs.Interface, 1)
+		assert.Equal(t, "eth0", intfs.Interface[0].Name)
+	})
+
+	t.Run("other namespace", func(t *testing.T) {
+		var intfs testInterfaces
+		require.NoError(t, DecodeData([]byte(`<interfaces xmlns="urn:example:other"><interface><name>x</name></interface></interfaces>`), &intfs))
+		assert.Empty(t, intfs.Interface)
+	})
+
+	t.Run("unnamed", func(t *testing.T) {
+		var intfs struct {
+			Interface []struct {
+				Name string `xml:"name"`
+			} `xml:"interface"`
+		}
+		require.NoError(t, DecodeData([]byte(ifXML), &intfs))
+		require.Len(t, intfs.Interface, 1)
+		assert.Equal(t, "eth0", intfs.Interface[0].Name)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var intfs testInterfaces
+		require.NoError(t, DecodeData(nil, &intfs))
+		assert.Empty(t, intfs.Interface)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var intfs testInterfaces
+		assert.Error(t, DecodeData([]byte(`<interfaces xmlns="`+ifNS+`"><interface>`), &intfs))
+	})
+}
+
+type lenientSystem struct {
+	XMLName  xml.Name `xml:"urn:example:system system"`
+	Hostname string   `xml:"urn:example:system hostname"`
+	NTP      struct {
+		Enabled bool     `xml:"enabled"`
+		Servers []string `xml:"urn:example:system server"`
+	} `xml:"urn:example:system ntp"`
+	// an augment assumed to be in the same namespace
+	Location string `xml:"urn:example:system location"`
+	Other    []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+func TestDecodeDataLenientNamespaces(t *testing.T) {
+	// the device uses a different namespace for the model than the struct
+	// assumes, a prefix for part of it and another namespace for the augment.
+	const data = `<system xmlns="http://example.com/ns/system" xmlns:loc="urn:example:location">
+  <hostname>r1</hostname>
+  <sys:ntp xmlns:sys="http://example.com/ns/system">
+    <sys:enabled>true</sys:enabled>
+    <sys:server>192.0.2.1</sys:server>
+    <server>192.0.2.2</server>
+  </sys:ntp>
+  <loc:location>rack 4</loc:location>
+  <contact xmlns="urn:example:contact">noc@example.com</contact>
+</system>`
+
+	var strict lenientSystem
+	require.NoError(t, DecodeData([]byte(data), &strict))
+	assert.Empty(t, strict.Hostname, "strict decoding drops the data")
+
+	var sys lenientSystem
+	require.NoError(t, DecodeData([]byte(data), &sys, WithLenientNamespaces()))
+	assert.Equal(t, "r1", sys.Hostname)
+	assert.True(t, sys.NTP.Enabled)
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, sys.NTP.Servers)
+	assert.Equal(t, "rack 4", sys.Location)
+	require.Len(t, sys.Other, 1)
+	// unmatched elements keep their namespace
+	assert.Equal(t, xml.Name{Space: "urn:example:contact", Local: "contact"}, sys.Other[0].XMLName)
+	assert.Equal(t, "noc@example.com", sys.Other[0].Value)
+}
+
 type structuredCfg struct {
 	System structuredCfgSystem `xml:"system"`
 }
@@ -201,6 +616,142 @@ func TestEditConfig(t *testing.T) {
 	}
 }
 
+func TestMarshalOperationElem(t *testing.T) {
+	type intf struct {
+		Name string `xml:"name"`
+	}
+
+	type intfs struct {
+		XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces"`
+		Interface any      `xml:"interface"`
+	}
+
+	tt := []struct {
+		name      string
+		elem      OperationElem
+		want      string
+		shouldErr bool
+	}{
+		{
+			name: "delete struct",
+			elem: OperationElem{Operation: DeleteConfig, Value: intf{Name: "eth0"}},
+			want: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces">` +
+				`<interface xmlns:xc="urn:ietf:params:xml:ns:netconf:base:1.0" xc:operation="delete"><name>eth0</name></interface>` +
+				`</interfaces>`,
+		},
+		{
+			name: "replace string",
+			elem: OperationElem{Operation: ReplaceConfig, Value: "<name>eth1</name><mtu>9000</mtu>"},
+			want: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces">` +
+				`<interface xmlns:xc="urn:ietf:params:xml:ns:netconf:base:1.0" xc:operation="replace"><name>eth1</name><mtu>9000</mtu></interface>` +
+				`</interfaces>`,
+		},
+		{
+			name: "remove empty",
+			elem: OperationElem{Operation: RemoveConfig},
+			want: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces">` +
+				`<interface xmlns:xc="urn:ietf:params:xml:ns:netconf:base:1.0" xc:operation="remove"></interface>` +
+				`</interfaces>`,
+		},
+		{
+			name: "value xmlname wins over field",
+			elem: OperationElem{Operation: DeleteConfig, Value: struct {
+				XMLName xml.Name `xml:"urn:example:other iface"`
+				Name    string   `xml:"name"`
+			}{Name: "eth0"}},
+			want: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces">` +
+				`<iface xmlns="urn:example:other" xmlns:xc="urn:ietf:params:xml:ns:netconf:base:1.0" xc:operation="delete"><name>eth0</name></iface>` +
+				`</interfaces>`,
+		},
+		{
+			name:      "none is not an operation",
+			elem:      OperationElem{Operation: NoMergeStrategy, Value: intf{Name: "eth0"}},
+			shouldErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := xml.Marshal(&intfs{Interface: tc.elem})
+			if tc.shouldErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestEditConfigOperationElem(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+
+	cfg := struct {
+		XMLName xml.Name `xml:"config"`
+		System  any      `xml:"http://example.com/schema/1.2/config system"`
+	}{
+		System: OperationElem{Operation: DeleteConfig, Value: "<ntp/>"},
+	}
+
+	err := sess.EditConfig(context.Background(), Candidate, cfg, WithDefaultMergeStrategy(NoMergeStrategy))
+	assert.NoError(t, err)
+
+	sentMsg, err := ts.popReqString()
+	assert.NoError(t, err)
+	assert.Contains(t, sentMsg, `<default-operation>none</default-operation>`)
+	assert.Contains(t, sentMsg, `<system xmlns="http://example.com/schema/1.2/config" xmlns:xc="urn:ietf:params:xml:ns:netconf:base:1.0" xc:operation="delete"><ntp/></system>`)
+}
+
+func TestEditConfigOperationElemDirect(t *testing.T) {
+	type intf struct {
+		XMLName xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interface"`
+		Name    string   `xml:"name"`
+	}
+
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+
+	err := sess.EditConfig(context.Background(), Candidate, OperationElem{
+		Operation: DeleteConfig,
+		Value:     intf{Name: "eth0"},
+	})
+	assert.NoError(t, err)
+
+	sentMsg, err := ts.popReqString()
+	assert.NoError(t, err)
+	assert.Contains(t, sentMsg, `<config><interface xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:xc="urn:ietf:params:xml:ns:netconf:base:1.0" xc:operation="delete"><name>eth0</name></interface></config>`)
+
+	// without a name there is no element to put the attribute on
+	err = sess.EditConfig(context.Background(), Candidate, OperationElem{
+		Operation: DeleteConfig,
+		Value:     "<interface><name>eth0</name></interface>",
+	})
+	assert.Error(t, err)
+}
+
+func TestOperationElemAttrsNotAliased(t *testing.T) {
+	attrs := make([]xml.Attr, 1, 4)
+	attrs[0] = xml.Attr{Name: xml.Name{Local: "foo"}, Value: "bar"}
+	start := xml.StartElement{Name: xml.Name{Local: "interface"}, Attr: attrs}
+
+	var buf strings.Builder
+	e := xml.NewEncoder(&buf)
+	err := OperationElem{Operation: CreateConfig}.MarshalXML(e, start)
+	assert.NoError(t, err)
+	assert.NoError(t, e.Flush())
+
+	assert.Equal(t, `<interface foo="bar" xmlns:xc="urn:ietf:params:xml:ns:netconf:base:1.0" xc:operation="create"></interface>`, buf.String())
+	assert.Len(t, start.Attr, 1)
+	assert.Equal(t, xml.Attr{}, attrs[:2][1])
+}
+
 // TODO: TestEditConfigError()
 
 func TestCopyConfig(t *testing.T) {
@@ -246,6 +797,8 @@ func TestCopyConfig(t *testing.T) {
 
 			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
 
+			sess.serverCaps = newCapabilitySet(":url:1.0?scheme=ftp,http")
+
 			err := sess.CopyConfig(context.Background(), tc.source, tc.target)
 			assert.NoError(t, err)
 
@@ -259,23 +812,354 @@ func TestCopyConfig(t *testing.T) {
 	}
 }
 
+func TestURLSchemeValidation(t *testing.T) {
+	tt := []struct {
+		name    string
+		caps    []string
+		call    func(*Session) error
+		wantErr string
+	}{
+		{
+			name: "copy-config unsupported target scheme",
+			caps: []string{":url:1.0?scheme=file,https"},
+			call: func(s *Session) error {
+				return s.CopyConfig(context.Background(), Running, URL("ftp://myserver.example.com/router.cfg"))
+			},
+			wantErr: `url scheme "ftp" is not supported by the device (supported schemes: file, https)`,
+		},
+		{
+			name: "copy-config unsupported source scheme",
+			caps: []string{":url:1.0?scheme=file"},
+			call: func(s *Session) error {
+				return s.CopyConfig(context.Background(), URL("sftp://myserver.example.com/router.cfg"), Candidate)
+			},
+			wantErr: `url scheme "sftp" is not supported by the device (supported schemes: file)`,
+		},
+		{
+			name: "delete-config unsupported scheme",
+			caps: []string{":url:1.0?scheme=file"},
+			call: func(s *Session) error {
+				return s.DeleteConfig(context.Background(), URL("https://myserver.example.com/router.cfg"))
+			},
+			wantErr: `url scheme "https" is not supported by the device (supported schemes: file)`,
+		},
+		{
+			name: "validate without url capability",
+			call: func(s *Session) error {
+				return s.Validate(context.Background(), URL("file:///router.cfg"))
+			},
+			wantErr: "device does not support the :url capability",
+		},
+		{
+			name: "validate url without validate capability",
+			caps: []string{":url:1.0?scheme=file"},
+			call: func(s *Session) error {
+				return s.Validate(context.Background(), URL("file:///router.cfg"))
+			},
+			wantErr: "device does not support the :validate capability",
+		},
+		{
+			name: "validate url unsupported scheme",
+			caps: []string{":validate:1.1", ":url:1.0?scheme=file"},
+			call: func(s *Session) error {
+				return s.Validate(context.Background(), URL("ftp://myserver.example.com/router.cfg"))
+			},
+			wantErr: `url scheme "ftp" is not supported by the device (supported schemes: file)`,
+		},
+		{
+			name: "copy-config url capability without schemes",
+			caps: []string{":url:1.0"},
+			call: func(s *Session) error {
+				return s.CopyConfig(context.Background(), Running, URL("ftp://myserver.example.com/router.cfg"))
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			sess.serverCaps = newCapabilitySet(tc.caps...)
+
+			if tc.wantErr == "" {
+				go sess.recv()
+				ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+				assert.NoError(t, tc.call(sess))
+				return
+			}
+
+			// nothing is sent to the device so no reply needs to be queued.
+			err := tc.call(sess)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestEditConfigProgress(t *testing.T) {
+	// the reply is written to the pipe a piece at a time so the errors have to
+	// be delivered before the rest of the reply is sent.
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	client := &pipeTransport{Framer: transport.NewFramer(cr, cw), close: func() error {
+		cw.Close()
+		return sw.Close()
+	}}
+	defer client.Close()
+
+	got := make(chan RPCError)
+	sess := newSession(client)
+	go sess.recv()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- sess.EditConfigProgress(context.Background(), Candidate, "<interfaces/>", func(err RPCError) {
+			got <- err
+		}, WithErrorStrategy(ContinueOnError))
+	}()
+
+	req, err := io.ReadAll(io.LimitReader(sr, int64(len("<rpc"))))
+	require.NoError(t, err)
+	require.Equal(t, "<rpc", string(req))
+	go func() { _, _ = io.Copy(io.Discard, sr) }()
+
+	rpcError := func(tag, sev, msg string) string {
+		return fmt.Sprintf(`<rpc-error><error-type>application</error-type><error-tag>%s</error-tag><error-severity>%s</error-severity><error-message>%s</error-message></rpc-error>`, tag, sev, msg)
+	}
+
+	_, err = io.WriteString(sw, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">`)
+	require.NoError(t, err)
+	pieces := []struct {
+		tag, sev, msg string
+	}{
+		{"invalid-value", "error", "bad mtu on ge-0/0/1"},
+		{"invalid-value", "warning", "deprecated leaf"},
+		{"data-missing", "error", "no such vlan"},
+	}
+	for _, p := range pieces {
+		_, err = io.WriteString(sw, rpcError(p.tag, p.sev, p.msg))
+		require.NoError(t, err)
+
+		select {
+		case rpcErr := <-got:
+			assert.Equal(t, ErrTag(p.tag), rpcErr.Tag)
+			assert.Equal(t, ErrSeverity(p.sev), rpcErr.Severity)
+			assert.Equal(t, p.msg, rpcErr.Message)
+		case <-time.After(time.Second):
+			t.Fatalf("rpc-error %q not delivered before the end of the reply", p.msg)
+		}
+	}
+	_, err = io.WriteString(sw, `</rpc-reply>]]>]]>`)
+	require.NoError(t, err)
+
+	// only the errors (not the warning) fail the edit
+	err = <-result
+	var rpcErrs RPCErrors
+	require.ErrorAs(t, err, &rpcErrs)
+	require.Len(t, rpcErrs, 2)
+	assert.Equal(t, "bad mtu on ge-0/0/1", rpcErrs[0].Message)
+	assert.Equal(t, "no such vlan", rpcErrs[1].Message)
+}
+
+func TestEditConfigRollbackOnError(t *testing.T) {
+	t.Run("not advertised", func(t *testing.T) {
+		ts := newTestServer(t)
+		sess := newSession(ts.transport())
+		sess.serverCaps = newCapabilitySet(":candidate:1.0")
+
+		// nothing is sent to the device so no reply needs to be queued.
+		err := sess.EditConfig(context.Background(), Candidate, intfaceConfig, WithErrorStrategy(RollbackOnError))
+		assert.ErrorContains(t, err, "device does not support the :rollback-on-error capability")
+	})
+
+	t.Run("advertised", func(t *testing.T) {
+		ts := newTestServer(t)
+		sess := newSession(ts.transport())
+		sess.serverCaps = newCapabilitySet(":candidate:1.0", ":rollback-on-error:1.0")
+		go sess.recv()
+
+		ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+
+		err := sess.EditConfig(context.Background(), Candidate, intfaceConfig, WithErrorStrategy(RollbackOnError))
+		require.NoError(t, err)
+
+		sentMsg, err := ts.popReqString()
+		require.NoError(t, err)
+		assert.Contains(t, sentMsg, "<error-option>rollback-on-error</error-option>")
+	})
+}
+
+func TestEditConfigTargetValidation(t *testing.T) {
+	tt := []struct {
+		name        string
+		target      Datastore
+		caps        []string
+		wantMissing []string
+	}{
+		{"running not writable", Running, []string{":candidate:1.0"}, []string{":writable-running:1.0"}},
+		{"running writable", Running, []string{":writable-running:1.0"}, nil},
+		{"candidate not supported", Candidate, []string{":writable-running:1.0"}, []string{":candidate:1.0"}},
+		{"candidate supported", Candidate, []string{":candidate:1.0"}, nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport(), WithTargetValidation())
+			sess.serverCaps = newCapabilitySet(tc.caps...)
+
+			if tc.wantMissing != nil {
+				// nothing is sent to the device so no reply needs to be queued.
+				err := sess.EditConfig(context.Background(), tc.target, intfaceConfig)
+				var missingErr *MissingCapabilitiesError
+				require.ErrorAs(t, err, &missingErr)
+				assert.Equal(t, tc.wantMissing, missingErr.Missing)
+				assert.ErrorContains(t, err, "cannot edit-config "+string(tc.target))
+				return
+			}
+
+			go sess.recv()
+			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+			require.NoError(t, sess.EditConfig(context.Background(), tc.target, intfaceConfig))
+			_, err := ts.popReqString()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestLeaves(t *testing.T) {
+	const sysNS = "urn:example:system"
+
+	tt := []struct {
+		name   string
+		path   string
+		leaves map[string]any
+		want   string
+	}{
+		{
+			name:   "top-level",
+			path:   "system",
+			leaves: map[string]any{"hostname": "r1", "location": "lab"},
+			want:   `<system xmlns="` + sysNS + `"><hostname>r1</hostname><location>lab</location></system>`,
+		},
+		{
+			name:   "nested",
+			path:   "system/ntp",
+			leaves: map[string]any{"server": "192.0.2.1", "enabled": true, "port": 123},
+			want: `<system xmlns="` + sysNS + `"><ntp><enabled>true</enabled><port>123</port>` +
+				`<server>192.0.2.1</server></ntp></system>`,
+		},
+		{
+			name:   "escaped value",
+			path:   "system",
+			leaves: map[string]any{"contact": "ops <ops@example.com>"},
+			want:   `<system xmlns="` + sysNS + `"><contact>ops &lt;ops@example.com&gt;</contact></system>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Leaves(sysNS, tc.path, tc.leaves))
+		})
+	}
+}
+
+func TestSetLeaves(t *testing.T) {
+	tt := []struct {
+		name   string
+		opts   []EditConfigOption
+		wantOp string
+	}{
+		{"merge by default", nil, "merge"},
+		{"replace", []EditConfigOption{WithDefaultMergeStrategy(ReplaceConfig)}, "replace"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			go sess.recv()
+
+			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+			err := sess.SetLeaves(context.Background(), Candidate, "urn:example:system", "system", map[string]any{"hostname": "r1"}, tc.opts...)
+			require.NoError(t, err)
+
+			sentMsg, err := ts.popReqString()
+			require.NoError(t, err)
+			assert.Contains(t, sentMsg, "<default-operation>"+tc.wantOp+"</default-operation>")
+			assert.Contains(t, sentMsg, `<config><system xmlns="urn:example:system"><hostname>r1</hostname></system></config>`)
+		})
+	}
+}
+
+func TestCapabilityEnforcement(t *testing.T) {
+	tt := []struct {
+		name string
+		call func(*Session) error
+	}{
+		{"rollback-on-error", func(s *Session) error {
+			return s.EditConfig(context.Background(), Candidate, intfaceConfig, WithErrorStrategy(RollbackOnError))
+		}},
+		{"url", func(s *Session) error {
+			return s.CopyConfig(context.Background(), URL("file://backup.cfg"), Startup)
+		}},
+		{"target validation", func(s *Session) error {
+			return s.EditConfig(context.Background(), Running, intfaceConfig)
+		}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("strict", func(t *testing.T) {
+				ts := newTestServer(t)
+				sess := newSession(ts.transport(), WithTargetValidation())
+				sess.serverCaps = newCapabilitySet(":candidate:1.0")
+
+				// nothing is sent to the device so no reply needs to be queued.
+				assert.Error(t, tc.call(sess))
+			})
+
+			t.Run("lenient", func(t *testing.T) {
+				ts := newTestServer(t)
+				sess := newSession(ts.transport(), WithTargetValidation(), WithCapabilityEnforcement(CapabilityLenient))
+				sess.serverCaps = newCapabilitySet(":candidate:1.0")
+				go sess.recv()
+
+				ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+				require.NoError(t, tc.call(sess))
+				_, err := ts.popReqString()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
 func TestDeleteConfig(t *testing.T) {
 	tt := []struct {
-		target  Datastore
+		name    string
+		target  any
 		matches []*regexp.Regexp
 	}{
 		{
+			name:   "startup",
 			target: Startup,
 			matches: []*regexp.Regexp{
 				regexp.MustCompile(`<delete-config>\S*<target>\S*<startup/>\S*</target>\S*</delete-config>`),
 			},
 		},
+		{
+			name:   "url",
+			target: URL("file://startup.cfg"),
+			matches: []*regexp.Regexp{
+				regexp.MustCompile(`<delete-config>\S*<target>\S*<url>file://startup.cfg</url>\S*</target>\S*</delete-config>`),
+			},
+		},
 	}
 
 	for _, tc := range tt {
-		t.Run(string(tc.target), func(t *testing.T) {
+		t.Run(tc.name, func(t *testing.T) {
 			ts := newTestServer(t)
 			sess := newSession(ts.transport())
+			sess.serverCaps = newCapabilitySet(":url:1.0?scheme=file")
 			go sess.recv()
 
 			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
@@ -306,6 +1190,13 @@ func TestValidateConfig(t *testing.T) {
 				regexp.MustCompile(`<validate>\S*<source>\S*<candidate/>\S*</source>\S*</validate>`),
 			},
 		},
+		{
+			name:   "url",
+			source: URL("file:///staged.cfg"),
+			matches: []*regexp.Regexp{
+				regexp.MustCompile(`<validate><source><url>file:///staged.cfg</url></source></validate>`),
+			},
+		},
 		// XXX: test []byte,string
 		// XXX: test xml object
 	}
@@ -314,6 +1205,7 @@ func TestValidateConfig(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ts := newTestServer(t)
 			sess := newSession(ts.transport())
+			sess.serverCaps = newCapabilitySet(":validate:1.0", ":url:1.0?scheme=file")
 			go sess.recv()
 
 			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
@@ -538,6 +1430,72 @@ func TestCancelCommit(t *testing.T) {
 	}
 }
 
+func TestCommitErrors(t *testing.T) {
+	rpcError := func(tag ErrTag, msg string) string {
+		return `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><rpc-error>` +
+			`<error-type>protocol</error-type><error-tag>` + string(tag) + `</error-tag>` +
+			`<error-severity>error</error-severity><error-message>` + msg + `</error-message></rpc-error></rpc-reply>`
+	}
+
+	tt := []struct {
+		name    string
+		call    func(*Session) error
+		reply   string
+		wantErr error
+		wantTag ErrTag
+	}{
+		{
+			name:    "confirming without pending commit",
+			call:    func(s *Session) error { return s.Commit(context.Background(), WithPersistID("myid")) },
+			reply:   rpcError(ErrInvalidValue, "no pending confirmed commit with persist-id myid"),
+			wantErr: ErrNoPendingCommit,
+			wantTag: ErrInvalidValue,
+		},
+		{
+			name:    "cancel without pending commit",
+			call:    func(s *Session) error { return s.CancelCommit(context.Background()) },
+			reply:   rpcError(ErrOperationFailed, "no confirmed commit pending"),
+			wantErr: ErrNoPendingCommit,
+			wantTag: ErrOperationFailed,
+		},
+		{
+			name:    "pending commit from other session",
+			call:    func(s *Session) error { return s.Commit(context.Background()) },
+			reply:   rpcError(ErrInUse, "confirmed commit pending from session 7"),
+			wantErr: ErrCommitInUse,
+			wantTag: ErrInUse,
+		},
+		{
+			name:    "other error",
+			call:    func(s *Session) error { return s.Commit(context.Background()) },
+			reply:   rpcError(ErrInvalidValue, "mtu out of range"),
+			wantTag: ErrInvalidValue,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			go sess.recv()
+
+			ts.queueRespString(tc.reply)
+			err := tc.call(sess)
+			require.Error(t, err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				assert.NotErrorIs(t, err, ErrNoPendingCommit)
+				assert.NotErrorIs(t, err, ErrCommitInUse)
+			}
+
+			var rpcErr RPCError
+			require.ErrorAs(t, err, &rpcErr)
+			assert.Equal(t, tc.wantTag, rpcErr.Tag)
+		})
+	}
+}
+
 func TestCreateSubscription(t *testing.T) {
 	start := time.Date(2023, time.June, 07, 18, 31, 48, 00, time.UTC)
 	end := time.Date(2023, time.June, 07, 18, 33, 48, 00, time.UTC)
@@ -580,6 +1538,7 @@ func TestCreateSubscription(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ts := newTestServer(t)
 			sess := newSession(ts.transport())
+			sess.serverCaps = newCapabilitySet(":notification:1.0")
 			go sess.recv()
 
 			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
@@ -596,3 +1555,130 @@ func TestCreateSubscription(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateSubscriptionCapabilities(t *testing.T) {
+	xpath := XPathFilter("/if:link-down", map[string]string{"if": "urn:example:links"})
+
+	tt := []struct {
+		name        string
+		caps        []string
+		opts        []CreateSubscriptionOption
+		wantMissing []string
+	}{
+		{"no notification", []string{":candidate:1.0"}, nil, []string{":notification:1.0"}},
+		{"subtree filter", []string{":notification:1.0"}, []CreateSubscriptionOption{WithFilterOption(SubtreeFilter("<link-down/>"))}, nil},
+		{"xpath filter without xpath", []string{":notification:1.0"}, []CreateSubscriptionOption{WithFilterOption(xpath)}, []string{":xpath:1.0"}},
+		{"xpath filter", []string{":notification:1.0", ":xpath:1.0"}, []CreateSubscriptionOption{WithFilterOption(xpath)}, nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			sess.serverCaps = newCapabilitySet(tc.caps...)
+			go sess.recv()
+
+			if tc.wantMissing == nil {
+				ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+				assert.NoError(t, sess.CreateSubscription(context.Background(), tc.opts...))
+				return
+			}
+
+			// nothing is sent to the device so no reply needs to be queued.
+			var missingErr *MissingCapabilitiesError
+			err := sess.CreateSubscription(context.Background(), tc.opts...)
+			require.ErrorAs(t, err, &missingErr)
+			assert.Equal(t, tc.wantMissing, missingErr.Missing)
+
+			_, err = sess.Subscribe(context.Background(), nil, tc.opts...)
+			assert.ErrorAs(t, err, &missingErr)
+			assert.False(t, sess.hasSubscriptions())
+		})
+	}
+}
+
+func TestOperationsBaseNamespace(t *testing.T) {
+	ops := []struct {
+		name string
+		// space is the expected namespace of the operation element
+		space string
+		call  func(context.Context, *Session) error
+	}{
+		{"get-config", baseNamespace, func(ctx context.Context, s *Session) error {
+			_, err := s.GetConfig(ctx, Running)
+			return err
+		}},
+		{"edit-config", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.EditConfig(ctx, Candidate, "<system/>")
+		}},
+		{"copy-config", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.CopyConfig(ctx, Running, Startup)
+		}},
+		{"delete-config", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.DeleteConfig(ctx, Startup)
+		}},
+		{"lock", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.Lock(ctx, Candidate)
+		}},
+		{"unlock", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.Unlock(ctx, Candidate)
+		}},
+		{"kill-session", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.KillSession(ctx, 42)
+		}},
+		{"validate", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.Validate(ctx, Candidate)
+		}},
+		{"commit", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.Commit(ctx)
+		}},
+		{"cancel-commit", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.CancelCommit(ctx)
+		}},
+		{"discard-changes", baseNamespace, func(ctx context.Context, s *Session) error {
+			return s.DiscardChanges(ctx)
+		}},
+		{"create-subscription", notifNamespace, func(ctx context.Context, s *Session) error {
+			return s.CreateSubscription(ctx)
+		}},
+	}
+
+	for _, framing := range []string{"eom", "chunked"} {
+		t.Run(framing, func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+			if framing == "chunked" {
+				client.Upgrade()
+				server.Upgrade()
+			}
+
+			sent := make(chan []byte, 1)
+			go serveOKRecorded(server, sent)
+
+			sess := newSession(client)
+			sess.serverCaps = newCapabilitySet(":notification:1.0")
+			go sess.recv()
+
+			for i, op := range ops {
+				t.Run(op.name, func(t *testing.T) {
+					// the reply is always `<ok/>` so ops expecting data will
+					// fail to decode, only the request matters here.
+					_ = op.call(context.Background(), sess)
+
+					var msg struct {
+						XMLName   xml.Name
+						MessageID uint64 `xml:"message-id,attr"`
+						Op        struct {
+							XMLName xml.Name
+						} `xml:",any"`
+					}
+					require.NoError(t, xml.Unmarshal(<-sent, &msg))
+
+					assert.Equal(t, xml.Name{Space: baseNamespace, Local: "rpc"}, msg.XMLName)
+					assert.Equal(t, uint64(i+1), msg.MessageID)
+					assert.Equal(t, xml.Name{Space: op.space, Local: op.name}, msg.Op.XMLName)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned from [Pool.Get] after the pool has been closed.
+var ErrPoolClosed = errors.New("netconf: pool closed")
+
+// Dialer opens a new, ready to use, Session to the given target.  What a target
+// is (address, hostname, inventory name) is up to the implementation.
+type Dialer interface {
+	Dial(ctx context.Context, target string) (*Session, error)
+}
+
+// DialerFunc is an adapter to allow the use of an ordinary function as a
+// [Dialer].
+type DialerFunc func(ctx context.Context, target string) (*Session, error)
+
+// Dial calls f(ctx, target).
+func (f DialerFunc) Dial(ctx context.Context, target string) (*Session, error) {
+	return f(ctx, target)
+}
+
+// HealthCheckFunc is called on an idle session before it is handed out by
+// a [Pool].  Returning an error will cause the session to be closed and
+// a different (or new) session to be used.
+type HealthCheckFunc func(ctx context.Context, s *Session) error
+
+type poolConfig struct {
+	maxSessions  int
+	idleTimeout  time.Duration
+	closeTimeout time.Duration
+	healthCheck  HealthCheckFunc
+}
+
+// PoolOption is an optional argument to [NewPool].
+type PoolOption interface {
+	apply(*poolConfig)
+}
+
+type (
+	maxSessionsOpt int
+	idleTimeoutOpt time.Duration
+	healthCheckOpt HealthCheckFunc
+)
+
+func (o maxSessionsOpt) apply(cfg *poolConfig) { cfg.maxSessions = int(o) }
+func (o idleTimeoutOpt) apply(cfg *poolConfig) { cfg.idleTimeout = time.Duration(o) }
+func (o healthCheckOpt) apply(cfg *poolConfig) { cfg.healthCheck = HealthCheckFunc(o) }
+
+// WithMaxSessions sets the maximum number of open sessions (idle and checked
+// out) to any one target.  Calls to [Pool.Get] will block once the limit has
+// been reached until a session is released or the context is done.  Defaults
+// to 4.
+func WithMaxSessions(n int) PoolOption { return maxSessionsOpt(n) }
+
+// WithIdleTimeout sets how long a session can sit unused in the pool before it
+// is closed.  A zero duration disables idle eviction.  Defaults to 5 minutes.
+func WithIdleTimeout(d time.Duration) PoolOption { return idleTimeoutOpt(d) }
+
+// WithHealthCheck sets a function used to verify an idle session before it is
+// handed out.  Sessions whose transport has gone away are always evicted, this
+// is for additional checks such as a round trip with [Session.Ping].
+//
+//	netconf.WithHealthCheck(func(ctx context.Context, s *netconf.Session) error {
+//		return s.Ping(ctx)
+//	})
+func WithHealthCheck(fn HealthCheckFunc) PoolOption { return healthCheckOpt(fn) }
+
+// Pool maintains a bounded set of open sessions per target that can be reused
+// across many RPCs.  Sessions are dialed on demand with the given [Dialer].
+type Pool struct {
+	dialer Dialer
+	cfg    poolConfig
+
+	mu      sync.Mutex
+	targets map[string]*poolTarget
+	closed  bool
+
+	stop chan struct{}
+}
+
+type poolTarget struct {
+	// open is the number of idle plus checked out sessions.
+	open int
+	idle []*idleSession
+
+	// avail is closed (and replaced) any time a slot or an idle session may
+	// have become available to wake up waiters.
+	avail chan struct{}
+}
+
+func (t *poolTarget) notify() {
+	close(t.avail)
+	t.avail = make(chan struct{})
+}
+
+type idleSession struct {
+	s     *Session
+	since time.Time
+}
+
+// NewPool returns a new Pool using `dialer` to open new sessions.
+func NewPool(dialer Dialer, opts ...PoolOption) *Pool {
+	cfg := poolConfig{
+		maxSessions:  4,
+		idleTimeout:  5 * time.Minute,
+		closeTimeout: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+
+	p := &Pool{
+		dialer:  dialer,
+		cfg:     cfg,
+		targets: make(map[string]*poolTarget),
+		stop:    make(chan struct{}),
+	}
+
+	if cfg.idleTimeout > 0 {
+		go p.janitor()
+	}
+
+	return p
+}
+
+func (p *Pool) target(name string) *poolTarget {
+	t, ok := p.targets[name]
+	if !ok {
+		t = &poolTarget{avail: make(chan struct{})}
+		p.targets[name] = t
+	}
+	return t
+}
+
+// Get returns a session to the given target.  An idle session is reused when
+// one is available and healthy, otherwise a new one is dialed as long as the
+// target is under the max session limit.  When at the limit Get blocks until
+// a session is released or the context is done.
+//
+// The returned release function must be called once the caller is done with
+// the session to return it to the pool.  Sessions should not be closed by
+// the caller.
+func (p *Pool) Get(ctx context.Context, target string) (*Session, func(), error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, nil, ErrPoolClosed
+		}
+		t := p.target(target)
+
+		// reuse the most recently used session first so that seldom used ones
+		// will age out.
+		if n := len(t.idle); n > 0 {
+			is := t.idle[n-1]
+			t.idle = t.idle[:n-1]
+			p.mu.Unlock()
+
+			if err := p.check(ctx, is.s); err != nil {
+				// a failure caused by the caller's context says nothing
+				// about the session so put it back for someone else.
+				if ctxErr := ctx.Err(); ctxErr != nil && is.s.alive() {
+					p.putIdle(target, is)
+					return nil, nil, ctxErr
+				}
+				p.discard(target, is.s)
+				continue
+			}
+			return is.s, p.releaser(target, is.s), nil
+		}
+
+		if t.open < p.cfg.maxSessions {
+			t.open++
+			p.mu.Unlock()
+
+			s, err := p.dialer.Dial(ctx, target)
+			if err != nil {
+				p.mu.Lock()
+				t.open--
+				t.notify()
+				p.mu.Unlock()
+				return nil, nil, err
+			}
+			return s, p.releaser(target, s), nil
+		}
+
+		avail := t.avail
+		p.mu.Unlock()
+
+		select {
+		case <-avail:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+func (p *Pool) check(ctx context.Context, s *Session) error {
+	if !s.alive() {
+		return ErrClosed
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	if p.cfg.healthCheck != nil {
+		return p.cfg.healthCheck(ctx, s)
+	}
+	return nil
+}
+
+func (p *Pool) releaser(target string, s *Session) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { p.release(target, s) })
+	}
+}
+
+func (p *Pool) release(target string, s *Session) {
+	p.mu.Lock()
+	if p.closed || !s.alive() {
+		p.mu.Unlock()
+		p.discard(target, s)
+		return
+	}
+
+	t := p.target(target)
+	t.idle = append(t.idle, &idleSession{s: s, since: time.Now()})
+	t.notify()
+	p.mu.Unlock()
+}
+
+// putIdle returns a checked out, but unused, session to the idle list keeping
+// it's original idle time.
+func (p *Pool) putIdle(target string, is *idleSession) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.discard(target, is.s)
+		return
+	}
+
+	t := p.target(target)
+	t.idle = append(t.idle, is)
+	t.notify()
+	p.mu.Unlock()
+}
+
+// discard closes the session and frees up it's slot in the pool.
+func (p *Pool) discard(target string, s *Session) {
+	p.mu.Lock()
+	t := p.target(target)
+	t.open--
+	t.notify()
+	p.mu.Unlock()
+
+	p.closeSession(s)
+}
+
+func (p *Pool) closeSession(s *Session) {
+	// a dead session will never get a reply to a close-session so just tear
+	// down the transport.
+	if !s.alive() {
+		s.tr.Close()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.closeTimeout)
+	defer cancel()
+	_ = s.Close(ctx)
+}
+
+// janitor periodically closes sessions that have been idle past the idle
+// timeout.
+func (p *Pool) janitor() {
+	interval := p.cfg.idleTimeout / 2
+	if interval < time.Second {
+		interval = p.cfg.idleTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.evictIdle(time.Now())
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// evictIdle closes any idle sessions that have been unused since before
+// `now - idleTimeout` or whose transport has died.
+func (p *Pool) evictIdle(now time.Time) {
+	var evicted []*Session
+
+	p.mu.Lock()
+	for _, t := range p.targets {
+		kept := t.idle[:0]
+		for _, is := range t.idle {
+			if now.Sub(is.since) >= p.cfg.idleTimeout || !is.s.alive() {
+				evicted = append(evicted, is.s)
+				t.open--
+				continue
+			}
+			kept = append(kept, is)
+		}
+		if len(kept) != len(t.idle) {
+			t.idle = kept
+			t.notify()
+		}
+	}
+	p.mu.Unlock()
+
+	for _, s := range evicted {
+		p.closeSession(s)
+	}
+}
+
+// Close closes all idle sessions in the pool.  Sessions that are currently
+// checked out are closed when they are released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+
+	var idle []*Session
+	for _, t := range p.targets {
+		for _, is := range t.idle {
+			idle = append(idle, is.s)
+		}
+		t.open -= len(t.idle)
+		t.idle = nil
+		t.notify()
+	}
+	p.mu.Unlock()
+
+	for _, s := range idle {
+		p.closeSession(s)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDialer dials sessions against in-memory devices that reply `<ok/>` to
+// everything.
+type testDialer struct {
+	mu      sync.Mutex
+	dialed  map[string]int
+	servers []*pipeTransport
+}
+
+func (d *testDialer) Dial(ctx context.Context, target string) (*Session, error) {
+	client, server := newPipeTransports()
+	go serveOK(server)
+
+	d.mu.Lock()
+	if d.dialed == nil {
+		d.dialed = make(map[string]int)
+	}
+	d.dialed[target]++
+	d.servers = append(d.servers, server)
+	d.mu.Unlock()
+
+	s := newSession(client)
+	go s.recv()
+	return s, nil
+}
+
+func (d *testDialer) count(target string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dialed[target]
+}
+
+func TestPoolReuse(t *testing.T) {
+	d := &testDialer{}
+	p := NewPool(d)
+	defer p.Close()
+
+	ctx := context.Background()
+	s1, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	release()
+	// releasing twice should be harmless
+	release()
+
+	s2, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	defer release()
+
+	assert.Same(t, s1, s2)
+	assert.Equal(t, 1, d.count("router1"))
+
+	// different targets get their own sessions
+	s3, release3, err := p.Get(ctx, "router2")
+	require.NoError(t, err)
+	defer release3()
+
+	assert.NotSame(t, s1, s3)
+	assert.Equal(t, 1, d.count("router2"))
+}
+
+func TestPoolMaxSessions(t *testing.T) {
+	d := &testDialer{}
+	p := NewPool(d, WithMaxSessions(2))
+	defer p.Close()
+
+	ctx := context.Background()
+	_, release1, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	_, release2, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+
+	// pool is full so this should time out
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, _, err = p.Get(tctx, "router1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// blocked caller is woken up when a session is released
+	got := make(chan error)
+	go func() {
+		_, release, err := p.Get(ctx, "router1")
+		if err == nil {
+			release()
+		}
+		got <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	release1()
+
+	select {
+	case err := <-got:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiting Get was not woken up by release")
+	}
+	release2()
+
+	assert.Equal(t, 2, d.count("router1"))
+}
+
+func TestPoolEvictDead(t *testing.T) {
+	d := &testDialer{}
+	p := NewPool(d)
+	defer p.Close()
+
+	ctx := context.Background()
+	s1, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	release()
+
+	// kill the device side of the connection and wait for the session to
+	// notice
+	d.servers[0].Close()
+	select {
+	case <-s1.done:
+	case <-time.After(time.Second):
+		t.Fatal("session did not notice dead transport")
+	}
+
+	s2, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	defer release()
+
+	assert.NotSame(t, s1, s2)
+	assert.Equal(t, 2, d.count("router1"))
+}
+
+func TestPoolEvictProtocolViolation(t *testing.T) {
+	d := &testDialer{}
+	p := NewPool(d)
+	defer p.Close()
+
+	ctx := context.Background()
+	s1, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	release()
+
+	s1.mu.Lock()
+	s1.violation = ErrProtocolViolation
+	s1.mu.Unlock()
+
+	s2, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	defer release()
+
+	assert.NotSame(t, s1, s2)
+	assert.Equal(t, 2, d.count("router1"))
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	d := &testDialer{}
+	errUnhealthy := errors.New("unhealthy")
+	var checks int
+	p := NewPool(d, WithHealthCheck(func(ctx context.Context, s *Session) error {
+		checks++
+		if checks == 1 {
+			return errUnhealthy
+		}
+		_, err := s.Do(ctx, "<get/>")
+		return err
+	}))
+	defer p.Close()
+
+	ctx := context.Background()
+	s1, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	release()
+
+	// first check fails so a new session should be dialed
+	s2, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	release()
+	assert.NotSame(t, s1, s2)
+
+	// second check passes and the session is reused
+	s3, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	release()
+	assert.Same(t, s2, s3)
+	assert.Equal(t, 2, d.count("router1"))
+}
+
+func TestPoolIdleEviction(t *testing.T) {
+	d := &testDialer{}
+	p := NewPool(d, WithIdleTimeout(time.Minute))
+	defer p.Close()
+
+	ctx := context.Background()
+	s1, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	release()
+
+	p.evictIdle(time.Now().Add(2 * time.Minute))
+
+	s2, release, err := p.Get(ctx, "router1")
+	require.NoError(t, err)
+	defer release()
+
+	assert.NotSame(t, s1, s2)
+	select {
+	case <-s1.done:
+	case <-time.After(time.Second):
+		t.Fatal("idle session was not closed")
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	p := NewPool(&testDialer{})
+	require.NoError(t, p.Close())
+
+	_, _, err := p.Get(context.Background(), "router1")
+	assert.ErrorIs(t, err, ErrPoolClosed)
+}
+
+func TestPoolCanceledHealthCheck(t *testing.T) {
+	d := &testDialer{}
+	// cancel the caller's context in the middle of the health check
+	var cancelCheck context.CancelFunc
+	p := NewPool(d, WithHealthCheck(func(ctx context.Context, s *Session) error {
+		if cancelCheck != nil {
+			cancelCheck()
+			return ctx.Err()
+		}
+		return nil
+	}))
+	defer p.Close()
+
+	ctx := context.Background()
+	var released []func()
+	var sessions []*Session
+	for i := 0; i < 2; i++ {
+		s, release, err := p.Get(ctx, "router1")
+		require.NoError(t, err)
+		sessions = append(sessions, s)
+		released = append(released, release)
+	}
+	for _, release := range released {
+		release()
+	}
+
+	// a canceled caller must not cause healthy idle sessions to be evicted
+	cctx, cancel := context.WithCancel(ctx)
+	cancelCheck = cancel
+	_, _, err := p.Get(cctx, "router1")
+	assert.ErrorIs(t, err, context.Canceled)
+	cancelCheck = nil
+
+	for i := 0; i < 2; i++ {
+		s, release, err := p.Get(ctx, "router1")
+		require.NoError(t, err)
+		defer release()
+		assert.Contains(t, sessions, s)
+	}
+	assert.Equal(t, 2, d.count("router1"))
+}
@@ -0,0 +1,117 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Retrier runs rpcs on a session to a single target and, when an rpc could
+// not be written to the transport (see [ErrWriteFailed]), redials the session
+// and tries again.  Errors returned by the device (i.e an [RPCError]) and any
+// other errors are never retried as the device may have already acted on the
+// rpc.
+//
+// A Retrier is safe for concurrent use.
+type Retrier struct {
+	dialer       Dialer
+	target       string
+	retries      int
+	closeTimeout time.Duration
+
+	mu   sync.Mutex
+	sess *Session
+}
+
+// NewRetrier returns a new Retrier that opens sessions to `target` with
+// `dialer` and retries each rpc up to `retries` times.  The session is only
+// dialed on first use.
+func NewRetrier(dialer Dialer, target string, retries int) *Retrier {
+	return &Retrier{
+		dialer:       dialer,
+		target:       target,
+		retries:      retries,
+		closeTimeout: 5 * time.Second,
+	}
+}
+
+// session returns the current session dialing a new one if there is none.
+func (r *Retrier) session(ctx context.Context) (*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sess != nil {
+		return r.sess, nil
+	}
+
+	s, err := r.dialer.Dial(ctx, r.target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %q: %w", r.target, err)
+	}
+	r.sess = s
+	return s, nil
+}
+
+// reset drops the session (if it is still the current one) so the next
+// attempt dials a new one.
+func (r *Retrier) reset(s *Session) {
+	r.mu.Lock()
+	if r.sess == s {
+		r.sess = nil
+	}
+	r.mu.Unlock()
+
+	// the transport is broken so there is no point sending a close-session.
+	s.tr.Close()
+}
+
+// Do calls fn with the current session.  If fn returns an error wrapping
+// [ErrWriteFailed] the session is closed and fn is called again on a newly
+// dialed session, up to the number of retries given to [NewRetrier].  The
+// error from the last attempt is returned.
+//
+//	err := r.Do(ctx, func(ctx context.Context, s *netconf.Session) error {
+//		return s.EditConfig(ctx, netconf.Running, cfg)
+//	})
+func (r *Retrier) Do(ctx context.Context, fn func(ctx context.Context, s *Session) error) error {
+	for attempt := 0; ; attempt++ {
+		s, err := r.session(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = fn(ctx, s)
+		if err == nil || !errors.Is(err, ErrWriteFailed) {
+			return err
+		}
+
+		r.reset(s)
+		if attempt >= r.retries {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the current session, if any.
+func (r *Retrier) Close() error {
+	r.mu.Lock()
+	s := r.sess
+	r.sess = nil
+	r.mu.Unlock()
+
+	if s == nil {
+		return nil
+	}
+	if !s.alive() {
+		return s.tr.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.closeTimeout)
+	defer cancel()
+	return s.Close(ctx)
+}
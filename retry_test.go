@@ -0,0 +1,68 @@
+package netconf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrier(t *testing.T) {
+	tt := []struct {
+		name string
+		// broken is the number of dialed sessions whose transport is already
+		// gone.
+		broken    int
+		failOp    string
+		retries   int
+		wantErr   error
+		wantDials int
+		wantCalls int
+	}{
+		{"ok", 0, "", 2, nil, 1, 1},
+		{"transport error", 1, "", 2, nil, 2, 2},
+		{"retries exhausted", 3, "", 2, ErrWriteFailed, 3, 3},
+		{"rpc error", 0, "lock", 2, RPCError{}, 1, 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var dials int
+			dialer := DialerFunc(func(ctx context.Context, target string) (*Session, error) {
+				dials++
+				client, server := newPipeTransports()
+				if dials <= tc.broken {
+					server.Close()
+				} else {
+					go serveDeploy(server, tc.failOp, make(chan string, 16))
+				}
+
+				s := newSession(client)
+				go s.recv()
+				return s, nil
+			})
+
+			r := NewRetrier(dialer, "router1", tc.retries)
+			defer r.Close()
+
+			var calls int
+			err := r.Do(context.Background(), func(ctx context.Context, s *Session) error {
+				calls++
+				return s.Lock(ctx, Candidate)
+			})
+
+			switch want := tc.wantErr.(type) {
+			case nil:
+				require.NoError(t, err)
+			case RPCError:
+				assert.ErrorAs(t, err, &want)
+				assert.NotErrorIs(t, err, ErrWriteFailed)
+			default:
+				assert.ErrorIs(t, err, want)
+			}
+			assert.Equal(t, tc.wantDials, dials)
+			assert.Equal(t, tc.wantCalls, calls)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package netconf
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/xml"
 	"errors"
@@ -8,18 +10,57 @@ import (
 	"io"
 	"log"
 	"net"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/dau71/netconf/transport"
 )
 
 var ErrClosed = errors.New("closed connection")
 
+// ErrProtocolViolation is the error returned from [Session.Err] after the
+// device broke the protocol in a way that means the session can no longer be
+// trusted (i.e by replying twice to the same rpc).
+var ErrProtocolViolation = errors.New("netconf: protocol violation")
+
+// ErrWriteFailed is wrapped by errors from writing a message to the transport
+// (as opposed to errors marshaling the message or errors returned by the
+// device) which means the rpc never made it to the device.
+var ErrWriteFailed = errors.New("netconf: failed to write to transport")
+
+// ErrMessageIDMismatch is returned from a pending rpc that was failed because
+// the device sent an `<rpc-reply>` with an unknown or missing message-id while
+// using [WithLenientMessageIDs].
+var ErrMessageIDMismatch = errors.New("netconf: rpc-reply message-id does not match any pending request")
+
 type sessionConfig struct {
 	capabilities        []string
 	notificationHandler NotificationHandler
+	unsolicitedHandler  func(Reply)
+	notifBufSize        int
+	notifPolicy         NotificationPolicy
+	lenientMessageIDs   bool
+	cancelCloses        bool
+	synchronous         bool
+	requestRewriter     func([]byte) ([]byte, error)
+	replyRewriter       func([]byte) ([]byte, error)
+	helloRewriter       func([]byte) ([]byte, error)
+	requiredCaps        []string
+	capGuard            func(Capabilities) error
+	forceChunked        bool
+	helloOrder          HelloOrder
+	lenientHello        bool
+	validateTargets     bool
+	capEnforcement      CapabilityEnforcement
+	writeTimeout        time.Duration
+	maxOutstanding      int
+	indent              string
+	getConfigFallback   bool
 }
 
 type SessionOption interface {
@@ -48,6 +89,355 @@ func WithNotificationHandler(nh NotificationHandler) SessionOption {
 	return notificationHandlerOpt(nh)
 }
 
+type notificationBufferOpt struct {
+	size   int
+	policy NotificationPolicy
+}
+
+func (o notificationBufferOpt) apply(cfg *sessionConfig) {
+	cfg.notifBufSize = o.size
+	cfg.notifPolicy = o.policy
+}
+
+// WithNotificationBuffer calls the notification handler from it's own
+// goroutine with up to `size` notifications buffered between it and the
+// receive loop.  `policy` decides what happens when a notification arrives
+// while the buffer is full.  By default the handler is called directly from
+// the receive loop so a slow handler holds up every rpc reply.
+//
+// Ignored in synchronous mode or without a notification handler.
+func WithNotificationBuffer(size int, policy NotificationPolicy) SessionOption {
+	return notificationBufferOpt{size: size, policy: policy}
+}
+
+type lenientMessageIDsOpt struct{}
+
+func (o lenientMessageIDsOpt) apply(cfg *sessionConfig) {
+	cfg.lenientMessageIDs = true
+}
+
+// WithLenientMessageIDs changes how replies with an unknown or missing
+// message-id are handled.  By default (strict) such replies are logged and
+// dropped which leaves the rpc they were meant for waiting until it's context
+// is done.  With lenient matching the oldest pending rpc is failed with
+// [ErrMessageIDMismatch] instead, which is useful for devices that are known
+// to mangle message-ids.  Replies with the message-id of an rpc that was sent
+// but is no longer pending (i.e a late reply to an rpc whose context was done)
+// are still dropped as they can't be meant for another rpc.
+func WithLenientMessageIDs() SessionOption {
+	return lenientMessageIDsOpt{}
+}
+
+type unsolicitedHandlerOpt func(Reply)
+
+func (o unsolicitedHandlerOpt) apply(cfg *sessionConfig) {
+	cfg.unsolicitedHandler = o
+}
+
+// WithUnsolicitedReplyHandler sets a function called with every `<rpc-reply>`
+// that doesn't answer any rpc sent on the session instead of logging and
+// dropping it.  These are replies with a message-id that was never used or
+// without a message-id at all which some devices push as a vendor specific
+// notification mechanism.  With [WithLenientMessageIDs] a reply missing it's
+// message-id still fails the oldest pending rpc if there is one.
+//
+// A second reply to an rpc that was already answered is still a protocol
+// violation (see [Session.Err]) and is never passed to the handler.  The
+// handler is called from the receive loop so it must not block.
+func WithUnsolicitedReplyHandler(fn func(Reply)) SessionOption {
+	return unsolicitedHandlerOpt(fn)
+}
+
+type cancelClosesOpt bool
+
+func (o cancelClosesOpt) apply(cfg *sessionConfig) {
+	cfg.cancelCloses = bool(o)
+}
+
+// WithCancelClosesTransport controls what happens when the context of an rpc
+// is done before the reply is received.
+//
+// NETCONF has no way to cancel a single rpc (and a `<kill-session>` of our own
+// session-id is invalid) so the device will keep working on it and
+// eventually send the reply.  By default the reply is dropped when it arrives
+// which leaves the session usable but the device busy, possibly for minutes
+// with a large `<get>`.  When set to true the transport is closed instead so
+// that the device stops working on the request, at the cost of the session.
+func WithCancelClosesTransport(closeTransport bool) SessionOption {
+	return cancelClosesOpt(closeTransport)
+}
+
+type synchronousOpt struct{}
+
+func (o synchronousOpt) apply(cfg *sessionConfig) {
+	cfg.synchronous = true
+}
+
+// WithSynchronous opens the session in synchronous mode.  No background
+// goroutine is started to receive messages, instead [Session.Do] writes the
+// request and reads messages inline until it's reply is received.  Only one rpc
+// can be in flight at a time (concurrent calls are serialized).  This is
+// intended for simple single threaded request/reply tooling.
+//
+// Notifications are not supported in synchronous mode.  Any notifications that
+// happen to arrive while waiting on a reply are passed to the notification
+// handler, everything else is never read.  [Session.ReadHello] is not
+// supported either.
+//
+// A context deadline is only honored while reading if the transport supports
+// read deadlines (i.e has a `SetReadDeadline(time.Time) error` method like the
+// ones built on [transport.Framer]).
+func WithSynchronous() SessionOption {
+	return synchronousOpt{}
+}
+
+type requestRewriterOpt func([]byte) ([]byte, error)
+
+func (o requestRewriterOpt) apply(cfg *sessionConfig) {
+	cfg.requestRewriter = o
+}
+
+// WithRequestRewriter sets a function that is called with every outgoing
+// message (including the `<hello>`) after it has been marshaled but before it
+// is framed and written to the transport.  The returned bytes are sent in it's
+// place.  This can be used to work around devices that need non-standard
+// tweaks such as a vendor attribute on `<rpc>`.  Returning an error fails the
+// rpc without anything being sent.
+func WithRequestRewriter(fn func([]byte) ([]byte, error)) SessionOption {
+	return requestRewriterOpt(fn)
+}
+
+type replyRewriterOpt func([]byte) ([]byte, error)
+
+func (o replyRewriterOpt) apply(cfg *sessionConfig) {
+	cfg.replyRewriter = o
+}
+
+// WithReplyRewriter sets a function that is called with every incoming message
+// (including the `<hello>`) before it is decoded.  This can be used to
+// normalize broken replies from a device.  Messages the function returns an
+// error for are dropped.
+func WithReplyRewriter(fn func([]byte) ([]byte, error)) SessionOption {
+	return replyRewriterOpt(fn)
+}
+
+type helloRewriterOpt func([]byte) ([]byte, error)
+
+func (o helloRewriterOpt) apply(cfg *sessionConfig) {
+	cfg.helloRewriter = o
+}
+
+// WithHelloRewriter sets a function that is called with the server `<hello>`
+// only (after any [WithReplyRewriter]) before it is parsed.  This can be used
+// to fix up devices sending slightly malformed hellos such as duplicate
+// capabilities or whitespace in the capability URIs.  Returning an error fails
+// [Open].
+func WithHelloRewriter(fn func([]byte) ([]byte, error)) SessionOption {
+	return helloRewriterOpt(fn)
+}
+
+type requiredCapsOpt []string
+
+func (o requiredCapsOpt) apply(cfg *sessionConfig) {
+	cfg.requiredCaps = append(cfg.requiredCaps, o...)
+}
+
+// WithRequiredCapabilities makes [Open] fail with a [*MissingCapabilitiesError]
+// (closing the transport) unless the device advertises all of the given
+// capabilities.  See [Session.RequireCapabilities] for how they are matched.
+func WithRequiredCapabilities(urns ...string) SessionOption {
+	return requiredCapsOpt(urns)
+}
+
+type capGuardOpt func(Capabilities) error
+
+func (o capGuardOpt) apply(cfg *sessionConfig) {
+	cfg.capGuard = o
+}
+
+// WithCapabilityGuard calls `guard` with the capabilities the device
+// advertised right after the hello exchange and before any rpc is sent.  If
+// it returns an error [Open] fails with it wrapped (closing the transport).
+// This is meant for enforcing a policy such as refusing devices that
+// advertise a deprecated capability.
+func WithCapabilityGuard(guard func(Capabilities) error) SessionOption {
+	return capGuardOpt(guard)
+}
+
+type forceChunkedOpt struct{}
+
+func (o forceChunkedOpt) apply(cfg *sessionConfig) {
+	cfg.forceChunked = true
+}
+
+// WithForceChunked only advertises `:base:1.1` (and not `:base:1.0`) in the
+// client hello so that the session always uses Chunked framing.  [Open] fails
+// if the device doesn't advertise `:base:1.1`.  This is useful for testing
+// chunked framing and for devices that misbehave with `:base:1.0`.
+func WithForceChunked() SessionOption {
+	return forceChunkedOpt{}
+}
+
+// HelloOrder is the order the `<hello>` messages are exchanged in when opening
+// a session.
+type HelloOrder int
+
+const (
+	// HelloSimultaneous sends the client hello while reading the server hello
+	// as described in [RFC6241 8.1].  This works with devices that send first
+	// and with ones that wait for the client.  In synchronous mode (see
+	// [WithSynchronous]) the client hello is sent first instead as the
+	// transport is only read after writing.
+	//
+	// [RFC6241 8.1]: https://www.rfc-editor.org/rfc/rfc6241.html#section-8.1
+	HelloSimultaneous HelloOrder = iota
+
+	// HelloClientFirst sends the client hello before reading the server
+	// hello.
+	HelloClientFirst
+
+	// HelloServerFirst reads the server hello before sending the client
+	// hello.
+	HelloServerFirst
+)
+
+type helloOrderOpt HelloOrder
+
+func (o helloOrderOpt) apply(cfg *sessionConfig) {
+	cfg.helloOrder = HelloOrder(o)
+}
+
+// WithHelloOrder sets the order the hello messages are exchanged in.  The
+// default of [HelloSimultaneous] should work with any device; the others are
+// for transports that can't have a read and write in flight at the same time.
+func WithHelloOrder(order HelloOrder) SessionOption {
+	return helloOrderOpt(order)
+}
+
+type lenientHelloOpt struct{}
+
+func (o lenientHelloOpt) apply(cfg *sessionConfig) {
+	cfg.lenientHello = true
+}
+
+// WithLenientHelloFraming retries parsing the server hello as a chunk-framed
+// message when it fails to parse as the End-of-Message framed message RFC6242
+// requires.  The transport already detects a hello starting with a chunk
+// header; this is for non-compliant devices where that doesn't work (i.e no
+// leading newline before the first chunk header) but the hello is still
+// terminated with an End-of-Message marker.  Which framing was used is
+// logged when the fallback is needed.
+func WithLenientHelloFraming() SessionOption {
+	return lenientHelloOpt{}
+}
+
+type validateTargetsOpt struct{}
+
+func (o validateTargetsOpt) apply(cfg *sessionConfig) {
+	cfg.validateTargets = true
+}
+
+// WithTargetValidation makes [Session.EditConfig] check that the target
+// datastore is writable according to the capabilities of the device before
+// sending anything: `running` requires `:writable-running` and `candidate`
+// requires `:candidate`.  A [*MissingCapabilitiesError] naming the capability
+// is returned otherwise.
+func WithTargetValidation() SessionOption {
+	return validateTargetsOpt{}
+}
+
+// CapabilityEnforcement is what operations do when the device doesn't
+// advertise a capability they need.
+type CapabilityEnforcement int
+
+const (
+	// CapabilityStrict fails the operation with an error without sending
+	// anything to the device.
+	CapabilityStrict CapabilityEnforcement = iota
+
+	// CapabilityLenient logs a warning and sends the rpc anyway for devices
+	// that support operations without advertising the capability.
+	CapabilityLenient
+)
+
+type capEnforcementOpt CapabilityEnforcement
+
+func (o capEnforcementOpt) apply(cfg *sessionConfig) {
+	cfg.capEnforcement = CapabilityEnforcement(o)
+}
+
+// WithCapabilityEnforcement sets whether the capability checks done by
+// operations (i.e `:rollback-on-error` for [WithErrorStrategy], `:url` for
+// [URL] and the ones from [WithTargetValidation]) block the rpc.  Defaults to
+// [CapabilityStrict].  This doesn't affect [WithRequiredCapabilities] or
+// [Session.RequireCapabilities].
+func WithCapabilityEnforcement(e CapabilityEnforcement) SessionOption {
+	return capEnforcementOpt(e)
+}
+
+type writeTimeoutOpt time.Duration
+
+func (o writeTimeoutOpt) apply(cfg *sessionConfig) {
+	cfg.writeTimeout = time.Duration(o)
+}
+
+// WithWriteTimeout aborts writing a rpc that takes longer than `d` (i.e
+// because the connection is half-open and the send buffer has filled up).  The
+// rpc fails with an error wrapping both [ErrWriteFailed] and
+// [os.ErrDeadlineExceeded] and the session is closed since part of the
+// message may have been sent.  This needs a transport with write deadlines
+// (i.e has a `SetWriteDeadline(time.Time) error` method like the ones built on
+// [transport.Framer]) and is ignored otherwise.
+func WithWriteTimeout(d time.Duration) SessionOption {
+	return writeTimeoutOpt(d)
+}
+
+type indentOpt string
+
+func (o indentOpt) apply(cfg *sessionConfig) {
+	cfg.indent = string(o)
+}
+
+// WithIndent indents the elements of outgoing messages with one `indent` per
+// level of nesting which is easier to read when debugging.  Messages are
+// compact by default as some devices reject pretty-printed XML.  Only the
+// whitespace between elements changes; the text of elements and raw XML (i.e
+// the config of an `<edit-config>`) are sent as is.
+func WithIndent(indent string) SessionOption {
+	return indentOpt(indent)
+}
+
+type getConfigFallbackOpt struct{}
+
+func (getConfigFallbackOpt) apply(cfg *sessionConfig) {
+	cfg.getConfigFallback = true
+}
+
+// WithGetConfigFallback retries a [Session.Get] the device rejects with
+// `access-denied` as a `<get-config>` of the running datastore with the same
+// filter for read-only accounts that may read the config but not state data.
+// The fallback is logged and returns only config, never state data.
+func WithGetConfigFallback() SessionOption {
+	return getConfigFallbackOpt{}
+}
+
+type maxOutstandingOpt int
+
+func (o maxOutstandingOpt) apply(cfg *sessionConfig) {
+	cfg.maxOutstanding = int(o)
+}
+
+// WithMaxOutstandingRPCs limits the number of rpcs waiting on a reply at the
+// same time to `n` for devices that fail when too many are in flight on one
+// session.  Further rpcs block until one of the outstanding ones completes or
+// their context is done.  An rpc given up on because it's context is done
+// frees it's slot even though the device may still be working on it.  A `n`
+// of 0 (the default) means no limit.  This has no effect with
+// [WithSynchronous] which only ever has one rpc outstanding.
+func WithMaxOutstandingRPCs(n int) SessionOption {
+	return maxOutstandingOpt(n)
+}
+
 // Session is represents a netconf session to a one given device.
 type Session struct {
 	tr        transport.Transport
@@ -55,18 +445,77 @@ type Session struct {
 	seq       atomic.Uint64
 
 	clientCaps          capabilitySet
+	capsMu              sync.RWMutex
 	serverCaps          capabilitySet
 	notificationHandler NotificationHandler
+	unsolicitedHandler  func(Reply)
+	// notifQueue is set when notifications are buffered (see
+	// WithNotificationBuffer).
+	notifQueue *notificationQueue
+	// notifWaiters are the calls to WaitForNotification waiting on a
+	// notification.  This has it's own lock as mu is held while writing.
+	notifMu      sync.Mutex
+	notifWaiters map[*notifWaiter]struct{}
+	// subs are the subscriptions created with Subscribe in the order they
+	// were created.  subsClosed is set once the receive loop has exited.
+	subs              []*Subscription
+	subsClosed        bool
+	lenientMessageIDs bool
+	cancelCloses      bool
+	synchronous       bool
+	requestRewriter   func([]byte) ([]byte, error)
+	replyRewriter     func([]byte) ([]byte, error)
+	helloRewriter     func([]byte) ([]byte, error)
+	requiredCaps      []string
+	capGuard          func(Capabilities) error
+	forceChunked      bool
+	helloOrder        HelloOrder
+	lenientHello      bool
+	validateTargets   bool
+	capEnforcement    CapabilityEnforcement
+	writeTimeout      time.Duration
+	indent            string
+	getConfigFallback bool
+	// outstanding has a slot for each rpc that may be outstanding when
+	// limited with WithMaxOutstandingRPCs.
+	outstanding chan struct{}
+	// framing is the framing negotiated in the hello.
+	framing transport.FramingVersion
+
+	// syncMu serializes rpcs in synchronous mode.
+	syncMu sync.Mutex
+
+	yangLib yangLibCache
 
 	mu      sync.Mutex
 	reqs    map[uint64]*req
 	closing bool
+	// replied are the message-ids of the most recently answered rpcs used to
+	// detect duplicate replies.
+	replied     [recentReplies]uint64
+	repliedNext int
+	// abandoned are the message-ids of the most recent rpcs given up on
+	// before their reply was received.
+	abandoned     [recentReplies]uint64
+	abandonedNext int
+	// violation is the first protocol violation by the device.
+	violation error
+	// helloWaiter is set while a call to ReadHello is waiting on a hello
+	// from the device.
+	helloWaiter chan helloMsg
+
+	// done is closed when the receive loop exits (i.e the transport is no
+	// longer usable).
+	done chan struct{}
 }
 
 // NotificationHandler function allows to work with received notifications.
 // A NotificationHandler function can be passed in as an option when calling Open method of Session object
 // A typical use of the NofificationHandler function is to retrieve notifications once they are received so
 // that they can be parsed and/or stored somewhere.
+//
+// Devices that batch several `<notification>` elements into a single message
+// are supported; the handler is called once for each of them in order.
 type NotificationHandler func(msg Notification)
 
 func newSession(transport transport.Transport, opts ...SessionOption) *Session {
@@ -78,11 +527,45 @@ func newSession(transport transport.Transport, opts ...SessionOption) *Session {
 		opt.apply(&cfg)
 	}
 
+	capabilities := cfg.capabilities
+	if cfg.forceChunked {
+		capabilities = []string{baseCap11}
+		for _, cap := range cfg.capabilities {
+			if cap != baseCap10 && cap != baseCap11 {
+				capabilities = append(capabilities, cap)
+			}
+		}
+	}
+
 	s := &Session{
 		tr:                  transport,
-		clientCaps:          newCapabilitySet(cfg.capabilities...),
+		clientCaps:          newCapabilitySet(capabilities...),
 		reqs:                make(map[uint64]*req),
 		notificationHandler: cfg.notificationHandler,
+		unsolicitedHandler:  cfg.unsolicitedHandler,
+		lenientMessageIDs:   cfg.lenientMessageIDs,
+		cancelCloses:        cfg.cancelCloses,
+		synchronous:         cfg.synchronous,
+		requestRewriter:     cfg.requestRewriter,
+		replyRewriter:       cfg.replyRewriter,
+		helloRewriter:       cfg.helloRewriter,
+		requiredCaps:        cfg.requiredCaps,
+		capGuard:            cfg.capGuard,
+		forceChunked:        cfg.forceChunked,
+		helloOrder:          cfg.helloOrder,
+		lenientHello:        cfg.lenientHello,
+		validateTargets:     cfg.validateTargets,
+		capEnforcement:      cfg.capEnforcement,
+		writeTimeout:        cfg.writeTimeout,
+		indent:              cfg.indent,
+		getConfigFallback:   cfg.getConfigFallback,
+		done:                make(chan struct{}),
+	}
+	if cfg.maxOutstanding > 0 {
+		s.outstanding = make(chan struct{}, cfg.maxOutstanding)
+	}
+	if cfg.notifBufSize > 0 && cfg.notificationHandler != nil && !cfg.synchronous {
+		s.notifQueue = newNotificationQueue(cfg.notifBufSize, cfg.notifPolicy)
 	}
 	return s
 }
@@ -98,154 +581,798 @@ func Open(transport transport.Transport, opts ...SessionOption) (*Session, error
 		return nil, err
 	}
 
-	go s.recv()
+	if s.capGuard != nil {
+		if err := s.capGuard(s.Capabilities()); err != nil {
+			s.tr.Close()
+			return nil, fmt.Errorf("device rejected by capability guard: %w", err)
+		}
+	}
+
+	if err := s.RequireCapabilities(s.requiredCaps...); err != nil {
+		s.tr.Close()
+		return nil, err
+	}
+
+	if !s.synchronous {
+		go s.recv()
+	}
 	return s, nil
 }
 
 // handshake exchanges handshake messages and reports if there are any errors.
 func (s *Session) handshake() error {
-	clientMsg := helloMsg{
-		Capabilities: s.clientCaps.All(),
+	writeHello := func() error {
+		clientMsg := helloMsg{
+			Capabilities: s.clientCaps.All(),
+		}
+		if err := s.writeMsg(&clientMsg); err != nil {
+			return fmt.Errorf("failed to write hello message: %w", err)
+		}
+		return nil
+	}
+
+	order := s.helloOrder
+	if order == HelloSimultaneous && s.synchronous {
+		order = HelloClientFirst
+	}
+
+	var serverMsg helloMsg
+	switch order {
+	case HelloClientFirst:
+		if err := writeHello(); err != nil {
+			return err
+		}
+		if err := s.readHello(&serverMsg); err != nil {
+			return err
+		}
+	case HelloServerFirst:
+		if err := s.readHello(&serverMsg); err != nil {
+			return err
+		}
+		if err := writeHello(); err != nil {
+			return err
+		}
+	default:
+		// buffered so the writer doesn't leak when the read fails (the
+		// transport is closed by the caller which unblocks it).
+		writeErr := make(chan error, 1)
+		go func() { writeErr <- writeHello() }()
+		if err := s.readHello(&serverMsg); err != nil {
+			return err
+		}
+		// the client hello must be fully written before the transport can
+		// be upgraded below.
+		if err := <-writeErr; err != nil {
+			return err
+		}
 	}
-	if err := s.writeMsg(&clientMsg); err != nil {
-		return fmt.Errorf("failed to write hello message: %w", err)
+
+	if serverMsg.SessionID == 0 {
+		return fmt.Errorf("server did not return a session-id")
+	}
+
+	if len(serverMsg.Capabilities) == 0 {
+		return fmt.Errorf("server did not return any capabilities")
+	}
+
+	s.serverCaps = newCapabilitySet(serverMsg.Capabilities...)
+	s.sessionID = serverMsg.SessionID
+
+	if s.forceChunked && !s.serverCaps.Has(baseCap11) {
+		return fmt.Errorf("server does not support :base:1.1 which is required for chunked framing")
+	}
+
+	// upgrade the transport if we are on a larger version and the transport
+	// supports it.
+	if s.serverCaps.Has(baseCap11) && s.clientCaps.Has(baseCap11) {
+		if upgrader, ok := s.tr.(interface{ Upgrade() }); ok {
+			upgrader.Upgrade()
+			s.framing = transport.Chunked
+		}
 	}
 
-	r, err := s.tr.MsgReader()
+	return nil
+}
+
+// readHello reads the server hello during the handshake.
+func (s *Session) readHello(msg *helloMsg) error {
+	r, err := s.msgReader(context.Background())
 	if err != nil {
 		return err
 	}
 	// TODO: capture this error some how (ah defer and errors)
 	defer r.Close()
 
-	var serverMsg helloMsg
-	if err := xml.NewDecoder(r).Decode(&serverMsg); err != nil {
+	if !s.lenientHello && s.helloRewriter == nil {
+		if err := xml.NewDecoder(r).Decode(msg); err != nil {
+			return fmt.Errorf("failed to read server hello message: %w", err)
+		}
+		return nil
+	}
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
 		return fmt.Errorf("failed to read server hello message: %w", err)
 	}
+	if s.helloRewriter != nil {
+		if raw, err = s.helloRewriter(raw); err != nil {
+			return fmt.Errorf("hello rewriter failed: %w", err)
+		}
+	}
 
-	if serverMsg.SessionID == 0 {
-		return fmt.Errorf("server did not return a session-id")
+	if !s.lenientHello {
+		if err := xml.Unmarshal(raw, msg); err != nil {
+			return fmt.Errorf("failed to read server hello message: %w", err)
+		}
+		return nil
+	}
+	return decodeLenientHello(raw, msg)
+}
+
+// decodeLenientHello decodes the hello as it was framed by the transport
+// falling back to removing chunked framing from it.
+func decodeLenientHello(raw []byte, msg *helloMsg) error {
+	err := xml.Unmarshal(raw, msg)
+	if err == nil {
+		return nil
+	}
+
+	// the chunk reader requires the leading newline some devices leave out.
+	chunked := append([]byte("\n"), bytes.TrimLeft(raw, " \t\r\n")...)
+	f := transport.NewFramer(bytes.NewReader(chunked), io.Discard)
+	f.UpgradeReader()
+	r, _ := f.MsgReader()
+	unchunked, chunkErr := io.ReadAll(r)
+	if chunkErr != nil {
+		return fmt.Errorf("failed to read server hello message: %w", err)
+	}
+
+	*msg = helloMsg{}
+	if chunkErr := xml.Unmarshal(unchunked, msg); chunkErr != nil {
+		return fmt.Errorf("failed to read server hello message: %w (or as chunk-framed: %v)", err, chunkErr)
+	}
+	log.Printf("netconf: server hello failed to parse with end-of-message framing, parsed it as chunk-framed instead")
+	return nil
+}
+
+// SessionID returns the current session ID exchanged in the hello messages.
+// Will return 0 if there is no session ID.
+func (s *Session) SessionID() uint64 {
+	return s.sessionID
+}
+
+// alive reports if the receive loop for the session is still running.  Once the
+// underlying transport has gone away a session can never be used again.
+func (s *Session) alive() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
 	}
+}
+
+// ClientCapabilities will return the capabilities initialized with the session.
+func (s *Session) ClientCapabilities() []string {
+	return s.clientCaps.All()
+}
+
+// ServerCapabilities will return the capabilities returned by the server in
+// it's hello message.
+func (s *Session) ServerCapabilities() []string {
+	return s.serverCapSet().All()
+}
+
+// Capabilities returns the capabilities the device advertised in it's hello.
+func (s *Session) Capabilities() Capabilities {
+	return Capabilities{set: s.serverCapSet()}
+}
+
+// RawServerCapabilities returns the capabilities from the server hello exactly
+// as they were received and in the same order, including any duplicates and
+// query parameters.  Unlike [Session.ServerCapabilities] nothing is
+// normalized so this is suitable for auditing what the device advertised.
+func (s *Session) RawServerCapabilities() []string {
+	raw := s.serverCapSet().raw
+	return append(make([]string, 0, len(raw)), raw...)
+}
+
+// MissingCapabilitiesError is returned when a device doesn't advertise
+// capabilities that are required with [Session.RequireCapabilities] or
+// [WithRequiredCapabilities].
+type MissingCapabilitiesError struct {
+	// Missing are the required capabilities that were not advertised, as
+	// they were passed in.
+	Missing []string
+}
+
+func (e *MissingCapabilitiesError) Error() string {
+	return "device is missing required capabilities: " + strings.Join(e.Missing, ", ")
+}
+
+// RequireCapabilities checks that the device advertised all of the given
+// capabilities returning a [*MissingCapabilitiesError] listing the ones that
+// are missing.  The standard prefix is added the same as [ExpandCapability]
+// (i.e `:candidate:1.0`) and any parameters on the advertised capability (i.e
+// `?scheme=file`) are ignored unless `urn` has parameters of it's own.
+func (s *Session) RequireCapabilities(urns ...string) error {
+	caps := s.serverCapSet()
+
+	var missing []string
+	for _, urn := range urns {
+		if !caps.advertises(urn) {
+			missing = append(missing, urn)
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingCapabilitiesError{Missing: missing}
+	}
+	return nil
+}
+
+// enforceCapability returns the error from a failed capability check of an
+// operation unless using [CapabilityLenient] in which case it is only logged.
+func (s *Session) enforceCapability(err error) error {
+	if err == nil || s.capEnforcement == CapabilityStrict {
+		return err
+	}
+	log.Printf("netconf: %v (sending anyway)", err)
+	return nil
+}
+
+func (s *Session) serverCapSet() capabilitySet {
+	s.capsMu.RLock()
+	defer s.capsMu.RUnlock()
+	return s.serverCaps
+}
+
+// ReadHello waits for the device to send another `<hello>` message on an
+// already established session and replaces the server capabilities with the
+// ones it advertises.
+//
+// This is not part of the NETCONF standard (capabilities are only exchanged
+// once) however some devices send an updated hello after certain operations,
+// like installing new YANG modules.  Hello messages received while ReadHello
+// isn't waiting are dropped.
+func (s *Session) ReadHello(ctx context.Context) error {
+	if s.synchronous {
+		return fmt.Errorf("ReadHello is not supported in synchronous mode")
+	}
+
+	ch := make(chan helloMsg, 1)
+
+	s.mu.Lock()
+	if s.helloWaiter != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("already waiting on a hello message")
+	}
+	s.helloWaiter = ch
+	s.mu.Unlock()
+
+	var hello helloMsg
+	select {
+	case hello = <-ch:
+	case <-s.done:
+		return ErrClosed
+	case <-ctx.Done():
+		s.mu.Lock()
+		if s.helloWaiter == ch {
+			s.helloWaiter = nil
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+
+	if len(hello.Capabilities) == 0 {
+		return fmt.Errorf("server did not return any capabilities")
+	}
+
+	s.capsMu.Lock()
+	s.serverCaps = newCapabilitySet(hello.Capabilities...)
+	s.capsMu.Unlock()
+
+	// the module set may have changed with the capabilities.
+	s.yangLib.mu.Lock()
+	s.yangLib.lib = nil
+	s.yangLib.mu.Unlock()
+
+	return nil
+}
+
+// Stats are counters for a session.
+type Stats struct {
+	// BytesRead is the total number of bytes read from the transport
+	// including any framing. Zero if the transport doesn't keep track.
+	BytesRead uint64
+
+	// BytesWritten is the total number of bytes written to the transport
+	// including any framing.  Zero if the transport doesn't keep track.
+	BytesWritten uint64
+
+	// NotificationsDropped is the number of notifications dropped because the
+	// buffer set with [WithNotificationBuffer] was full.
+	NotificationsDropped uint64
+}
+
+// Stats returns the current counters for the session.  Safe to be called
+// concurrently with any inflight RPCs.
+func (s *Session) Stats() Stats {
+	var stats Stats
+	if st, ok := s.tr.(interface{ Stats() transport.Stats }); ok {
+		trStats := st.Stats()
+		stats.BytesRead = trStats.BytesRead
+		stats.BytesWritten = trStats.BytesWritten
+	}
+	if s.notifQueue != nil {
+		stats.NotificationsDropped = s.notifQueue.dropped.Load()
+	}
+	return stats
+}
+
+// Username returns the NETCONF username of the session as resolved by the
+// transport (i.e from the client certificate for TLS).  It is empty if the
+// transport doesn't know the username.
+func (s *Session) Username() string {
+	if u, ok := s.tr.(interface{ Username() string }); ok {
+		return u.Username()
+	}
+	return ""
+}
+
+// SessionInfo is a summary of what was negotiated for a session returned from
+// [Session.Info].
+type SessionInfo struct {
+	SessionID uint64
+
+	// Framing is the framing used after the hello.
+	Framing transport.FramingVersion
+
+	// Capabilities are the capabilities advertised by both the client and the
+	// device, sorted.
+	Capabilities []string
+
+	// Transport describes the underlying connection (see [transport.Info]).
+	// For transports that don't describe themselves only Type is set, to the
+	// go type of the transport.
+	Transport transport.Info
+}
+
+// Info returns a summary of the negotiated session parameters and the
+// underlying connection for logging and display.
+func (s *Session) Info() SessionInfo {
+	serverCaps := s.serverCapSet()
+	var caps []string
+	for _, cap := range s.clientCaps.All() {
+		if serverCaps.Has(cap) {
+			caps = append(caps, cap)
+		}
+	}
+	sort.Strings(caps)
+
+	info := SessionInfo{
+		SessionID:    s.sessionID,
+		Framing:      s.framing,
+		Capabilities: caps,
+	}
+	if tr, ok := s.tr.(interface{ Info() transport.Info }); ok {
+		info.Transport = tr.Info()
+	} else {
+		info.Transport.Type = fmt.Sprintf("%T", s.tr)
+	}
+	return info
+}
+
+// TransportControl is a narrow view of the transport of an open session for
+// making adjustments to the underlying connection (i.e sending ssh keepalives)
+// without access to the message stream.  It is returned by
+// [Session.Transport].
+type TransportControl struct {
+	s *Session
+}
+
+// Transport returns a [TransportControl] for the session's transport.
+func (s *Session) Transport() *TransportControl {
+	return &TransportControl{s: s}
+}
+
+// Control calls fn with the underlying transport (i.e a `*ssh.Transport`) so
+// it can be adjusted using it's transport specific methods.  No messages are
+// written to the transport while fn is running and in synchronous mode no
+// messages are read either.  In the default mode the session's receive loop
+// may still be blocked reading the next message.
+//
+// fn must not read or write messages (i.e call MsgReader, MsgWriter or Close)
+// as that will corrupt the stream.  ErrClosed is returned without calling fn
+// when the session is closed.
+func (c *TransportControl) Control(fn func(tr any) error) error {
+	s := c.s
+	if s.synchronous {
+		s.syncMu.Lock()
+		defer s.syncMu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing || !s.alive() {
+		return ErrClosed
+	}
+	return fn(s.tr)
+}
+
+// Stats returns the current counters of the transport.  This is the same as
+// [Session.Stats].
+func (c *TransportControl) Stats() Stats {
+	return c.s.Stats()
+}
+
+// startElement will walk though a xml.Decode until it finds a start element
+// and returns it.
+func startElement(d *xml.Decoder) (*xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			return &start, nil
+		}
+	}
+}
+
+// msgError is an error that only affects the message being received.  The
+// session can continue to receive the next message.
+type msgError struct{ error }
+
+func (e msgError) Unwrap() error { return e.error }
+
+// recoverable reports if an error returned from recvMsg was limited to a
+// single bad message.  Any other error (i.e the transport was closed or reset)
+// means no more messages can be read.
+func recoverable(err error) bool {
+	var (
+		mErr      msgError
+		syntaxErr *xml.SyntaxError
+		decErr    xml.UnmarshalError
+	)
+	return errors.As(err, &mErr) || errors.As(err, &syntaxErr) || errors.As(err, &decErr)
+}
+
+func (s *Session) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+type req struct {
+	reply chan Reply
+	ctx   context.Context
+
+	// err is set before reply is closed when the request was failed for
+	// a reason other than the session closing.
+	err error
+
+	// spool is set when the reply's `<data>` is to be streamed to it.
+	spool io.Writer
+	// onError is called with each `<rpc-error>` as the reply is decoded.
+	onError func(RPCError)
+
+	// op and sent are for PendingRPCs.
+	op   any
+	sent time.Time
+}
 
-	if len(serverMsg.Capabilities) == 0 {
-		return fmt.Errorf("server did not return any capabilities")
+// msgReader returns the reader for the next message from the transport with
+// the reply rewriter applied.  Buffering the message for the rewriter is
+// abandoned once ctx is done.
+func (s *Session) msgReader(ctx context.Context) (io.ReadCloser, error) {
+	tr, err := s.tr.MsgReader()
+	if err != nil {
+		return nil, err
 	}
+	var r io.ReadCloser = newBOMReader(tr)
 
-	s.serverCaps = newCapabilitySet(serverMsg.Capabilities...)
-	s.sessionID = serverMsg.SessionID
+	if s.replyRewriter == nil {
+		return r, nil
+	}
 
-	// upgrade the transport if we are on a larger version and the transport
-	// supports it.
-	const baseCap11 = baseCap + ":1.1"
-	if s.serverCaps.Has(baseCap11) && s.clientCaps.Has(baseCap11) {
-		if upgrader, ok := s.tr.(interface{ Upgrade() }); ok {
-			upgrader.Upgrade()
+	msg, err := readAllContext(ctx, r)
+	if err != nil {
+		// closing would read the rest of the message which is what a
+		// canceled read is trying to avoid.  The next reader skips it.
+		if ctx.Err() == nil {
+			r.Close()
 		}
+		return nil, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	msg, err = s.replyRewriter(msg)
+	if err != nil {
+		return nil, msgError{fmt.Errorf("reply rewriter failed: %w", err)}
+	}
+	return io.NopCloser(bytes.NewReader(msg)), nil
 }
 
-// SessionID returns the current session ID exchanged in the hello messages.
-// Will return 0 if there is no session ID.
-func (s *Session) SessionID() uint64 {
-	return s.sessionID
-}
+var utf8BOM = []byte("\xef\xbb\xbf")
 
-// ClientCapabilities will return the capabilities initialized with the session.
-func (s *Session) ClientCapabilities() []string {
-	return s.clientCaps.All()
+// bomReader drops a UTF-8 byte order mark that some devices put at the start
+// of every message.
+type bomReader struct {
+	io.ByteReader
+	io.Reader
+	c io.Closer
+
+	checked bool
+	// pending are bytes read while checking for the BOM that turned out not to
+	// be one.
+	pending []byte
 }
 
-// ServerCapabilities will return the capabilities returned by the server in
-// it's hello message.
-func (s *Session) ServerCapabilities() []string {
-	return s.serverCaps.All()
+func newBOMReader(r io.ReadCloser) *bomReader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		b := bufio.NewReader(r)
+		return &bomReader{ByteReader: b, Reader: b, c: r}
+	}
+	return &bomReader{ByteReader: br, Reader: r, c: r}
 }
 
-// startElement will walk though a xml.Decode until it finds a start element
-// and returns it.
-func startElement(d *xml.Decoder) (*xml.StartElement, error) {
-	for {
-		tok, err := d.Token()
+func (r *bomReader) check() error {
+	r.checked = true
+	for i := range utf8BOM {
+		b, err := r.ByteReader.ReadByte()
 		if err != nil {
-			return nil, err
+			if err == io.EOF && len(r.pending) > 0 {
+				return nil
+			}
+			return err
 		}
+		r.pending = append(r.pending, b)
+		if b != utf8BOM[i] {
+			return nil
+		}
+	}
+	r.pending = nil
+	return nil
+}
 
-		if start, ok := tok.(xml.StartElement); ok {
-			return &start, nil
+func (r *bomReader) ReadByte() (byte, error) {
+	if !r.checked {
+		if err := r.check(); err != nil {
+			return 0, err
 		}
 	}
+	if len(r.pending) > 0 {
+		b := r.pending[0]
+		r.pending = r.pending[1:]
+		return b, nil
+	}
+	return r.ByteReader.ReadByte()
 }
 
-type req struct {
-	reply chan Reply
-	ctx   context.Context
+func (r *bomReader) Read(p []byte) (int, error) {
+	if !r.checked {
+		if err := r.check(); err != nil {
+			return 0, err
+		}
+	}
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	return r.Reader.Read(p)
 }
 
-func (s *Session) recvMsg() error {
-	r, err := s.tr.MsgReader()
+func (r *bomReader) Close() error { return r.c.Close() }
+
+func (s *Session) recvMsg(ctx context.Context) error {
+	r, err := s.msgReader(ctx)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
-	dec := xml.NewDecoder(r)
+	rec := newRecordingReader(r)
+	dec := xml.NewDecoder(rec)
 
 	root, err := startElement(dec)
 	if err != nil {
 		return err
 	}
 
-	const (
-		ncNamespace    = "urn:ietf:params:xml:ns:netconf:base:1.0"
-		notifNamespace = "urn:ietf:params:xml:ns:netconf:notification:1.0"
-	)
-
 	switch root.Name {
 	case xml.Name{Space: notifNamespace, Local: "notification"}:
-		if s.notificationHandler == nil {
+		if s.notificationHandler == nil && !s.hasNotifWaiters() && !s.hasSubscriptions() {
 			return nil
 		}
-		var notif Notification
-		if err := dec.DecodeElement(&notif, root); err != nil {
-			return fmt.Errorf("failed to decode notification message: %w", err)
+		return s.recvNotifications(dec, root)
+	case xml.Name{Space: baseNamespace, Local: "hello"}:
+		s.mu.Lock()
+		ch := s.helloWaiter
+		s.helloWaiter = nil
+		s.mu.Unlock()
+
+		if ch == nil {
+			return msgError{fmt.Errorf("unexpected hello message")}
 		}
-		s.notificationHandler(notif)
-	case xml.Name{Space: ncNamespace, Local: "rpc-reply"}:
+
+		var hello helloMsg
+		if err := dec.DecodeElement(&hello, root); err != nil {
+			return fmt.Errorf("failed to decode hello message: %w", err)
+		}
+		ch <- hello
+	case xml.Name{Space: baseNamespace, Local: "rpc-reply"}:
+		if req := s.spoolReq(root); req != nil {
+			return s.recvSpooledReply(dec, rec, root, req)
+		}
+
 		var reply Reply
 		if err := dec.DecodeElement(&reply, root); err != nil {
 			// What should we do here?  Kill the connection?
 			return fmt.Errorf("failed to decode rpc-reply message: %w", err)
 		}
+		reply.nsDecls = prefixDecls(root.Attr)
+		reply.Errors.inheritPathNamespaces(reply.nsDecls)
 		ok, req := s.req(reply.MessageID)
 		if !ok {
-			return fmt.Errorf("cannot find reply channel for message-id: %d", reply.MessageID)
+			return s.unmatchedReply(reply)
 		}
 
 		select {
 		case req.reply <- reply:
 			return nil
 		case <-req.ctx.Done():
-			return fmt.Errorf("message %d context canceled: %s", reply.MessageID, req.ctx.Err().Error())
+			return msgError{fmt.Errorf("message %d context canceled: %s", reply.MessageID, req.ctx.Err().Error())}
 		}
 	default:
-		return fmt.Errorf("unknown message type: %q", root.Name.Local)
+		return msgError{fmt.Errorf("unknown message type: %q", root.Name.Local)}
 	}
 	return nil
 }
 
+// recvNotifications delivers the notification starting at `root` and any
+// further notifications batched after it in the same message.
+func (s *Session) recvNotifications(dec *xml.Decoder, root *xml.StartElement) error {
+	for {
+		var notif Notification
+		if err := dec.DecodeElement(&notif, root); err != nil {
+			return fmt.Errorf("failed to decode notification message: %w", err)
+		}
+		notif.nsDecls = prefixDecls(root.Attr)
+		s.deliverNotification(notif)
+
+		var err error
+		root, err = startElement(dec)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if root.Name != (xml.Name{Space: notifNamespace, Local: "notification"}) {
+			return msgError{fmt.Errorf("unexpected %q element after notification", root.Name.Local)}
+		}
+	}
+}
+
+func (s *Session) deliverNotification(notif Notification) {
+	s.wakeNotifWaiters(notif)
+	s.routeNotification(notif)
+	if s.notificationHandler == nil {
+		return
+	}
+	if s.notifQueue != nil {
+		s.notifQueue.push(notif)
+	} else {
+		s.notificationHandler(notif)
+	}
+}
+
+// unmatchedReply handles a reply whose message-id doesn't match any pending
+// request.  Message-ids are never 0 so that is used to mean it was missing.
+func (s *Session) unmatchedReply(reply Reply) error {
+	if reply.MessageID != 0 && s.wasReplied(reply.MessageID) {
+		err := fmt.Errorf("%w: duplicate rpc-reply for message-id %d", ErrProtocolViolation, reply.MessageID)
+		if !s.lenientMessageIDs {
+			s.mu.Lock()
+			if s.violation == nil {
+				s.violation = err
+			}
+			s.mu.Unlock()
+		}
+		return msgError{err}
+	}
+
+	if reply.MessageID != 0 && s.wasAbandoned(reply.MessageID) {
+		return msgError{fmt.Errorf("message %d context canceled before the reply", reply.MessageID)}
+	}
+
+	if s.unsolicited(reply) {
+		s.unsolicitedHandler(reply)
+		return nil
+	}
+
+	var err error
+	if reply.MessageID == 0 {
+		err = fmt.Errorf("rpc-reply is missing a message-id")
+	} else {
+		err = fmt.Errorf("cannot find reply channel for message-id: %d", reply.MessageID)
+	}
+
+	// a reply to an rpc that was sent can't be for another one so only
+	// a missing or never sent message-id fails the oldest pending rpc.
+	if !s.lenientMessageIDs || (reply.MessageID != 0 && reply.MessageID <= s.seq.Load()) {
+		return msgError{err}
+	}
+
+	s.mu.Lock()
+	var oldest uint64
+	for msgID := range s.reqs {
+		if oldest == 0 || msgID < oldest {
+			oldest = msgID
+		}
+	}
+	req, ok := s.reqs[oldest]
+	delete(s.reqs, oldest)
+	if ok {
+		s.markAbandoned(oldest)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return msgError{err}
+	}
+
+	req.err = fmt.Errorf("%w: %v (failing message-id %d)", ErrMessageIDMismatch, err, oldest)
+	close(req.reply)
+	return msgError{fmt.Errorf("%v: failed pending message-id %d", err, oldest)}
+}
+
+// unsolicited reports if the unmatched reply should go to the handler set
+// with WithUnsolicitedReplyHandler.
+func (s *Session) unsolicited(reply Reply) bool {
+	if s.unsolicitedHandler == nil {
+		return false
+	}
+	if reply.MessageID != 0 {
+		return reply.MessageID > s.seq.Load()
+	}
+	if !s.lenientMessageIDs {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.reqs) == 0
+}
+
 // recv is the main receive loop.  It runs concurrently to be able to handle
 // interleaved messages (like notifications).
 func (s *Session) recv() {
+	defer close(s.done)
+	defer s.closeSubscriptions()
+	if s.notifQueue != nil {
+		go s.notifQueue.run(s.notificationHandler)
+		defer s.notifQueue.close()
+	}
+
 	var err error
 	for {
-		err = s.recvMsg()
-		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-			break
+		err = s.recvMsg(context.Background())
+		if err == nil {
+			continue
 		}
-		if err != nil {
-			log.Printf("netconf: failed to read incoming message: %v", err)
+		if !recoverable(err) {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && !s.isClosing() {
+				log.Printf("netconf: failed to read from transport: %v", err)
+			}
+			break
 		}
+		log.Printf("netconf: failed to read incoming message: %v", err)
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -269,37 +1396,221 @@ func (s *Session) req(msgID uint64) (bool, *req) {
 		return false, nil
 	}
 	delete(s.reqs, msgID)
+	s.markReplied(msgID)
 	return true, req
 }
 
+// recentReplies is how many answered message-ids are remembered to detect
+// duplicate replies.
+const recentReplies = 64
+
+// markReplied records that the rpc with the message-id has been answered.
+// s.mu must be held.
+func (s *Session) markReplied(msgID uint64) {
+	s.replied[s.repliedNext] = msgID
+	s.repliedNext = (s.repliedNext + 1) % recentReplies
+}
+
+func (s *Session) wasReplied(msgID uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.replied {
+		if id == msgID {
+			return true
+		}
+	}
+	return false
+}
+
+// markAbandoned records that the rpc with the message-id was given up on (i.e
+// it's context is done) so a reply that still arrives for it is dropped.
+// s.mu must be held.
+func (s *Session) markAbandoned(msgID uint64) {
+	s.abandoned[s.abandonedNext] = msgID
+	s.abandonedNext = (s.abandonedNext + 1) % recentReplies
+}
+
+func (s *Session) wasAbandoned(msgID uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.abandoned {
+		if id == msgID {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns an error wrapping [ErrProtocolViolation] once the device has
+// sent a second reply to an already answered rpc, in which case replies can
+// no longer be trusted to belong to the rpc they are matched to.  It is nil
+// while the session is healthy.  A [Pool] discards sessions that return an
+// error.  Duplicate replies are only logged with [WithLenientMessageIDs].
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.violation
+}
+
+// PendingRPC is a rpc that has been sent and is still waiting on it's reply.
+type PendingRPC struct {
+	MessageID uint64
+	// Operation is the local name of the operation element (i.e
+	// `get-config`).
+	Operation string
+	// Elapsed is the time since the rpc was sent.
+	Elapsed time.Duration
+}
+
+// PendingRPCs returns the rpcs waiting on a reply ordered by message-id.  This
+// is meant for debugging a session that appears to be hung.
+func (s *Session) PendingRPCs() []PendingRPC {
+	s.mu.Lock()
+	pending := make([]PendingRPC, 0, len(s.reqs))
+	ops := make([]any, 0, len(s.reqs))
+	for id, r := range s.reqs {
+		pending = append(pending, PendingRPC{MessageID: id, Elapsed: time.Since(r.sent)})
+		ops = append(ops, r.op)
+	}
+	s.mu.Unlock()
+
+	// the names are worked out without holding the lock
+	for i, op := range ops {
+		pending[i].Operation = operationName(unwrapOperation(op))
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].MessageID < pending[j].MessageID })
+	return pending
+}
+
 func (s *Session) writeMsg(v any) error {
-	w, err := s.tr.MsgWriter()
+	if s.requestRewriter != nil {
+		return s.writeRewrittenMsg(v)
+	}
+
+	return encodeMsg(s.msgWriter, v, s.indent)
+}
+
+func (s *Session) writeRewrittenMsg(v any) error {
+	msg, err := xml.MarshalIndent(v, "", s.indent)
+	if err != nil {
+		return err
+	}
+
+	msg, err = s.requestRewriter(msg)
+	if err != nil {
+		return fmt.Errorf("request rewriter failed: %w", err)
+	}
+
+	w, err := s.msgWriter()
 	if err != nil {
 		return err
 	}
 
-	if err := xml.NewEncoder(w).Encode(v); err != nil {
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// writeError wraps an error returned by the transport while writing a
+// message.
+type writeError struct{ error }
+
+func (e writeError) Unwrap() error        { return e.error }
+func (e writeError) Is(target error) bool { return target == ErrWriteFailed }
+
+// markedWriter marks errors from the wrapped message writer with writeError.
+type markedWriter struct{ w io.WriteCloser }
+
+func (w markedWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		err = writeError{err}
+	}
+	return n, err
+}
+
+func (w markedWriter) Close() error {
+	if err := w.w.Close(); err != nil {
+		return writeError{err}
+	}
+	return nil
+}
+
+// msgWriter returns a message writer from the transport whose errors wrap
+// [ErrWriteFailed].
+func (s *Session) msgWriter() (io.WriteCloser, error) {
+	w, err := s.tr.MsgWriter()
+	if err != nil {
+		return nil, writeError{err}
+	}
+	return markedWriter{w}, nil
+}
+
+// streamMsg marshals v straight into the transport's message writer.  The
+// encoder writes to the transport (i.e a new chunk) every time it's internal
+// buffer fills up.
+func (s *Session) streamMsg(v any) error {
+	w, err := s.msgWriter()
+	if err != nil {
 		return err
 	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", s.indent)
+	if err := enc.Encode(v); err != nil {
+		// part of the message may have already been sent and there is no way
+		// to abort a message so the stream is unusable.
+		s.closing = true
+		s.tr.Close()
+		return fmt.Errorf("failed to encode rpc (closing session): %w", err)
+	}
 	return w.Close()
 }
 
-func (s *Session) send(ctx context.Context, msg *request) (chan Reply, error) {
+// writeWithTimeout writes the message with the deadline from WithWriteTimeout
+// when the transport supports one.  The session is closed if the write times
+// out.  s.mu must be held.
+func (s *Session) writeWithTimeout(write func(any) error, msg *request) error {
+	d, ok := s.tr.(interface{ SetWriteDeadline(time.Time) error })
+	if s.writeTimeout <= 0 || !ok || d.SetWriteDeadline(time.Now().Add(s.writeTimeout)) != nil {
+		return write(msg)
+	}
+	defer d.SetWriteDeadline(time.Time{})
+
+	err := write(msg)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		s.closing = true
+		s.tr.Close()
+		return fmt.Errorf("write timed out after %s (closing session): %w", s.writeTimeout, err)
+	}
+	return err
+}
+
+func (s *Session) send(ctx context.Context, msg *request) (*req, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := s.writeMsg(msg); err != nil {
+	write := s.writeMsg
+	if msg.stream && s.requestRewriter == nil {
+		write = s.streamMsg
+	}
+	if err := s.writeWithTimeout(write, msg); err != nil {
 		return nil, err
 	}
 
 	// cap of 1 makes sure we don't block on send
-	ch := make(chan Reply, 1)
-	s.reqs[msg.MessageID] = &req{
-		reply: ch,
-		ctx:   ctx,
+	r := &req{
+		reply:   make(chan Reply, 1),
+		ctx:     ctx,
+		spool:   msg.spool,
+		onError: msg.onError,
+		op:      msg.Operation,
+		sent:    time.Now(),
 	}
+	s.reqs[msg.MessageID] = r
 
-	return ch, nil
+	return r, nil
 }
 
 // Do issues a rpc call for the given NETCONF operation returning a Reply.  RPC
@@ -311,16 +1622,76 @@ func (s *Session) Do(ctx context.Context, req any) (*Reply, error) {
 		MessageID: s.seq.Add(1),
 		Operation: req,
 	}
+	return s.doMsg(ctx, msg)
+}
+
+// EncodeRPC issues a rpc like [Session.Do] but marshals `v` straight into the
+// framing of the transport instead of marshaling the full message first.  This
+// keeps the peak memory down when sending very large operations (i.e an
+// `<edit-config>` built from structs).
+//
+// Since the message is sent as it is marshaled, a marshaling error leaves
+// a partial message on the transport and the session is closed.  When a request
+// rewriter is set (see [WithRequestRewriter]) the message is marshaled in full
+// first like with [Session.Do].
+func (s *Session) EncodeRPC(ctx context.Context, v any) (*Reply, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	msg := &request{
+		MessageID: s.seq.Add(1),
+		Operation: v,
+		stream:    true,
+	}
+	return s.doMsg(ctx, msg)
+}
+
+// doMsg issues the rpc tracing it if there is a tracer on the context.
+func (s *Session) doMsg(ctx context.Context, msg *request) (*Reply, error) {
+	tracer := tracerFromContext(ctx)
+	if tracer == nil {
+		return s.do(ctx, msg)
+	}
+
+	span := tracer.StartRPC(ctx, newRPCInfo(msg))
+	reply, err := s.do(ctx, msg)
+	if err == nil {
+		span.End(reply.Err())
+	} else {
+		span.End(err)
+	}
+	return reply, err
+}
+
+func (s *Session) do(ctx context.Context, msg *request) (*Reply, error) {
+	if s.synchronous {
+		return s.doSync(ctx, msg)
+	}
+
+	if s.outstanding != nil {
+		select {
+		case s.outstanding <- struct{}{}:
+			defer func() { <-s.outstanding }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+			return nil, ErrClosed
+		}
+	}
 
-	ch, err := s.send(ctx, msg)
+	r, err := s.send(ctx, msg)
 	if err != nil {
 		return nil, err
 	}
 
 	// wait for reply or context to be cancelled.
 	select {
-	case reply, ok := <-ch:
+	case reply, ok := <-r.reply:
 		if !ok {
+			if r.err != nil {
+				return nil, r.err
+			}
 			return nil, ErrClosed
 		}
 		return &reply, nil
@@ -328,16 +1699,119 @@ func (s *Session) Do(ctx context.Context, req any) (*Reply, error) {
 		// remove any existing request
 		s.mu.Lock()
 		delete(s.reqs, msg.MessageID)
+		s.markAbandoned(msg.MessageID)
+		if s.cancelCloses {
+			s.closing = true
+		}
 		s.mu.Unlock()
 
+		if s.cancelCloses {
+			s.tr.Close()
+		}
 		return nil, ctx.Err()
 	}
 }
 
+// doSync sends the request and then reads messages inline until the reply is
+// received.
+func (s *Session) doSync(ctx context.Context, msg *request) (*Reply, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if d, ok := s.tr.(interface{ SetReadDeadline(time.Time) error }); ok {
+			if err := d.SetReadDeadline(deadline); err == nil {
+				defer d.SetReadDeadline(time.Time{})
+			}
+		}
+	}
+
+	r, err := s.send(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case reply, ok := <-r.reply:
+			if !ok {
+				if r.err != nil {
+					return nil, r.err
+				}
+				return nil, ErrClosed
+			}
+			return &reply, nil
+		default:
+		}
+
+		if err := s.recvMsg(ctx); err != nil {
+			if recoverable(err) {
+				log.Printf("netconf: failed to read incoming message: %v", err)
+				continue
+			}
+
+			s.mu.Lock()
+			delete(s.reqs, msg.MessageID)
+			s.markAbandoned(msg.MessageID)
+			s.mu.Unlock()
+
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, err
+		}
+	}
+}
+
+// CallOption is an optional argument to [Session.Call].
+type CallOption interface {
+	apply(*request)
+}
+
+type envelopeOpt string
+
+func (o envelopeOpt) apply(req *request) { req.envelope = string(o) }
+
+// WithEnvelope sends the request with `name` as the outermost element instead
+// of `<rpc>`.  The element still gets the base namespace and the message-id
+// and the device is still expected to answer with an `<rpc-reply>`.
+//
+// This is an escape hatch for integration shims or proxies in front of
+// a device that expect their own wrapper element.  It is not valid NETCONF
+// and a device will reject it.
+func WithEnvelope(name string) CallOption { return envelopeOpt(name) }
+
 // Call issues a rpc message with `req` as the body and decodes the reponse into
 // a pointer at `resp`.  Any Call errors are presented as a go error.
-func (s *Session) Call(ctx context.Context, req any, resp any) error {
-	reply, err := s.Do(ctx, &req)
+//
+// This is the general purpose operation the typed helpers are built on and
+// can be used for vendor specific rpcs.  `req` is any value that marshals to
+// a single element (i.e a struct with a namespaced XMLName) which is placed
+// directly under `<rpc>`.  The first element of the reply that isn't an
+// `<rpc-error>` is decoded into `resp` (see [Reply.Decode]).  `opts` changes
+// the envelope around `req` (see [WithEnvelope]).
+//
+//	var info struct {
+//		XMLName    xml.Name `xml:"http://xml.juniper.net/junos/23.4R1/junos-interface interface-information"`
+//		Interfaces []struct {
+//			Name string `xml:"name"`
+//		} `xml:"physical-interface"`
+//	}
+//	err := s.Call(ctx, `<get-interface-information><terse/></get-interface-information>`, &info)
+func (s *Session) Call(ctx context.Context, req any, resp any, opts ...CallOption) error {
+	msg := &request{
+		MessageID: s.seq.Add(1),
+		Operation: &req,
+	}
+	for _, opt := range opts {
+		opt.apply(msg)
+	}
+
+	reply, err := s.doMsg(ctx, msg)
 	if err != nil {
 		return err
 	}
@@ -377,9 +1851,12 @@ func (s *Session) Close(ctx context.Context) error {
 		}
 	}
 
-	if callErr != io.EOF {
-		return callErr
+	// Some devices drop the connection as soon as they process the
+	// close-session without replying.  That is only a successful close if the
+	// close-session was actually sent.
+	if callErr != nil && !errors.Is(callErr, ErrWriteFailed) &&
+		(errors.Is(callErr, ErrClosed) || errors.Is(callErr, io.EOF) || errors.Is(callErr, io.ErrUnexpectedEOF)) {
+		return nil
 	}
-
-	return nil
+	return callErr
 }
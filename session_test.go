@@ -1,11 +1,26 @@
 package netconf
 
 import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/dau71/netconf/transport"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testServer struct {
@@ -97,6 +112,72 @@ func (s *testTransport) Close() error {
 	return nil
 }
 
+// pipeTransport is a framed transport over in-memory pipes.  Unlike
+// testTransport the messages are not tied to the request so it can be used to
+// simulate a device that talks on it's own.
+type pipeTransport struct {
+	*transport.Framer
+	close func() error
+}
+
+func (t *pipeTransport) Close() error { return t.close() }
+
+// newPipeTransports returns both ends of a connected transport.  Closing either
+// side will close the stream in both directions.
+func newPipeTransports() (client, server *pipeTransport) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	closeFn := func() error {
+		cw.Close()
+		sw.Close()
+		return nil
+	}
+
+	client = &pipeTransport{Framer: transport.NewFramer(cr, cw), close: closeFn}
+	server = &pipeTransport{Framer: transport.NewFramer(sr, sw), close: closeFn}
+	return client, server
+}
+
+var msgIDRe = regexp.MustCompile(`message-id="(\d+)"`)
+
+// serveOK will reply with `<ok/>` to every message sent to the server until
+// the transport is closed.
+func serveOK(tr *pipeTransport) { serveOKRecorded(tr, nil) }
+
+// serveOKRecorded is like serveOK but also sends each received message to
+// `sent` (if not nil) before replying.
+func serveOKRecorded(tr *pipeTransport, sent chan<- []byte) {
+	for {
+		r, err := tr.MsgReader()
+		if err != nil {
+			return
+		}
+
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+		if sent != nil {
+			sent <- msg
+		}
+
+		var msgID []byte
+		if m := msgIDRe.FindSubmatch(msg); m != nil {
+			msgID = m[1]
+		}
+
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, msgID)
+		if err := w.Close(); err != nil {
+			return
+		}
+	}
+}
+
 const (
 	helloGood = `
 <hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
@@ -127,6 +208,265 @@ const (
 </hello>`
 )
 
+// errTransport is a transport that fails every read with the given error.
+type errTransport struct {
+	err error
+}
+
+func (t *errTransport) MsgReader() (io.ReadCloser, error)  { return nil, t.err }
+func (t *errTransport) MsgWriter() (io.WriteCloser, error) { return nil, t.err }
+func (t *errTransport) Close() error                       { return nil }
+
+func TestRecvExitsOnTransportError(t *testing.T) {
+	for _, trErr := range []error{net.ErrClosed, syscall.ECONNRESET, io.ErrClosedPipe} {
+		t.Run(trErr.Error(), func(t *testing.T) {
+			sess := newSession(&errTransport{err: trErr})
+			go sess.recv()
+
+			select {
+			case <-sess.done:
+			case <-time.After(time.Second):
+				t.Fatal("recv loop did not exit on transport error")
+			}
+			assert.False(t, sess.alive())
+		})
+	}
+}
+
+func TestMaxOutstandingRPCs(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	// the device reports each request it reads and replies when told to
+	received := make(chan string, 3)
+	go func() {
+		for {
+			r, err := server.MsgReader()
+			if err != nil {
+				return
+			}
+			msg, err := io.ReadAll(r)
+			if err != nil {
+				return
+			}
+			received <- string(msgIDRe.FindSubmatch(msg)[1])
+		}
+	}()
+	reply := func(id string) {
+		w, err := server.MsgWriter()
+		require.NoError(t, err)
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)
+		require.NoError(t, w.Close())
+	}
+	recvID := func() string {
+		select {
+		case id := <-received:
+			return id
+		case <-time.After(time.Second):
+			t.Fatal("rpc not sent")
+			return ""
+		}
+	}
+
+	sess := newSession(client, WithMaxOutstandingRPCs(2))
+	go sess.recv()
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := sess.Do(context.Background(), "<get/>")
+			errs <- err
+		}()
+	}
+
+	first, second := recvID(), recvID()
+	select {
+	case id := <-received:
+		t.Fatalf("third rpc %s sent while two are outstanding", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Len(t, sess.PendingRPCs(), 2)
+
+	// a blocked rpc still respects it's context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := sess.Do(ctx, "<get/>")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	reply(first)
+	third := recvID()
+	reply(second)
+	reply(third)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-errs)
+	}
+}
+
+func TestPendingRPCs(t *testing.T) {
+	const n = 5
+
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	// the device reads every request but only replies once released
+	release := make(chan struct{})
+	go func() {
+		var ids [][]byte
+		for i := 0; i < n; i++ {
+			r, err := server.MsgReader()
+			if err != nil {
+				return
+			}
+			msg, err := io.ReadAll(r)
+			if err != nil {
+				return
+			}
+			ids = append(ids, msgIDRe.FindSubmatch(msg)[1])
+		}
+
+		<-release
+		for _, id := range ids {
+			w, err := server.MsgWriter()
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)
+			if err := w.Close(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sess := newSession(client)
+	go sess.recv()
+	assert.Empty(t, sess.PendingRPCs())
+
+	ops := []any{
+		&GetConfigReq{Source: Running},
+		&LockReq{XMLName: xml.Name{Local: "lock"}, Target: Candidate},
+		"<get/>",
+		[]byte("<commit/>"),
+		&ValidateReq{Source: Candidate},
+	}
+	wantOps := map[string]bool{"get-config": true, "lock": true, "get": true, "commit": true, "validate": true}
+
+	var wg sync.WaitGroup
+	for _, op := range ops {
+		wg.Add(1)
+		go func(op any) {
+			defer wg.Done()
+			_, err := sess.Do(context.Background(), op)
+			assert.NoError(t, err)
+		}(op)
+	}
+
+	require.Eventually(t, func() bool { return len(sess.PendingRPCs()) == n }, time.Second, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	pending := sess.PendingRPCs()
+	gotOps := make(map[string]bool)
+	for i, rpc := range pending {
+		assert.Equal(t, uint64(i+1), rpc.MessageID)
+		assert.GreaterOrEqual(t, rpc.Elapsed, 5*time.Millisecond)
+		gotOps[rpc.Operation] = true
+	}
+	assert.Equal(t, wantOps, gotOps)
+
+	close(release)
+	wg.Wait()
+	assert.Empty(t, sess.PendingRPCs())
+}
+
+func TestWriteTimeout(t *testing.T) {
+	// the device never reads so the write blocks like on a half-open
+	// connection.
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	sess := newSession(client, WithWriteTimeout(20*time.Millisecond))
+	go sess.recv()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := sess.Do(context.Background(), &GetConfigReq{Source: Running})
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, ErrWriteFailed)
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("stalled write was not aborted by the write timeout")
+	}
+
+	select {
+	case <-sess.done:
+	case <-time.After(time.Second):
+		t.Fatal("session was not closed after the write timed out")
+	}
+	assert.False(t, sess.alive())
+}
+
+func TestCloseHangup(t *testing.T) {
+	t.Run("after close-session", func(t *testing.T) {
+		client, server := newPipeTransports()
+
+		// the device hangs up as soon as it reads the close-session
+		go func() {
+			r, err := server.MsgReader()
+			if err != nil {
+				return
+			}
+			_, _ = io.ReadAll(r)
+			server.Close()
+		}()
+
+		sess := newSession(client)
+		go sess.recv()
+
+		assert.NoError(t, sess.Close(context.Background()))
+	})
+
+	t.Run("before close-session", func(t *testing.T) {
+		client, server := newPipeTransports()
+		server.Close()
+
+		sess := newSession(client)
+		go sess.recv()
+		<-sess.done
+
+		err := sess.Close(context.Background())
+		assert.ErrorIs(t, err, ErrWriteFailed)
+	})
+}
+
+func TestSessionStats(t *testing.T) {
+	client, server := newPipeTransports()
+	serverDone := make(chan struct{})
+	go func() {
+		serveOK(server)
+		close(serverDone)
+	}()
+
+	sess := newSession(client)
+	go sess.recv()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := sess.Do(ctx, "<get/>")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sess.Close(ctx))
+	<-serverDone
+	<-sess.done
+
+	got := sess.Stats()
+	assert.NotZero(t, got.BytesRead)
+	assert.Equal(t, server.Stats().BytesRead, got.BytesWritten)
+	assert.Equal(t, server.Stats().BytesWritten, got.BytesRead)
+}
+
 func TestHello(t *testing.T) {
 	tt := []struct {
 		name        string
@@ -158,3 +498,1264 @@ func TestHello(t *testing.T) {
 		})
 	}
 }
+
+func TestRawServerCapabilities(t *testing.T) {
+	caps := []string{
+		"urn:ietf:params:netconf:base:1.1",
+		"urn:ietf:params:netconf:base:1.0",
+		"urn:ietf:params:netconf:capability:url:1.0?scheme=https,file",
+		"http://example.com/ns/system?module=example-system&revision=2024-01-01",
+		"urn:ietf:params:netconf:base:1.0",
+	}
+
+	var hello strings.Builder
+	hello.WriteString(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>`)
+	for _, c := range caps {
+		hello.WriteString("<capability>")
+		require.NoError(t, xml.EscapeText(&hello, []byte(c)))
+		hello.WriteString("</capability>")
+	}
+	hello.WriteString(`</capabilities><session-id>42</session-id></hello>`)
+
+	ts := newTestServer(t)
+	sess := &Session{tr: ts.transport()}
+	ts.queueRespString(hello.String())
+	require.NoError(t, sess.handshake())
+	_, err := ts.popReqString()
+	require.NoError(t, err)
+
+	assert.Equal(t, caps, sess.RawServerCapabilities())
+
+	// the result is a copy
+	sess.RawServerCapabilities()[0] = "changed"
+	assert.Equal(t, caps, sess.RawServerCapabilities())
+}
+
+func TestForceChunked(t *testing.T) {
+	helloBase10 := strings.Replace(helloGood, "<capability>urn:ietf:params:netconf:base:1.1</capability>", "", 1)
+
+	t.Run("supported", func(t *testing.T) {
+		ts := newTestServer(t)
+		sess := newSession(ts.transport(), WithForceChunked())
+
+		ts.queueRespString(helloGood)
+		require.NoError(t, sess.handshake())
+
+		hello, err := ts.popReqString()
+		require.NoError(t, err)
+		assert.Contains(t, hello, "urn:ietf:params:netconf:base:1.1")
+		assert.NotContains(t, hello, "urn:ietf:params:netconf:base:1.0<")
+	})
+
+	t.Run("base 1.0 only peer", func(t *testing.T) {
+		ts := newTestServer(t)
+		ts.queueRespString(helloBase10)
+		_, err := Open(ts.transport(), WithForceChunked())
+		assert.ErrorContains(t, err, "server does not support :base:1.1")
+	})
+}
+
+func TestSessionInfo(t *testing.T) {
+	helloBase10 := strings.Replace(helloGood, "<capability>urn:ietf:params:netconf:base:1.1</capability>",
+		"<capability>urn:ietf:params:netconf:capability:candidate:1.0</capability>", 1)
+
+	tt := []struct {
+		name     string
+		hello    string
+		framing  transport.FramingVersion
+		wantCaps []string
+	}{
+		{"base 1.1", helloGood, transport.Chunked, []string{"urn:ietf:params:netconf:base:1.0", "urn:ietf:params:netconf:base:1.1"}},
+		{"base 1.0", helloBase10, transport.EndOfMessage, []string{"urn:ietf:params:netconf:base:1.0"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+
+			go func() {
+				r, err := server.MsgReader()
+				if err != nil {
+					return
+				}
+				_, _ = io.ReadAll(r)
+
+				w, err := server.MsgWriter()
+				if err != nil {
+					return
+				}
+				_, _ = io.WriteString(w, tc.hello)
+				_ = w.Close()
+			}()
+
+			sess := newSession(client)
+			require.NoError(t, sess.handshake())
+
+			info := sess.Info()
+			assert.Equal(t, uint64(42), info.SessionID)
+			assert.Equal(t, tc.framing, info.Framing)
+			assert.Equal(t, tc.wantCaps, info.Capabilities)
+			// the pipe transport doesn't describe itself
+			assert.Equal(t, "*netconf.pipeTransport", info.Transport.Type)
+		})
+	}
+}
+
+func TestUnmatchedMessageID(t *testing.T) {
+	tt := []struct {
+		name     string
+		badReply string
+	}{
+		{
+			name:     "mismatched",
+			badReply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="99"><ok/></rpc-reply>`,
+		},
+		{
+			name:     "missing",
+			badReply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`,
+		},
+	}
+
+	writeMsg := func(tr *pipeTransport, msg string) error {
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, msg); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+
+	// badServer replies to each request with `badReply` followed by
+	// a correct `<ok/>` reply.
+	badServer := func(tr *pipeTransport, badReply string) {
+		for {
+			r, err := tr.MsgReader()
+			if err != nil {
+				return
+			}
+			msg, err := io.ReadAll(r)
+			if err != nil {
+				return
+			}
+			m := msgIDRe.FindSubmatch(msg)
+			if m == nil {
+				return
+			}
+
+			if err := writeMsg(tr, badReply); err != nil {
+				return
+			}
+			_ = writeMsg(tr, fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, m[1]))
+		}
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name+"/strict", func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+			go badServer(server, tc.badReply)
+
+			sess := newSession(client)
+			go sess.recv()
+
+			// the bad reply is dropped and the real reply still matches
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			reply, err := sess.Do(ctx, "<get/>")
+			require.NoError(t, err)
+			assert.Equal(t, uint64(1), reply.MessageID)
+		})
+
+		t.Run(tc.name+"/lenient", func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+			go badServer(server, tc.badReply)
+
+			sess := newSession(client, WithLenientMessageIDs())
+			go sess.recv()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := sess.Do(ctx, "<get/>")
+			assert.ErrorIs(t, err, ErrMessageIDMismatch)
+			assert.ErrorContains(t, err, "failing message-id 1")
+		})
+	}
+}
+
+func TestLateReplyAfterCancel(t *testing.T) {
+	for _, lenient := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lenient=%t", lenient), func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+
+			var opts []SessionOption
+			if lenient {
+				opts = append(opts, WithLenientMessageIDs())
+			}
+			sess := newSession(client, opts...)
+			go sess.recv()
+
+			readReq := func() {
+				t.Helper()
+				r, err := server.MsgReader()
+				require.NoError(t, err)
+				_, err = io.ReadAll(r)
+				require.NoError(t, err)
+			}
+			reply := func(msgID int) {
+				t.Helper()
+				w, err := server.MsgWriter()
+				require.NoError(t, err)
+				fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%d"><ok/></rpc-reply>`, msgID)
+				require.NoError(t, w.Close())
+			}
+
+			// rpc 1 is given up on before the device answers it
+			ctx, cancel := context.WithCancel(context.Background())
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := sess.Do(ctx, "<get/>")
+				errCh <- err
+			}()
+			readReq()
+			cancel()
+			assert.ErrorIs(t, <-errCh, context.Canceled)
+
+			type result struct {
+				reply *Reply
+				err   error
+			}
+			res := make(chan result, 1)
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				reply, err := sess.Do(ctx, "<get/>")
+				res <- result{reply, err}
+			}()
+			readReq()
+
+			// the late reply to rpc 1 must not fail rpc 2
+			reply(1)
+			reply(2)
+			got := <-res
+			require.NoError(t, got.err)
+			assert.Equal(t, uint64(2), got.reply.MessageID)
+		})
+	}
+}
+
+func TestDuplicateReply(t *testing.T) {
+	// dupServer replies to each request twice with the same message-id.
+	dupServer := func(tr *pipeTransport) {
+		for {
+			r, err := tr.MsgReader()
+			if err != nil {
+				return
+			}
+			msg, err := io.ReadAll(r)
+			if err != nil {
+				return
+			}
+			m := msgIDRe.FindSubmatch(msg)
+			if m == nil {
+				return
+			}
+
+			for i := 0; i < 2; i++ {
+				w, err := tr.MsgWriter()
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, m[1])
+				if err := w.Close(); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	for _, lenient := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lenient=%t", lenient), func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+			go dupServer(server)
+
+			var opts []SessionOption
+			if lenient {
+				opts = append(opts, WithLenientMessageIDs())
+			}
+			sess := newSession(client, opts...)
+			go sess.recv()
+			assert.NoError(t, sess.Err())
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			// messages are handled in order so once the second rpc is
+			// answered the duplicate reply to the first has been seen.  It
+			// must not be matched to second rpc.
+			for msgID := uint64(1); msgID <= 2; msgID++ {
+				reply, err := sess.Do(ctx, "<get/>")
+				require.NoError(t, err)
+				assert.Equal(t, msgID, reply.MessageID)
+			}
+
+			err := sess.Err()
+			if lenient {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrProtocolViolation)
+				assert.ErrorContains(t, err, "duplicate rpc-reply for message-id 1")
+			}
+		})
+	}
+}
+
+func TestReadHello(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	sess := newSession(client)
+	sess.serverCaps = newCapabilitySet("urn:ietf:params:netconf:base:1.0")
+	go sess.recv()
+
+	writeMsg := func(msg string) {
+		w, err := server.MsgWriter()
+		require.NoError(t, err)
+		_, err = io.WriteString(w, msg)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	// a hello nobody is waiting for is dropped.  Messages are handled in
+	// order so once the reply to the rpc is back the hello has been dropped.
+	writeMsg(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:capability:startup:1.0</capability></capabilities></hello>`)
+	replied := make(chan struct{})
+	go func() {
+		defer close(replied)
+		r, err := server.MsgReader()
+		if err != nil {
+			return
+		}
+		_, _ = io.ReadAll(r)
+		writeMsg(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+	}()
+	_, err := sess.Do(context.Background(), "<get/>")
+	require.NoError(t, err)
+	<-replied
+	assert.ElementsMatch(t, []string{"urn:ietf:params:netconf:base:1.0"}, sess.ServerCapabilities())
+
+	done := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		done <- sess.ReadHello(ctx)
+	}()
+
+	// wait for ReadHello to be waiting for the hello
+	require.Eventually(t, func() bool {
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+		return sess.helloWaiter != nil
+	}, time.Second, time.Millisecond)
+
+	writeMsg(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+    <capability>urn:ietf:params:netconf:capability:candidate:1.0</capability>
+    <capability>urn:example:new-module?module=new-module&amp;revision=2024-01-01</capability>
+  </capabilities>
+</hello>`)
+
+	require.NoError(t, <-done)
+	assert.ElementsMatch(t, []string{
+		"urn:ietf:params:netconf:base:1.0",
+		"urn:ietf:params:netconf:capability:candidate:1.0",
+		"urn:example:new-module?module=new-module&revision=2024-01-01",
+	}, sess.ServerCapabilities())
+
+	// times out when no hello is sent
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sess.ReadHello(ctx), context.DeadlineExceeded)
+}
+
+func TestCancelClosesTransport(t *testing.T) {
+	for _, closeTransport := range []bool{false, true} {
+		t.Run(fmt.Sprintf("close=%t", closeTransport), func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+
+			// a device that takes forever to reply
+			received := make(chan struct{})
+			go func() {
+				r, err := server.MsgReader()
+				if err != nil {
+					return
+				}
+				_, _ = io.ReadAll(r)
+				close(received)
+			}()
+
+			sess := newSession(client, WithCancelClosesTransport(closeTransport))
+			go sess.recv()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-received
+				cancel()
+			}()
+
+			_, err := sess.Do(ctx, "<get/>")
+			assert.ErrorIs(t, err, context.Canceled)
+
+			if closeTransport {
+				select {
+				case <-sess.done:
+				case <-time.After(time.Second):
+					t.Fatal("transport was not closed on cancel")
+				}
+				return
+			}
+
+			// the session is left open for the reply to be dropped later
+			time.Sleep(10 * time.Millisecond)
+			assert.True(t, sess.alive())
+		})
+	}
+}
+
+// syncTransport is a transport that answers each message as soon as it's
+// written without using any goroutines.  The hello is answered with helloGood
+// and everything else with `<ok/>`.
+type syncTransport struct {
+	sent    [][]byte
+	pending [][]byte
+	closed  bool
+}
+
+type syncWriter struct {
+	t   *syncTransport
+	buf bytes.Buffer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *syncWriter) Close() error {
+	msg := w.buf.Bytes()
+	w.t.sent = append(w.t.sent, msg)
+
+	if bytes.Contains(msg, []byte("<hello")) {
+		w.t.pending = append(w.t.pending, []byte(helloGood))
+		return nil
+	}
+
+	var msgID []byte
+	if m := msgIDRe.FindSubmatch(msg); m != nil {
+		msgID = m[1]
+	}
+	w.t.pending = append(w.t.pending, []byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, msgID)))
+	return nil
+}
+
+func (t *syncTransport) MsgWriter() (io.WriteCloser, error) { return &syncWriter{t: t}, nil }
+
+func (t *syncTransport) MsgReader() (io.ReadCloser, error) {
+	if len(t.pending) == 0 {
+		return nil, io.EOF
+	}
+	msg := t.pending[0]
+	t.pending = t.pending[1:]
+	return io.NopCloser(bytes.NewReader(msg)), nil
+}
+
+func (t *syncTransport) Close() error {
+	t.closed = true
+	return nil
+}
+
+func TestSynchronous(t *testing.T) {
+	tr := &syncTransport{}
+
+	before := runtime.NumGoroutine()
+
+	sess, err := Open(tr, WithSynchronous())
+	require.NoError(t, err)
+
+	reply, err := sess.Do(context.Background(), "<get/>")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), reply.MessageID)
+
+	assert.NoError(t, sess.Lock(context.Background(), Candidate))
+
+	// goroutines left over from other tests may exit but none should be
+	// started.
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+	assert.Len(t, tr.sent, 3)
+	assert.Empty(t, tr.pending)
+
+	assert.NoError(t, sess.Close(context.Background()))
+}
+
+func TestRewriters(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	// device replies with `<rpc-reply>` missing the namespace
+	sent := make(chan []byte, 1)
+	go func() {
+		r, err := server.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+		sent <- msg
+
+		w, err := server.MsgWriter()
+		if err != nil {
+			return
+		}
+		_, _ = io.WriteString(w, `<rpc-reply message-id="1"><ok/></rpc-reply>`)
+		_ = w.Close()
+	}()
+
+	sess := newSession(client,
+		WithRequestRewriter(func(msg []byte) ([]byte, error) {
+			return bytes.Replace(msg, []byte("<rpc "), []byte(`<rpc xmlns:junos="http://xml.juniper.net/junos/*/junos" `), 1), nil
+		}),
+		WithReplyRewriter(func(msg []byte) ([]byte, error) {
+			return bytes.Replace(msg, []byte("<rpc-reply "), []byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" `), 1), nil
+		}),
+	)
+	go sess.recv()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := sess.Do(ctx, "<get/>")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), reply.MessageID)
+
+	assert.Contains(t, string(<-sent), `<rpc xmlns:junos="http://xml.juniper.net/junos/*/junos" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><get/></rpc>`)
+}
+
+func TestRequestRewriterError(t *testing.T) {
+	errRewrite := fmt.Errorf("nope")
+	tr := &syncTransport{}
+	sess := newSession(tr, WithRequestRewriter(func([]byte) ([]byte, error) { return nil, errRewrite }))
+
+	_, err := sess.Do(context.Background(), "<get/>")
+	assert.ErrorIs(t, err, errRewrite)
+	assert.Empty(t, tr.sent)
+}
+
+func TestHelloChunked(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	go func() {
+		r, err := server.MsgReader()
+		if err != nil {
+			return
+		}
+		_, _ = io.ReadAll(r)
+
+		// send the hello chunk-framed before it has been negotiated
+		server.Upgrade()
+		w, err := server.MsgWriter()
+		if err != nil {
+			return
+		}
+		_, _ = io.WriteString(w, helloGood)
+		_ = w.Close()
+	}()
+
+	sess := newSession(client)
+	require.NoError(t, sess.handshake())
+	assert.Equal(t, uint64(42), sess.SessionID())
+}
+
+func TestHelloOrder(t *testing.T) {
+	readHello := func(tr *pipeTransport, got chan<- []byte) error {
+		r, err := tr.MsgReader()
+		if err != nil {
+			return err
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		got <- msg
+		return nil
+	}
+	writeHello := func(tr *pipeTransport) error {
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, helloGood); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+
+	tt := []struct {
+		name string
+		// serverFirst is if the device sends it's hello before reading the
+		// client hello (otherwise it waits for the client hello).
+		serverFirst bool
+		order       HelloOrder
+	}{
+		{"client-first device", false, HelloClientFirst},
+		{"client-first device simultaneous", false, HelloSimultaneous},
+		{"server-first device", true, HelloServerFirst},
+		{"server-first device simultaneous", true, HelloSimultaneous},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := newPipeTransports()
+			defer server.Close()
+
+			got := make(chan []byte, 1)
+			go func() {
+				if tc.serverFirst {
+					if writeHello(server) != nil {
+						return
+					}
+					_ = readHello(server, got)
+				} else {
+					if readHello(server, got) != nil {
+						return
+					}
+					_ = writeHello(server)
+				}
+			}()
+
+			sess := newSession(client, WithHelloOrder(tc.order))
+			require.NoError(t, sess.handshake())
+			assert.Equal(t, uint64(42), sess.SessionID())
+
+			select {
+			case msg := <-got:
+				assert.Contains(t, string(msg), "<hello")
+			case <-time.After(time.Second):
+				t.Fatal("device did not receive the client hello")
+			}
+		})
+	}
+}
+
+func TestRecvBOM(t *testing.T) {
+	const bom = "\xef\xbb\xbf"
+
+	tt := []struct {
+		name, hello string
+		chunked     bool
+	}{
+		{"eom", strings.Replace(helloGood, "<capability>urn:ietf:params:netconf:base:1.1</capability>", "", 1), false},
+		{"chunked", helloGood, true},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := newPipeTransports()
+			serverDone := make(chan struct{})
+			defer func() {
+				server.Close()
+				<-serverDone
+			}()
+
+			go func() {
+				defer close(serverDone)
+				for _, msg := range []string{
+					bom + tc.hello,
+					bom + `<?xml version="1.0" encoding="UTF-8"?>` +
+						`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">` +
+						`<data><motd>fish &amp; chips&#10;daily</motd></data></rpc-reply>`,
+				} {
+					r, err := server.MsgReader()
+					if err != nil {
+						return
+					}
+					_, _ = io.ReadAll(r)
+
+					// the chunk size includes the bom
+					w, err := server.MsgWriter()
+					if err != nil {
+						return
+					}
+					_, _ = io.WriteString(w, msg)
+					_ = w.Close()
+					if tc.chunked {
+						server.Upgrade()
+					}
+				}
+			}()
+
+			sess := newSession(client)
+			require.NoError(t, sess.handshake())
+			assert.Equal(t, uint64(42), sess.SessionID())
+			go sess.recv()
+
+			var data struct {
+				XMLName xml.Name `xml:"data"`
+				MOTD    string   `xml:"motd"`
+			}
+			require.NoError(t, sess.Call(context.Background(), &GetReq{}, &data))
+			assert.Equal(t, "fish & chips\ndaily", data.MOTD)
+		})
+	}
+}
+
+func TestBOMReader(t *testing.T) {
+	tt := []struct {
+		name, in, want string
+	}{
+		{"bom", "\xef\xbb\xbf<ok/>", "<ok/>"},
+		{"no bom", "<ok/>", "<ok/>"},
+		{"partial bom", "\xef\xbb<ok/>", "\xef\xbb<ok/>"},
+		{"short", "\xef", "\xef"},
+		{"empty", "", ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newBOMReader(io.NopCloser(strings.NewReader(tc.in)))
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+
+			r = newBOMReader(io.NopCloser(iotest.OneByteReader(strings.NewReader(tc.in))))
+			got, err = io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func BenchmarkSmallRPC(b *testing.B) {
+	for _, framing := range []string{"eom", "chunked"} {
+		b.Run(framing, func(b *testing.B) {
+			client, server := newPipeTransports()
+			defer server.Close()
+			if framing == "chunked" {
+				client.Upgrade()
+				server.Upgrade()
+			}
+			go serveOK(server)
+
+			sess := newSession(client)
+			go sess.recv()
+
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := sess.Lock(ctx, Candidate); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWriteSmallRPC(b *testing.B) {
+	for _, framing := range []string{"eom", "chunked"} {
+		b.Run(framing, func(b *testing.B) {
+			f := transport.NewFramer(strings.NewReader(""), io.Discard)
+			if framing == "chunked" {
+				f.Upgrade()
+			}
+			sess := newSession(&pipeTransport{Framer: f, close: func() error { return nil }})
+			msg := &request{
+				MessageID: 1,
+				Operation: &LockReq{XMLName: xml.Name{Local: "lock"}, Target: Candidate},
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := sess.writeMsg(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTransportControl(t *testing.T) {
+	client, server := newPipeTransports()
+	go serveOK(server)
+
+	sess := newSession(client)
+	go sess.recv()
+
+	ctx := context.Background()
+	_, err := sess.Do(ctx, "<get/>")
+	require.NoError(t, err)
+
+	var got any
+	err = sess.Transport().Control(func(tr any) error {
+		got = tr
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Same(t, client, got)
+
+	errAdjust := errors.New("adjust failed")
+	err = sess.Transport().Control(func(tr any) error { return errAdjust })
+	assert.ErrorIs(t, err, errAdjust)
+
+	// the session still works after the transport was adjusted
+	_, err = sess.Do(ctx, "<get/>")
+	require.NoError(t, err)
+
+	require.NoError(t, sess.Close(ctx))
+	err = sess.Transport().Control(func(tr any) error {
+		t.Error("fn called on a closed session")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestRequireCapabilities(t *testing.T) {
+	sess := newSession(nil)
+	sess.serverCaps = newCapabilitySet(
+		"urn:ietf:params:netconf:base:1.1",
+		":candidate:1.0",
+		":url:1.0?scheme=file,https",
+	)
+
+	assert.NoError(t, sess.RequireCapabilities(":candidate:1.0", ":url:1.0", ":url:1.0?scheme=file,https"))
+
+	err := sess.RequireCapabilities(":candidate:1.0", ":validate:1.1", ":rollback-on-error:1.0", ":url:1.0?scheme=ftp")
+	var missingErr *MissingCapabilitiesError
+	require.ErrorAs(t, err, &missingErr)
+	assert.Equal(t, []string{":validate:1.1", ":rollback-on-error:1.0", ":url:1.0?scheme=ftp"}, missingErr.Missing)
+	assert.EqualError(t, err, "device is missing required capabilities: :validate:1.1, :rollback-on-error:1.0, :url:1.0?scheme=ftp")
+}
+
+func TestOpenRequiredCapabilities(t *testing.T) {
+	tr := &syncTransport{}
+	sess, err := Open(tr, WithSynchronous(), WithRequiredCapabilities("urn:ietf:params:netconf:base:1.1", ":candidate:1.0"))
+	assert.Nil(t, sess)
+
+	var missingErr *MissingCapabilitiesError
+	require.ErrorAs(t, err, &missingErr)
+	assert.Equal(t, []string{":candidate:1.0"}, missingErr.Missing)
+	assert.True(t, tr.closed, "transport not closed")
+
+	tr = &syncTransport{}
+	sess, err = Open(tr, WithSynchronous(), WithRequiredCapabilities("urn:ietf:params:netconf:base:1.1"))
+	require.NoError(t, err)
+	assert.NoError(t, sess.Close(context.Background()))
+}
+
+func TestOpenLenientHelloFraming(t *testing.T) {
+	// a chunk-framed hello without the leading newline which is split in the
+	// middle of the element name so it does not parse as is.
+	hello := strings.TrimSpace(helloGood)
+	chunked := fmt.Sprintf("#3\n%s\n#%d\n%s\n##\n", hello[:3], len(hello)-3, hello[3:])
+
+	tr := &syncTransport{pending: [][]byte{[]byte(chunked)}}
+	_, err := Open(tr, WithSynchronous())
+	assert.ErrorContains(t, err, "failed to read server hello message")
+
+	tr = &syncTransport{pending: [][]byte{[]byte(chunked)}}
+	sess, err := Open(tr, WithSynchronous(), WithLenientHelloFraming())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), sess.SessionID())
+	assert.Equal(t, []string{"urn:ietf:params:netconf:base:1.0", "urn:ietf:params:netconf:base:1.1"}, sess.RawServerCapabilities())
+
+	// a compliant hello is unaffected
+	tr = &syncTransport{}
+	sess, err = Open(tr, WithSynchronous(), WithLenientHelloFraming())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), sess.SessionID())
+	assert.NoError(t, sess.Close(context.Background()))
+}
+
+func TestOpenHelloRewriter(t *testing.T) {
+	hello := []byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+    <capability>
+      urn:ietf:params:netconf:capability:candidate:1.0
+    </capability>
+  </capabilities>
+  <session-id>42</session-id>
+</hello>`)
+
+	// the whitespace is part of the capability as far as the parser cares
+	tr := &syncTransport{pending: [][]byte{hello}}
+	_, err := Open(tr, WithSynchronous(), WithRequiredCapabilities(":candidate:1.0"))
+	var missing *MissingCapabilitiesError
+	require.ErrorAs(t, err, &missing)
+
+	capRe := regexp.MustCompile(`<capability>\s*(.*?)\s*</capability>`)
+	trim := func(hello []byte) ([]byte, error) {
+		return capRe.ReplaceAll(hello, []byte("<capability>$1</capability>")), nil
+	}
+	tr = &syncTransport{pending: [][]byte{hello}}
+	sess, err := Open(tr, WithSynchronous(), WithRequiredCapabilities(":candidate:1.0"), WithHelloRewriter(trim))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), sess.SessionID())
+	assert.Equal(t, []string{
+		"urn:ietf:params:netconf:base:1.0",
+		"urn:ietf:params:netconf:capability:candidate:1.0",
+	}, sess.RawServerCapabilities())
+
+	errRejected := errors.New("rejected")
+	tr = &syncTransport{}
+	_, err = Open(tr, WithSynchronous(), WithHelloRewriter(func([]byte) ([]byte, error) { return nil, errRejected }))
+	assert.ErrorIs(t, err, errRejected)
+}
+
+func TestOpenCapabilityGuard(t *testing.T) {
+	errForbidden := errors.New("forbidden capability")
+	guard := func(caps Capabilities) error {
+		if caps.Has("urn:ietf:params:netconf:base:1.0") {
+			return errForbidden
+		}
+		return nil
+	}
+
+	tr := &syncTransport{}
+	sess, err := Open(tr, WithSynchronous(), WithCapabilityGuard(guard))
+	assert.Nil(t, sess)
+	assert.ErrorIs(t, err, errForbidden)
+	assert.True(t, tr.closed, "transport not closed")
+	// nothing is sent after the hello
+	assert.Len(t, tr.sent, 1)
+
+	var got []string
+	tr = &syncTransport{}
+	sess, err = Open(tr, WithSynchronous(), WithCapabilityGuard(func(caps Capabilities) error {
+		got = caps.All()
+		if caps.Has(":candidate:1.0") {
+			return errForbidden
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"urn:ietf:params:netconf:base:1.0", "urn:ietf:params:netconf:base:1.1"}, got)
+	assert.NoError(t, sess.Close(context.Background()))
+}
+
+func TestOpenStream(t *testing.T) {
+	// a duplex pipe standing in for a byte stream set up by other means
+	cr, sw, err := os.Pipe()
+	require.NoError(t, err)
+	sr, cw, err := os.Pipe()
+	require.NoError(t, err)
+
+	server := &pipeTransport{Framer: transport.NewFramer(sr, sw), close: func() error {
+		sr.Close()
+		return sw.Close()
+	}}
+	defer server.Close()
+	go func() {
+		w, err := server.MsgWriter()
+		if err != nil {
+			return
+		}
+		_, _ = io.WriteString(w, helloGood)
+		if w.Close() != nil {
+			return
+		}
+		r, err := server.MsgReader()
+		if err != nil {
+			return
+		}
+		if _, err := io.ReadAll(r); err != nil {
+			return
+		}
+		server.Upgrade()
+		serveOK(server)
+	}()
+
+	tr := transport.NewStream(cr, cw, func() error {
+		cr.Close()
+		return cw.Close()
+	})
+	sess, err := Open(tr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), sess.SessionID())
+
+	require.NoError(t, sess.Lock(context.Background(), Candidate))
+	assert.NoError(t, sess.Close(context.Background()))
+}
+
+type usernameTransport struct {
+	*pipeTransport
+}
+
+func (usernameTransport) Username() string { return "admin" }
+
+func TestUsername(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	assert.Equal(t, "", newSession(client).Username())
+	assert.Equal(t, "admin", newSession(usernameTransport{client}).Username())
+}
+
+// maxWriteTransport records the largest single write of a message.
+type maxWriteTransport struct {
+	*pipeTransport
+	maxWrite int
+	writes   int
+}
+
+type maxWriter struct {
+	io.WriteCloser
+	t *maxWriteTransport
+}
+
+func (w *maxWriter) Write(p []byte) (int, error) {
+	w.t.writes++
+	if len(p) > w.t.maxWrite {
+		w.t.maxWrite = len(p)
+	}
+	return w.WriteCloser.Write(p)
+}
+
+func (t *maxWriteTransport) MsgWriter() (io.WriteCloser, error) {
+	w, err := t.pipeTransport.MsgWriter()
+	if err != nil {
+		return nil, err
+	}
+	return &maxWriter{WriteCloser: w, t: t}, nil
+}
+
+func TestEncodeRPC(t *testing.T) {
+	type intf struct {
+		Name        string `xml:"name"`
+		Description string `xml:"description"`
+	}
+	cfg := struct {
+		XMLName    xml.Name  `xml:"edit-config"`
+		Target     Datastore `xml:"target"`
+		Interfaces []intf    `xml:"config>interfaces>interface"`
+	}{Target: Candidate}
+	for i := 0; i < 20000; i++ {
+		cfg.Interfaces = append(cfg.Interfaces, intf{Name: fmt.Sprintf("ge-0/0/%d", i), Description: "uplink"})
+	}
+
+	client, server := newPipeTransports()
+	defer server.Close()
+	sent := make(chan []byte, 1)
+	go serveOKRecorded(server, sent)
+
+	tr := &maxWriteTransport{pipeTransport: client}
+	sess := newSession(tr)
+	go sess.recv()
+
+	reply, err := sess.EncodeRPC(context.Background(), &cfg)
+	require.NoError(t, err)
+	assert.NoError(t, reply.Err())
+
+	want, err := xml.Marshal(&request{MessageID: 1, Operation: &cfg})
+	require.NoError(t, err)
+	got := <-sent
+	assert.Equal(t, string(want), strings.TrimSuffix(string(got), "\n"))
+
+	// the message (over 1MB) was never held in full
+	assert.Greater(t, len(want), 1<<20)
+	assert.LessOrEqual(t, tr.maxWrite, 4096)
+	assert.Greater(t, tr.writes, len(want)/4096)
+}
+
+func TestEncodeRPCMarshalError(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+	go serveOK(server)
+
+	sess := newSession(client)
+	go sess.recv()
+
+	op := struct {
+		XMLName xml.Name `xml:"edit-config"`
+		Config  any      `xml:"config"`
+	}{Config: failMarshal{}}
+	_, err := sess.EncodeRPC(context.Background(), &op)
+	assert.ErrorContains(t, err, "marshal failed")
+
+	// the partial message can't be taken back so the session is closed
+	select {
+	case <-sess.done:
+	case <-time.After(time.Second):
+		t.Fatal("session was not closed")
+	}
+}
+
+func TestCallVendorRPC(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	const junosNS = "http://xml.juniper.net/junos/23.4R1/junos-interface"
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:junos="http://xml.juniper.net/junos/23.4R1/junos" message-id="1">` +
+		`<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity></rpc-error>` +
+		`<interface-information xmlns="` + junosNS + `" junos:style="terse">` +
+		`<physical-interface><name>ge-0/0/0</name><oper-status>up</oper-status></physical-interface>` +
+		`<physical-interface><name>ge-0/0/1</name><oper-status>down</oper-status></physical-interface>` +
+		`</interface-information></rpc-reply>`)
+
+	req := struct {
+		XMLName xml.Name   `xml:"http://xml.juniper.net/junos/23.4R1/junos-interface get-interface-information"`
+		Terse   ExtantBool `xml:"terse"`
+	}{Terse: true}
+
+	var info struct {
+		XMLName    xml.Name `xml:"http://xml.juniper.net/junos/23.4R1/junos-interface interface-information"`
+		Style      string   `xml:"http://xml.juniper.net/junos/23.4R1/junos style,attr"`
+		Interfaces []struct {
+			Name   string `xml:"name"`
+			Status string `xml:"oper-status"`
+		} `xml:"physical-interface"`
+	}
+	require.NoError(t, sess.Call(context.Background(), &req, &info))
+
+	sentMsg, err := ts.popReqString()
+	require.NoError(t, err)
+	assert.Contains(t, sentMsg, `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">`+
+		`<get-interface-information xmlns="`+junosNS+`"><terse></terse></get-interface-information></rpc>`)
+
+	assert.Equal(t, "terse", info.Style)
+	require.Len(t, info.Interfaces, 2)
+	assert.Equal(t, "ge-0/0/1", info.Interfaces[1].Name)
+	assert.Equal(t, "down", info.Interfaces[1].Status)
+}
+
+func TestWithIndent(t *testing.T) {
+	tt := []struct {
+		name string
+		opts []SessionOption
+		want string
+	}{
+		{
+			name: "compact",
+			want: `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">` +
+				`<edit-config><target><running/></target><config><system><host-name>dark star</host-name></system></config></edit-config>` +
+				`</rpc>`,
+		},
+		{
+			name: "indented",
+			opts: []SessionOption{WithIndent("  ")},
+			want: `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+  <edit-config>
+    <target><running/></target>
+    <config>
+      <system>
+        <host-name>dark star</host-name>
+      </system>
+    </config>
+  </edit-config>
+</rpc>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport(), tc.opts...)
+			go sess.recv()
+
+			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+			cfg := structuredCfg{System: structuredCfgSystem{Hostname: "dark star"}}
+			require.NoError(t, sess.EditConfig(context.Background(), Running, cfg))
+
+			sent, err := ts.popReqString()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, sent)
+		})
+	}
+}
+
+func TestCallEnvelope(t *testing.T) {
+	tt := []struct {
+		name string
+		opts []CallOption
+		want string
+	}{
+		{
+			name: "rpc",
+			want: `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><get-status xmlns="urn:example:shim"/></rpc>`,
+		},
+		{
+			name: "custom",
+			opts: []CallOption{WithEnvelope("shim-request")},
+			want: `<shim-request xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><get-status xmlns="urn:example:shim"/></shim-request>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			go sess.recv()
+
+			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+			var resp OKResp
+			require.NoError(t, sess.Call(context.Background(), `<get-status xmlns="urn:example:shim"/>`, &resp, tc.opts...))
+
+			sent, err := ts.popReqString()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, sent)
+		})
+	}
+}
+
+func TestUnsolicitedReplyHandler(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	pushes := []string{
+		`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="99"><alarm xmlns="urn:example:push">fan failed</alarm></rpc-reply>`,
+		`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><alarm xmlns="urn:example:push">fan ok</alarm></rpc-reply>`,
+	}
+	go func() {
+		for _, push := range pushes {
+			w, err := server.MsgWriter()
+			if err != nil {
+				return
+			}
+			_, _ = io.WriteString(w, push)
+			if err := w.Close(); err != nil {
+				return
+			}
+		}
+		serveOK(server)
+	}()
+
+	got := make(chan Reply, len(pushes))
+	sess := newSession(client, WithUnsolicitedReplyHandler(func(r Reply) { got <- r }))
+	go sess.recv()
+
+	for _, want := range []struct {
+		msgID uint64
+		alarm string
+	}{{99, "fan failed"}, {0, "fan ok"}} {
+		select {
+		case reply := <-got:
+			assert.Equal(t, want.msgID, reply.MessageID)
+			assert.Contains(t, string(reply.Body), want.alarm)
+		case <-time.After(time.Second):
+			t.Fatal("unsolicited reply not delivered")
+		}
+	}
+
+	// replies to rpcs are unaffected
+	_, err := sess.Do(context.Background(), "<get/>")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
@@ -0,0 +1,265 @@
+package netconf
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// recordingReader is the reader given to the xml.Decoder in recvMsg.  It
+// implements io.ByteReader so that the decoder doesn't buffer on it's own
+// which means the bytes read from it line up with xml.Decoder.InputOffset.
+// While recording, the raw bytes read are kept so they can be copied out
+// verbatim.
+type recordingReader struct {
+	r io.ByteReader
+
+	recording bool
+	buf       []byte
+	// off is the input offset of buf[0]
+	off int64
+}
+
+func newRecordingReader(r io.Reader) *recordingReader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &recordingReader{r: br}
+}
+
+func (r *recordingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil && r.recording {
+		r.buf = append(r.buf, b)
+	}
+	return b, err
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	p[0] = b
+	return 1, nil
+}
+
+// record starts recording from the input offset `off`.
+func (r *recordingReader) record(off int64) {
+	r.recording = true
+	r.buf = r.buf[:0]
+	r.off = off
+}
+
+// flush writes the recorded bytes up to the input offset `off` to w.  If w is
+// nil they are dropped.
+func (r *recordingReader) flush(w io.Writer, off int64) error {
+	n := int(off - r.off)
+	var err error
+	if w != nil {
+		_, err = w.Write(r.buf[:n])
+	}
+	r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+	r.off = off
+	return err
+}
+
+func (r *recordingReader) stop() {
+	r.recording = false
+	r.buf = nil
+}
+
+// spoolReq returns the pending request for the reply if it's `<data>` is
+// to be spooled or it's errors are to be delivered as they are decoded.  The
+// request is removed from the pending requests.
+func (s *Session) spoolReq(root *xml.StartElement) *req {
+	var msgID uint64
+	for _, attr := range root.Attr {
+		if attr.Name.Local == "message-id" {
+			msgID, _ = strconv.ParseUint(attr.Value, 10, 64)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.reqs[msgID]
+	if !ok || (req.spool == nil && req.onError == nil) {
+		return nil
+	}
+	delete(s.reqs, msgID)
+	s.markReplied(msgID)
+	return req
+}
+
+// recvSpooledReply decodes a `<rpc-reply>` streaming the contents of `<data>`
+// to the request's spool and each `<rpc-error>` to it's onError.  The
+// returned reply has an empty Body.
+func (s *Session) recvSpooledReply(dec *xml.Decoder, rec *recordingReader, root *xml.StartElement, req *req) error {
+	reply := Reply{
+		XMLName: root.Name,
+		nsDecls: prefixDecls(root.Attr),
+	}
+	for _, attr := range root.Attr {
+		if attr.Name.Local == "message-id" {
+			reply.MessageID, _ = strconv.ParseUint(attr.Value, 10, 64)
+		}
+	}
+
+	var spoolErr error
+	fail := func(err error) error {
+		req.err = fmt.Errorf("failed to decode rpc-reply message: %w", err)
+		close(req.reply)
+		return req.err
+	}
+
+	for done := false; !done; {
+		tok, err := dec.Token()
+		if err != nil {
+			return fail(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case tok.Name.Space == baseNamespace && tok.Name.Local == "rpc-error":
+				var rpcErr RPCError
+				if err := dec.DecodeElement(&rpcErr, &tok); err != nil {
+					return fail(err)
+				}
+				reply.Errors = append(reply.Errors, rpcErr)
+				if req.onError != nil {
+					rpcErr.inheritPathNamespaces(reply.nsDecls)
+					req.onError(rpcErr)
+				}
+			case tok.Name.Local == "data" && req.spool != nil:
+				spoolErr, err = spoolData(dec, rec, req.spool)
+				if err != nil {
+					return fail(err)
+				}
+			default:
+				if err := dec.Skip(); err != nil {
+					return fail(err)
+				}
+			}
+		case xml.EndElement:
+			done = true
+		}
+	}
+
+	reply.Errors.inheritPathNamespaces(reply.nsDecls)
+
+	if spoolErr != nil {
+		req.err = fmt.Errorf("failed to spool reply data: %w", spoolErr)
+		close(req.reply)
+		return msgError{req.err}
+	}
+
+	select {
+	case req.reply <- reply:
+		return nil
+	case <-req.ctx.Done():
+		return msgError{fmt.Errorf("message %d context canceled: %s", reply.MessageID, req.ctx.Err().Error())}
+	}
+}
+
+// spoolData copies the raw contents of `<data>` (the start element has
+// already been read) to w.  The first error from writing to w is returned
+// separately as the rest of the element still needs to be read.
+func spoolData(dec *xml.Decoder, rec *recordingReader, w io.Writer) (writeErr, err error) {
+	rec.record(dec.InputOffset())
+	defer rec.stop()
+
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return writeErr, err
+		}
+
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				// this is the `</data>` which is not part of the contents
+				return writeErr, nil
+			}
+			depth--
+		}
+
+		if writeErr != nil {
+			w = nil
+		}
+		if err := rec.flush(w, dec.InputOffset()); err != nil {
+			writeErr = err
+		}
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// GetConfigToFile issues a `<get-config>` like [Session.GetConfig] but streams
+// the contents of `<data>` in the reply straight to the file at `path` instead
+// of keeping it in memory.  This is meant for archiving very large configs.
+// When path is empty a new temporary file is created.  The path and size of the
+// written file is returned.  On error the file is removed.
+//
+// The data is written exactly as it was received (without framing).  Unlike
+// [Session.GetConfig] namespace prefixes declared on `<rpc-reply>` or `<data>`
+// are not re-declared in the file.
+func (s *Session) GetConfigToFile(ctx context.Context, source Datastore, filter *Filter, path string) (string, int64, error) {
+	var (
+		f   *os.File
+		err error
+	)
+	if path == "" {
+		f, err = os.CreateTemp("", "netconf-config-*.xml")
+	} else {
+		f, err = os.Create(path)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	bw := bufio.NewWriterSize(f, 64*1024)
+	cw := &countingWriter{w: bw}
+	msg := &request{
+		MessageID: s.seq.Add(1),
+		Operation: &GetConfigReq{Source: source, Filter: filter},
+		spool:     cw,
+	}
+
+	reply, err := s.doMsg(ctx, msg)
+	if err == nil {
+		err = reply.Err()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+
+	return f.Name(), cw.n, nil
+}
@@ -0,0 +1,105 @@
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConfigToFile(t *testing.T) {
+	var data strings.Builder
+	data.WriteString(`<if:interfaces xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces">`)
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&data, "\n  <if:interface><if:name>ge-0/0/%d</if:name><if:description>uplink &amp; &lt;core&gt;</if:description><!-- note --><if:enabled/></if:interface>", i)
+	}
+	data.WriteString(`<![CDATA[ <not-xml> ]]></if:interfaces>` + "\n")
+	want := data.String()
+
+	tt := []struct {
+		name    string
+		reply   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "large",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>` + want + `</data></rpc-reply>`,
+			want:  want,
+		},
+		{
+			name:  "prefixed data",
+			reply: `<nc:rpc-reply xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><nc:data><system/></nc:data></nc:rpc-reply>`,
+			want:  `<system/>`,
+		},
+		{
+			name:  "empty",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data/></rpc-reply>`,
+		},
+		{
+			name: "rpc-error",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">` +
+				`<rpc-error><error-type>application</error-type><error-tag>access-denied</error-tag><error-severity>error</error-severity></rpc-error>` +
+				`</rpc-reply>`,
+			wantErr: "access-denied",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			go sess.recv()
+
+			ts.queueRespString(tc.reply)
+
+			path := filepath.Join(t.TempDir(), "config.xml")
+			gotPath, size, err := sess.GetConfigToFile(context.Background(), Running, SubtreeFilter("<interfaces/>"), path)
+
+			sentMsg, popErr := ts.popReqString()
+			require.NoError(t, popErr)
+			assert.Contains(t, sentMsg, `<get-config><source><running/></source><filter type="subtree"><interfaces/></filter></get-config>`)
+
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				assert.NoFileExists(t, path)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, path, gotPath)
+			assert.Equal(t, int64(len(tc.want)), size)
+
+			got, err := os.ReadFile(gotPath)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+
+			// the session keeps working after a spooled reply
+			ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="2"><data>foo</data></rpc-reply>`)
+			cfg, err := sess.GetConfig(context.Background(), Running)
+			require.NoError(t, err)
+			assert.Equal(t, "foo", string(cfg))
+		})
+	}
+}
+
+func TestGetConfigToTempFile(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data><system/></data></rpc-reply>`)
+
+	path, size, err := sess.GetConfigToFile(context.Background(), Running, nil, "")
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "<system/>", string(got))
+	assert.Equal(t, int64(9), size)
+}
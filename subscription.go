@@ -0,0 +1,404 @@
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSubscriptionExists is returned from [Session.Subscribe] when the session
+// already has a subscription and the device doesn't advertise the
+// `:interleave` capability so it only supports one subscription per session.
+var ErrSubscriptionExists = errors.New("netconf: device only supports one subscription per session")
+
+// ErrSubscriptionSilent is wrapped by the errors sent on
+// [Subscription.Liveness] when no notification was received within the
+// liveness timeout.
+var ErrSubscriptionSilent = errors.New("netconf: no notifications received on subscription")
+
+// subscribedNotificationsNamespace is the namespace of the dynamic
+// subscriptions defined in RFC8639.
+const subscribedNotificationsNamespace = "urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications"
+
+// subscriptionBuffer is the number of notifications buffered for each
+// subscription.
+const subscriptionBuffer = 16
+
+// Subscription is a notification subscription created with
+// [Session.Subscribe].
+type Subscription struct {
+	s     *Session
+	match func(Notification) bool
+	ch    chan Notification
+
+	// done is closed when the subscription is closed.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// sendMu is held while routing a notification to ch so that ch can be
+	// closed from outside the receive loop.
+	sendMu   sync.Mutex
+	chClosed bool
+
+	// seen is signaled for every notification routed to the subscription
+	// for the liveness watcher.
+	seen     chan struct{}
+	liveness chan error
+
+	watchMu   sync.Mutex
+	stopWatch chan struct{}
+
+	// dynamic is set for a RFC8639 subscription with the id the device
+	// assigned to it.
+	dynamic bool
+	id      uint32
+}
+
+// Subscribe issues a `<create-subscription>` (see [Session.CreateSubscription])
+// and returns a Subscription receiving the notifications for which `match`
+// returns true.  `match` is typically based on the event element (see
+// [Notification.Event]) of the notifications sent on the stream or filter of
+// the subscription as the device doesn't say which subscription a notification
+// belongs to.
+//
+// Each notification goes to the first subscription it matches in the order
+// they were created.  Subscriptions with a nil match get the notifications
+// that none of the others matched.  Notifications are still passed to the
+// notification handler set with [WithNotificationHandler].
+//
+// More than one subscription can only be created on devices that advertise
+// the `:interleave` capability, otherwise [ErrSubscriptionExists] is returned
+// for the second one.
+//
+// The subscription lasts until `ctx` is done (or the session is closed).  It
+// is then closed (see [Subscription.Close]) and the channel closed right away
+// even if a notification is still being read; the session carries on reading
+// it as the transport is shared with the other rpcs.
+//
+// Devices advertising the `ietf-subscribed-notifications` module in their
+// hello get a dynamic subscription from [RFC8639] with an
+// `<establish-subscription>` instead so that it can be ended with
+// [Subscription.Stop].  The options map onto the same parameters of it.
+//
+// [RFC8639]: https://www.rfc-editor.org/rfc/rfc8639.html
+func (s *Session) Subscribe(ctx context.Context, match func(Notification) bool, opts ...CreateSubscriptionOption) (*Subscription, error) {
+	return s.subscribe(ctx, ctx, match, opts...)
+}
+
+// subscribe is Subscribe with the subscription lasting until `life` is done
+// instead of the context of the rpc.
+func (s *Session) subscribe(ctx, life context.Context, match func(Notification) bool, opts ...CreateSubscriptionOption) (*Subscription, error) {
+	sub := &Subscription{
+		s:        s,
+		match:    match,
+		ch:       make(chan Notification, subscriptionBuffer),
+		done:     make(chan struct{}),
+		seen:     make(chan struct{}, 1),
+		liveness: make(chan error, 1),
+	}
+
+	// the subscription is added before the rpc so the first notifications
+	// (possibly sent before the reply) aren't lost.
+	s.notifMu.Lock()
+	if s.subsClosed {
+		s.notifMu.Unlock()
+		return nil, ErrClosed
+	}
+	if len(s.subs) > 0 && !s.serverCapSet().Has(interleaveCap) {
+		s.notifMu.Unlock()
+		return nil, ErrSubscriptionExists
+	}
+	s.subs = append(s.subs, sub)
+	s.notifMu.Unlock()
+
+	var err error
+	if s.serverCapSet().advertises(subscribedNotificationsNamespace) {
+		sub.id, err = s.establishSubscription(ctx, newCreateSubscriptionReq(opts...))
+		sub.dynamic = true
+	} else {
+		err = s.CreateSubscription(ctx, opts...)
+	}
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	if life.Done() != nil {
+		go func() {
+			select {
+			case <-life.Done():
+				sub.Close()
+			case <-sub.done:
+			case <-s.done:
+			}
+		}()
+	}
+	return sub, nil
+}
+
+type establishSubscriptionReq struct {
+	XMLName         xml.Name             `xml:"urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications establish-subscription"`
+	Stream          string               `xml:"stream"`
+	SubtreeFilter   *streamSubtreeFilter `xml:"stream-subtree-filter,omitempty"`
+	XPathFilter     *streamXPathFilter   `xml:"stream-xpath-filter,omitempty"`
+	ReplayStartTime string               `xml:"replay-start-time,omitempty"`
+	StopTime        string               `xml:"stop-time,omitempty"`
+}
+
+type streamSubtreeFilter struct {
+	Content []byte `xml:",innerxml"`
+}
+
+// streamXPathFilter keeps the namespace declarations of the [XPathFilter] so
+// the prefixes in the expression still resolve.
+type streamXPathFilter struct {
+	NamespaceDecls []xml.Attr `xml:",any,attr"`
+	Select         string     `xml:",chardata"`
+}
+
+type establishSubscriptionReply struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications id"`
+	ID      uint32   `xml:",chardata"`
+}
+
+type deleteSubscriptionReq struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications delete-subscription"`
+	ID      uint32   `xml:"id"`
+}
+
+// establishSubscription issues an `<establish-subscription>` with the
+// parameters of the `<create-subscription>` and returns the id of the
+// subscription.  The stream defaults to `NETCONF` the same as RFC5277.
+func (s *Session) establishSubscription(ctx context.Context, create *CreateSubscriptionReq) (uint32, error) {
+	req := establishSubscriptionReq{
+		Stream:          create.Stream,
+		ReplayStartTime: create.StartTime,
+		StopTime:        create.EndTime,
+	}
+	if req.Stream == "" {
+		req.Stream = "NETCONF"
+	}
+	if f := create.Filter; f != nil {
+		if f.Type == "xpath" {
+			req.XPathFilter = &streamXPathFilter{NamespaceDecls: f.NamespaceDecls, Select: f.Select}
+		} else {
+			req.SubtreeFilter = &streamSubtreeFilter{Content: f.Content}
+		}
+	}
+
+	var resp establishSubscriptionReply
+	if err := s.Call(ctx, &req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+// Notifications returns the channel the matching notifications are sent on.
+// It is closed once the subscription is closed or stopped, the session is
+// closed or the context given to [Session.Subscribe] is done.  The receive loop of the session
+// waits while the channel is full so it must be drained.
+func (sub *Subscription) Notifications() <-chan Notification { return sub.ch }
+
+// Liveness returns the channel silence on the subscription is reported on
+// (see [Subscription.SetLivenessTimeout]).  Reports are dropped while the
+// previous one hasn't been read.
+func (sub *Subscription) Liveness() <-chan error { return sub.liveness }
+
+// SetLivenessTimeout reports an error wrapping [ErrSubscriptionSilent] on
+// [Subscription.Liveness] every time no notification (including any heartbeat
+// or periodic notifications from the device) has been routed to the
+// subscription for `d`.  A zero `d` stops watching.
+//
+// A long silence can mean a quiet stream or a dead link.  When `keepalive` is
+// not nil it is called (with a context timing out after `d`) before reporting
+// to tell the two apart: its error is wrapped as well when it fails.  This is
+// typically [Session.Ping] or a keepalive sent with the transport (i.e the
+// `SendRequest` of the ssh transport).
+func (sub *Subscription) SetLivenessTimeout(d time.Duration, keepalive func(context.Context) error) {
+	sub.watchMu.Lock()
+	defer sub.watchMu.Unlock()
+
+	if sub.stopWatch != nil {
+		close(sub.stopWatch)
+		sub.stopWatch = nil
+	}
+	if d <= 0 {
+		return
+	}
+
+	sub.stopWatch = make(chan struct{})
+	go sub.watch(d, keepalive, sub.stopWatch)
+}
+
+func (sub *Subscription) watch(d time.Duration, keepalive func(context.Context) error, stop <-chan struct{}) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-sub.seen:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+			err := fmt.Errorf("%w for %s", ErrSubscriptionSilent, d)
+			if keepalive != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), d)
+				if kaErr := keepalive(ctx); kaErr != nil {
+					err = fmt.Errorf("%w and keepalive failed: %w", err, kaErr)
+				}
+				cancel()
+			}
+			select {
+			case sub.liveness <- err:
+			default:
+			}
+		case <-stop:
+			return
+		case <-sub.done:
+			return
+		case <-sub.s.done:
+			return
+		}
+		timer.Reset(d)
+	}
+}
+
+// Stop ends the subscription on the device.  A dynamic subscription (see
+// [Session.Subscribe]) is ended with a `<delete-subscription>` and closed
+// once the device accepted it.  A RFC5277 subscription can only be ended by
+// closing the session so Stop closes the subscription and then the session
+// (with any other subscriptions on it).
+func (sub *Subscription) Stop(ctx context.Context) error {
+	if !sub.dynamic {
+		sub.Close()
+		return sub.s.Close(ctx)
+	}
+
+	var resp OKResp
+	if err := sub.s.Call(ctx, &deleteSubscriptionReq{ID: sub.id}, &resp); err != nil {
+		return err
+	}
+	sub.Close()
+	return nil
+}
+
+// Close stops notifications being routed to this subscription and closes
+// it's channel.  The device keeps sending them (until the session is closed
+// or the subscription is ended with [Subscription.Stop]); they go to any other
+// matching subscription instead.
+func (sub *Subscription) Close() {
+	sub.closeOnce.Do(func() { close(sub.done) })
+
+	s := sub.s
+	s.notifMu.Lock()
+	for i, other := range s.subs {
+		if other == sub {
+			s.subs = append(s.subs[:i:i], s.subs[i+1:]...)
+			break
+		}
+	}
+	s.notifMu.Unlock()
+
+	// routing gives up on sending once done is closed so it doesn't hold
+	// sendMu for long.
+	sub.closeCh()
+}
+
+func (s *Session) hasSubscriptions() bool {
+	s.notifMu.Lock()
+	defer s.notifMu.Unlock()
+	return len(s.subs) > 0
+}
+
+// routeNotification sends the notification to the subscription it belongs to
+// (if any).
+func (s *Session) routeNotification(n Notification) {
+	s.notifMu.Lock()
+	subs := append([]*Subscription(nil), s.subs...)
+	s.notifMu.Unlock()
+
+	var target *Subscription
+	for _, sub := range subs {
+		if sub.match != nil && sub.match(n) {
+			target = sub
+			break
+		}
+	}
+	if target == nil {
+		for _, sub := range subs {
+			if sub.match == nil {
+				target = sub
+				break
+			}
+		}
+	}
+	if target == nil {
+		return
+	}
+
+	select {
+	case target.seen <- struct{}{}:
+	default:
+	}
+
+	target.sendMu.Lock()
+	defer target.sendMu.Unlock()
+	if target.chClosed {
+		return
+	}
+	select {
+	case target.ch <- n:
+	case <-target.done:
+	}
+}
+
+// closeCh closes the notification channel.  The subscription must already be
+// closed (or the receive loop exited) so that routing doesn't hold sendMu.
+func (sub *Subscription) closeCh() {
+	sub.sendMu.Lock()
+	defer sub.sendMu.Unlock()
+	if !sub.chClosed {
+		close(sub.ch)
+		sub.chClosed = true
+	}
+}
+
+// closeSubscriptions closes the channels of all subscriptions once the
+// receive loop has exited.
+func (s *Session) closeSubscriptions() {
+	s.notifMu.Lock()
+	defer s.notifMu.Unlock()
+
+	for _, sub := range s.subs {
+		sub.closeCh()
+	}
+	s.subs = nil
+	s.subsClosed = true
+}
+
+// SubscribeConfigChanges subscribes to the `NETCONF` stream with a filter for
+// the `<netconf-config-change>` notifications defined in RFC6470.  Use
+// [Notification.ConfigChange] to decode the notifications:
+//
+//	sub, err := s.SubscribeConfigChanges(ctx)
+//	...
+//	for n := range sub.Notifications() {
+//		change, err := n.ConfigChange()
+//		...
+//	}
+//
+// `opts` are added to the `<create-subscription>` (i.e a start time to replay
+// past changes).
+func (s *Session) SubscribeConfigChanges(ctx context.Context, opts ...CreateSubscriptionOption) (*Subscription, error) {
+	filter := SubtreeFilter(`<netconf-config-change xmlns="` + ncNotificationsNamespace + `"/>`)
+	opts = append([]CreateSubscriptionOption{WithStreamOption("NETCONF"), WithFilterOption(filter)}, opts...)
+
+	return s.Subscribe(ctx, func(n Notification) bool {
+		name, _, err := n.Event()
+		return err == nil && name == xml.Name{Space: ncNotificationsNamespace, Local: "netconf-config-change"}
+	}, opts...)
+}
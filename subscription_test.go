@@ -0,0 +1,337 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dau71/netconf/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveSubscriptions replies `<ok/>` to `n` rpcs (sending each to `sent` if not
+// nil) and then sends the notifications.
+func serveSubscriptions(tr *pipeTransport, sent chan<- []byte, n int, notifs ...string) {
+	for i := 0; i < n; i++ {
+		r, err := tr.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+		if sent != nil {
+			sent <- msg
+		}
+		var msgID []byte
+		if m := msgIDRe.FindSubmatch(msg); m != nil {
+			msgID = m[1]
+		}
+
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, msgID)
+		if err := w.Close(); err != nil {
+			return
+		}
+	}
+
+	for _, notif := range notifs {
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return
+		}
+		_, _ = io.WriteString(w, notif)
+		if err := w.Close(); err != nil {
+			return
+		}
+	}
+}
+
+func isEvent(local string) func(Notification) bool {
+	return func(n Notification) bool {
+		name, _, err := n.Event()
+		return err == nil && name.Local == local
+	}
+}
+
+func recvNotification(t *testing.T, sub *Subscription) Notification {
+	t.Helper()
+	select {
+	case n, ok := <-sub.Notifications():
+		require.True(t, ok, "subscription closed")
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no notification received")
+		return Notification{}
+	}
+}
+
+func TestSubscriptionRouting(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+	go serveSubscriptions(server, nil, 2, notifLinkDown, notifConfigChange, notifUnknown)
+
+	sess := newSession(client)
+	sess.serverCaps = newCapabilitySet(":notification:1.0", ":interleave:1.0")
+	go sess.recv()
+
+	ctx := context.Background()
+	links, err := sess.Subscribe(ctx, isEvent("link-down"), WithStreamOption("links"))
+	require.NoError(t, err)
+	rest, err := sess.Subscribe(ctx, nil)
+	require.NoError(t, err)
+
+	assert.True(t, isEvent("link-down")(recvNotification(t, links)))
+	assert.True(t, isEvent("netconf-config-change")(recvNotification(t, rest)))
+	assert.True(t, isEvent("something-else")(recvNotification(t, rest)))
+
+	select {
+	case n := <-links.Notifications():
+		t.Fatalf("unexpected notification on links subscription: %s", n.Body)
+	default:
+	}
+
+	// the channels are closed with the session
+	server.Close()
+	<-sess.done
+	_, ok := <-links.Notifications()
+	assert.False(t, ok)
+}
+
+func TestSubscriptionWithoutInterleave(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+	go serveSubscriptions(server, nil, 1)
+
+	sess := newSession(client)
+	sess.serverCaps = newCapabilitySet(":notification:1.0")
+	go sess.recv()
+
+	ctx := context.Background()
+	_, err := sess.Subscribe(ctx, nil)
+	require.NoError(t, err)
+
+	// nothing is sent to the device for the second subscription
+	_, err = sess.Subscribe(ctx, isEvent("link-down"))
+	assert.ErrorIs(t, err, ErrSubscriptionExists)
+}
+
+func TestSubscribeConfigChanges(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+	sent := make(chan []byte, 1)
+	go serveSubscriptions(server, sent, 1, notifLinkDown, notifConfigChange)
+
+	sess := newSession(client)
+	sess.serverCaps = newCapabilitySet(":notification:1.0")
+	go sess.recv()
+
+	sub, err := sess.SubscribeConfigChanges(context.Background())
+	require.NoError(t, err)
+
+	assert.Contains(t, string(<-sent), `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">`+
+		`<stream>NETCONF</stream>`+
+		`<filter type="subtree"><netconf-config-change xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-notifications"/></filter>`+
+		`</create-subscription>`)
+
+	// the link-down isn't part of the subscription
+	change, err := recvNotification(t, sub).ConfigChange()
+	require.NoError(t, err)
+	assert.Equal(t, "admin", change.ChangedBy.Username)
+	assert.Equal(t, Running, change.Datastore)
+}
+
+func TestSubscriptionLiveness(t *testing.T) {
+	recvLiveness := func(t *testing.T, sub *Subscription) error {
+		t.Helper()
+		select {
+		case err := <-sub.Liveness():
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("silent subscription was not reported")
+			return nil
+		}
+	}
+
+	newSub := func(t *testing.T) *Subscription {
+		client, server := newPipeTransports()
+		t.Cleanup(func() { server.Close() })
+		go serveSubscriptions(server, nil, 1)
+
+		sess := newSession(client)
+		sess.serverCaps = newCapabilitySet(":notification:1.0")
+		go sess.recv()
+
+		sub, err := sess.Subscribe(context.Background(), nil)
+		require.NoError(t, err)
+		return sub
+	}
+
+	t.Run("silent", func(t *testing.T) {
+		sub := newSub(t)
+		sub.SetLivenessTimeout(20*time.Millisecond, nil)
+
+		err := recvLiveness(t, sub)
+		assert.ErrorIs(t, err, ErrSubscriptionSilent)
+
+		// reported again for every window of silence
+		assert.ErrorIs(t, recvLiveness(t, sub), ErrSubscriptionSilent)
+	})
+
+	t.Run("keepalive", func(t *testing.T) {
+		sub := newSub(t)
+		errDead := errors.New("link is dead")
+		sub.SetLivenessTimeout(20*time.Millisecond, func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok, "keepalive context has no deadline")
+			return errDead
+		})
+
+		err := recvLiveness(t, sub)
+		assert.ErrorIs(t, err, ErrSubscriptionSilent)
+		assert.ErrorIs(t, err, errDead)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		sub := newSub(t)
+		sub.SetLivenessTimeout(20*time.Millisecond, nil)
+		sub.SetLivenessTimeout(0, nil)
+
+		select {
+		case err := <-sub.Liveness():
+			t.Fatalf("unexpected liveness report after stopping: %v", err)
+		case <-time.After(60 * time.Millisecond):
+		}
+	})
+}
+
+func TestDynamicSubscriptionStop(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+
+	sent := make(chan string, 2)
+	go func() {
+		replies := []string{
+			`<id xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications">7</id>`,
+			`<ok/>`,
+		}
+		for _, body := range replies {
+			r, err := server.MsgReader()
+			if err != nil {
+				return
+			}
+			msg, err := io.ReadAll(r)
+			if err != nil {
+				return
+			}
+			sent <- string(msg)
+
+			w, err := server.MsgWriter()
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s">%s</rpc-reply>`, msgIDRe.FindSubmatch([]byte(msg))[1], body)
+			if err := w.Close(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sess := newSession(client)
+	sess.serverCaps = newCapabilitySet(
+		":notification:1.0",
+		"urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications?module=ietf-subscribed-notifications&revision=2019-09-09",
+	)
+	go sess.recv()
+
+	ctx := context.Background()
+	sub, err := sess.Subscribe(ctx, nil, WithFilterOption(SubtreeFilter(`<link-down xmlns="urn:example:links"/>`)))
+	require.NoError(t, err)
+	assert.Contains(t, <-sent, `<establish-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications">`+
+		`<stream>NETCONF</stream>`+
+		`<stream-subtree-filter><link-down xmlns="urn:example:links"/></stream-subtree-filter>`+
+		`</establish-subscription>`)
+
+	require.NoError(t, sub.Stop(ctx))
+	assert.Contains(t, <-sent, `<delete-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications"><id>7</id></delete-subscription>`)
+
+	// the subscription's channel is closed but the session stays open
+	_, ok := <-sub.Notifications()
+	assert.False(t, ok)
+	assert.False(t, sess.hasSubscriptions())
+	select {
+	case <-sess.done:
+		t.Fatal("session closed")
+	default:
+	}
+}
+
+func TestSubscriptionContextCancel(t *testing.T) {
+	// the notification is written to the pipe a piece at a time so the
+	// subscription is canceled while it is still being read.
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	client := &pipeTransport{Framer: transport.NewFramer(cr, cw), close: func() error {
+		cw.Close()
+		return sw.Close()
+	}}
+	defer client.Close()
+
+	sess := newSession(client)
+	sess.serverCaps = newCapabilitySet(":notification:1.0")
+	go sess.recv()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		sub *Subscription
+		err error
+	}
+	subscribed := make(chan result, 1)
+	go func() {
+		sub, err := sess.Subscribe(ctx, nil)
+		subscribed <- result{sub, err}
+	}()
+
+	req, err := io.ReadAll(io.LimitReader(sr, int64(len("<rpc"))))
+	require.NoError(t, err)
+	require.Equal(t, "<rpc", string(req))
+	go func() { _, _ = io.Copy(io.Discard, sr) }()
+
+	_, err = io.WriteString(sw, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>]]>]]>`)
+	require.NoError(t, err)
+	res := <-subscribed
+	require.NoError(t, res.err)
+	sub := res.sub
+
+	_, err = io.WriteString(sw, `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>2023-06-07T18:32:00Z</eventTime>`)
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case _, ok := <-sub.Notifications():
+		assert.False(t, ok, "notification received after cancel")
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed while a notification was being read")
+	}
+
+	// the rest of the notification is read and dropped and the session
+	// carries on.
+	_, err = io.WriteString(sw, `<link-down xmlns="urn:example:links"/></notification>]]>]]>`)
+	require.NoError(t, err)
+	assert.False(t, sess.hasSubscriptions())
+	select {
+	case <-sess.done:
+		t.Fatal("session closed")
+	default:
+	}
+}
@@ -0,0 +1,71 @@
+package netconf
+
+import (
+	"context"
+	"sync"
+)
+
+// SubtreeResult is the config returned for one of the subtrees requested with
+// [Session.GetConfigSubtrees] or [Pool.GetConfigSubtrees].
+type SubtreeResult struct {
+	// Subtree is the subtree filter as it was given.
+	Subtree string
+
+	// Config is the contents of `<data>` for the subtree.  Nil if Err is set.
+	Config []byte
+
+	// Err is the error from fetching this subtree only.
+	Err error
+}
+
+func getConfigSubtree(ctx context.Context, s *Session, source Datastore, subtree string) SubtreeResult {
+	req := GetConfigReq{
+		Source: source,
+		Filter: SubtreeFilter(subtree),
+	}
+
+	var resp GetConfigReply
+	if err := s.Call(ctx, &req, &resp); err != nil {
+		return SubtreeResult{Subtree: subtree, Err: err}
+	}
+	return SubtreeResult{Subtree: subtree, Config: resp.Config}
+}
+
+// GetConfigSubtrees fetches the config of `source` with a separate
+// `<get-config>` for each of the subtree filters (see [SubtreeFilter]) one
+// after the other.  This keeps the size of each reply down for devices with
+// very large configs.  A failure only affects the result of that subtree; the
+// results are in the same order as `subtrees`.
+func (s *Session) GetConfigSubtrees(ctx context.Context, source Datastore, subtrees []string) []SubtreeResult {
+	results := make([]SubtreeResult, len(subtrees))
+	for i, subtree := range subtrees {
+		results[i] = getConfigSubtree(ctx, s, source, subtree)
+	}
+	return results
+}
+
+// GetConfigSubtrees is like [Session.GetConfigSubtrees] but fetches the
+// subtrees in parallel using sessions to `target` from the pool.  The number of
+// subtrees fetched at once is limited by [WithMaxSessions].
+func (p *Pool) GetConfigSubtrees(ctx context.Context, target string, source Datastore, subtrees []string) []SubtreeResult {
+	results := make([]SubtreeResult, len(subtrees))
+
+	var wg sync.WaitGroup
+	for i, subtree := range subtrees {
+		wg.Add(1)
+		go func(i int, subtree string) {
+			defer wg.Done()
+
+			s, release, err := p.Get(ctx, target)
+			if err != nil {
+				results[i] = SubtreeResult{Subtree: subtree, Err: err}
+				return
+			}
+			defer release()
+			results[i] = getConfigSubtree(ctx, s, source, subtree)
+		}(i, subtree)
+	}
+	wg.Wait()
+
+	return results
+}
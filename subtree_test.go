@@ -0,0 +1,103 @@
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var filterRe = regexp.MustCompile(`<filter type="subtree">(.*)</filter>`)
+
+// serveSubtrees replies to each `<get-config>` with the subtree filter as the
+// config except for filters on `<bgp>` which fail.
+func serveSubtrees(tr *pipeTransport) {
+	for {
+		r, err := tr.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+
+		var msgID, filter []byte
+		if m := msgIDRe.FindSubmatch(msg); m != nil {
+			msgID = m[1]
+		}
+		if m := filterRe.FindSubmatch(msg); m != nil {
+			filter = m[1]
+		}
+
+		body := fmt.Sprintf("<data>%s</data>", filter)
+		if strings.Contains(string(filter), "<bgp") {
+			body = `<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>error</error-severity><error-message>bgp is not configured</error-message></rpc-error>`
+		}
+
+		w, err := tr.MsgWriter()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s">%s</rpc-reply>`, msgID, body)
+		if err := w.Close(); err != nil {
+			return
+		}
+	}
+}
+
+var testSubtrees = []string{
+	`<interfaces xmlns="urn:example:interfaces"/>`,
+	`<bgp xmlns="urn:example:bgp"/>`,
+	`<system xmlns="urn:example:system"/>`,
+}
+
+func checkSubtreeResults(t *testing.T, results []SubtreeResult) {
+	t.Helper()
+
+	require.Len(t, results, 3)
+	for i, res := range results {
+		assert.Equal(t, testSubtrees[i], res.Subtree)
+	}
+
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, testSubtrees[0], string(results[0].Config))
+
+	assert.ErrorContains(t, results[1].Err, "bgp is not configured")
+	assert.Nil(t, results[1].Config)
+
+	assert.NoError(t, results[2].Err)
+	assert.Equal(t, testSubtrees[2], string(results[2].Config))
+}
+
+func TestSessionGetConfigSubtrees(t *testing.T) {
+	client, server := newPipeTransports()
+	defer server.Close()
+	go serveSubtrees(server)
+
+	sess := newSession(client)
+	go sess.recv()
+
+	results := sess.GetConfigSubtrees(context.Background(), Running, testSubtrees)
+	checkSubtreeResults(t, results)
+}
+
+func TestPoolGetConfigSubtrees(t *testing.T) {
+	p := NewPool(DialerFunc(func(ctx context.Context, target string) (*Session, error) {
+		client, server := newPipeTransports()
+		go serveSubtrees(server)
+
+		s := newSession(client)
+		go s.recv()
+		return s, nil
+	}), WithMaxSessions(2))
+	defer p.Close()
+
+	results := p.GetConfigSubtrees(context.Background(), "router1", Running, testSubtrees)
+	checkSubtreeResults(t, results)
+}
@@ -0,0 +1,111 @@
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+)
+
+// Tracer starts a span around each rpc issued by a [Session].  It is a minimal
+// interface so that any tracing library (i.e OpenTelemetry) can be adapted to
+// it without this package depending on it.  Set it on a context with
+// [ContextWithTracer]; rpcs issued with a context without a tracer are not
+// traced.
+type Tracer interface {
+	// StartRPC is called right before the rpc is sent.
+	StartRPC(ctx context.Context, info RPCInfo) Span
+}
+
+// Span is a single traced rpc returned from [Tracer.StartRPC].
+type Span interface {
+	// End is called once the rpc is done.  err is the error returned from
+	// [Session.Do] or the `<rpc-error>`s in the reply if there was one.
+	End(err error)
+}
+
+// RPCInfo are the attributes of a traced rpc.
+type RPCInfo struct {
+	// Operation is the name of the operation element (i.e `edit-config`).
+	// Empty if it could not be determined.
+	Operation string
+
+	MessageID uint64
+
+	// Datastore is the datastore targeted by the operation (or the source for
+	// operations that only read) for the standard operations.  Empty for
+	// anything else.
+	Datastore Datastore
+}
+
+type tracerKey struct{}
+
+// ContextWithTracer returns a copy of ctx that traces any rpc issued with it
+// using `tracer`.
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+func tracerFromContext(ctx context.Context) Tracer {
+	tracer, _ := ctx.Value(tracerKey{}).(Tracer)
+	return tracer
+}
+
+// unwrapOperation returns the operation passed to Do by Session.Call which
+// is a pointer to an interface.
+func unwrapOperation(op any) any {
+	if p, ok := op.(*any); ok && p != nil {
+		return *p
+	}
+	return op
+}
+
+func newRPCInfo(msg *request) RPCInfo {
+	op := unwrapOperation(msg.Operation)
+
+	return RPCInfo{
+		Operation: operationName(op),
+		MessageID: msg.MessageID,
+		Datastore: operationDatastore(op),
+	}
+}
+
+// operationName returns the local name of the operation element.
+func operationName(op any) string {
+	var raw []byte
+	switch v := op.(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		name, _ := xmlNameOf(op)
+		return name.Local
+	}
+
+	start, err := startElement(xml.NewDecoder(bytes.NewReader(raw)))
+	if err != nil {
+		return ""
+	}
+	return start.Name.Local
+}
+
+func operationDatastore(op any) Datastore {
+	var v any
+	switch req := op.(type) {
+	case *GetConfigReq:
+		return req.Source
+	case *EditConfigReq:
+		return req.Target
+	case *LockReq:
+		return req.Target
+	case *CopyConfigReq:
+		v = req.Target
+	case *DeleteConfigReq:
+		v = req.Target
+	case *ValidateReq:
+		v = req.Source
+	}
+
+	ds, _ := v.(Datastore)
+	return ds
+}
@@ -0,0 +1,74 @@
+package netconf
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSpan struct {
+	info  RPCInfo
+	ended bool
+	err   error
+}
+
+func (s *fakeSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) StartRPC(ctx context.Context, info RPCInfo) Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &fakeSpan{info: info}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestTracer(t *testing.T) {
+	ts := newTestServer(t)
+	sess := newSession(ts.transport())
+	go sess.recv()
+
+	tracer := &fakeTracer{}
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`)
+	require.NoError(t, sess.EditConfig(ctx, Candidate, "<system/>"))
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="2"><ok/></rpc-reply>`)
+	require.NoError(t, sess.Lock(ctx, Running))
+
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="3">` +
+		`<rpc-error><error-type>protocol</error-type><error-tag>operation-failed</error-tag><error-severity>error</error-severity></rpc-error>` +
+		`</rpc-reply>`)
+	_, err := sess.Do(ctx, "<get/>")
+	require.NoError(t, err)
+
+	// rpcs without a tracer on the context are not traced
+	ts.queueRespString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="4"><ok/></rpc-reply>`)
+	_, err = sess.Do(context.Background(), "<get/>")
+	require.NoError(t, err)
+
+	require.Len(t, tracer.spans, 3)
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended, "span for %s not ended", span.info.Operation)
+	}
+
+	assert.Equal(t, RPCInfo{Operation: "edit-config", MessageID: 1, Datastore: Candidate}, tracer.spans[0].info)
+	assert.NoError(t, tracer.spans[0].err)
+
+	assert.Equal(t, RPCInfo{Operation: "lock", MessageID: 2, Datastore: Running}, tracer.spans[1].info)
+	assert.NoError(t, tracer.spans[1].err)
+
+	assert.Equal(t, RPCInfo{Operation: "get", MessageID: 3}, tracer.spans[2].info)
+	assert.ErrorContains(t, tracer.spans[2].err, "operation-failed")
+}
@@ -0,0 +1,217 @@
+package transport
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// deadlineReader allows for reads from an io.Reader that may block forever
+// (i.e a device that stalls in the middle of a chunk) to be aborted with
+// a deadline, even if the underlying reader has no deadline support of it's
+// own (like an ssh channel).
+//
+// Without a deadline reads go straight to the underlying reader.  With one
+// each read of the underlying reader is done on a separate goroutine that
+// exits as soon as the read returns.  A read that is aborted doesn't lose any
+// data as whatever eventually comes back from the underlying reader is
+// returned on the next call to Read.
+type deadlineReader struct {
+	r io.Reader
+	// size is the largest read of r done on a separate goroutine.
+	size int
+
+	// pending is set while a read of r on a separate goroutine hasn't been
+	// returned yet (i.e because it was aborted by the deadline).
+	pending chan readResult
+
+	// unread data (and the error that came with it) from the last result
+	// that didn't fit in the caller's buffer.
+	buf []byte
+	err error
+
+	mu       sync.Mutex
+	deadline time.Time
+	// changed is closed (and replaced) any time the deadline is changed to
+	// wake up a blocked Read.
+	changed chan struct{}
+}
+
+type readResult struct {
+	p   []byte
+	err error
+}
+
+func newDeadlineReader(r io.Reader, size int) *deadlineReader {
+	return &deadlineReader{
+		r:       r,
+		size:    size,
+		changed: make(chan struct{}),
+	}
+}
+
+// SetReadDeadline sets the deadline for current and future reads.  A zero
+// value for t means reads will not time out.  Reads that were already blocked
+// before any deadline was set can't be aborted.
+func (r *deadlineReader) SetReadDeadline(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadline = t
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// readAsync starts a read of up to n bytes of the underlying reader on
+// a separate goroutine.
+func (r *deadlineReader) readAsync(n int) {
+	if n > r.size {
+		n = r.size
+	}
+	// buffered so the goroutine exits even if the result is never collected
+	results := make(chan readResult, 1)
+	go func() {
+		buf := make([]byte, n)
+		n, err := r.r.Read(buf)
+		results <- readResult{p: buf[:n], err: err}
+	}()
+	r.pending = results
+}
+
+// Read reads from the underlying reader returning os.ErrDeadlineExceeded if
+// the deadline passes before any data is available.
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if len(r.buf) > 0 {
+		n := copy(p, r.buf)
+		r.buf = r.buf[n:]
+		if len(r.buf) == 0 {
+			return n, r.err
+		}
+		return n, nil
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	for {
+		r.mu.Lock()
+		deadline, changed := r.deadline, r.changed
+		r.mu.Unlock()
+
+		if r.pending == nil {
+			if deadline.IsZero() {
+				return r.r.Read(p)
+			}
+			if time.Until(deadline) <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			r.readAsync(len(p))
+		}
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		select {
+		case res := <-r.pending:
+			if timer != nil {
+				timer.Stop()
+			}
+			r.pending = nil
+			r.err = res.err
+			n := copy(p, res.p)
+			r.buf = res.p[n:]
+			if len(r.buf) > 0 {
+				return n, nil
+			}
+			return n, res.err
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}
+}
+
+// deadlineWriter allows writes that may block forever (i.e a half-open TCP
+// connection where the send buffer has filled up) to be aborted with
+// a deadline.
+//
+// Without a deadline writes go straight to the underlying writer.  With one
+// each write is done on a separate goroutine.  Once a write has been aborted
+// the underlying writer may still finish (part of) it later so the stream is
+// no longer usable and every further write fails.
+type deadlineWriter struct {
+	w io.Writer
+
+	mu       sync.Mutex
+	deadline time.Time
+	err      error
+}
+
+type writeResult struct {
+	n   int
+	err error
+}
+
+// SetWriteDeadline sets the deadline for future writes.  A zero value for t
+// means writes will not time out.
+func (w *deadlineWriter) SetWriteDeadline(t time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadline = t
+}
+
+// Write writes to the underlying writer returning os.ErrDeadlineExceeded if
+// the deadline passes before the write completes.
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	deadline, err := w.deadline, w.err
+	w.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	if deadline.IsZero() {
+		return w.w.Write(p)
+	}
+
+	d := time.Until(deadline)
+	if d <= 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	// the caller may reuse p once we return so an aborted write needs a copy
+	// of it's own.
+	buf := append([]byte(nil), p...)
+	results := make(chan writeResult, 1)
+	go func() {
+		n, err := w.w.Write(buf)
+		results <- writeResult{n: n, err: err}
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case res := <-results:
+		return res.n, res.err
+	case <-timer.C:
+		w.mu.Lock()
+		w.err = os.ErrDeadlineExceeded
+		w.mu.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+}
@@ -0,0 +1,193 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkReaderDeadline(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	f := NewFramer(pr, io.Discard)
+	f.Upgrade()
+
+	// device announces a 10 byte chunk but only sends 3 bytes and stalls.
+	go func() { _, _ = io.WriteString(pw, "\n#10\nabc") }()
+
+	require.NoError(t, f.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	r, err := f.MsgReader()
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	var got []byte
+	go func() {
+		defer close(done)
+		got, err = io.ReadAll(r)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stalled chunk read was not aborted by the deadline")
+	}
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Equal(t, "abc", string(got))
+
+	// the rest of the chunk arriving late is still read once the deadline is
+	// cleared.
+	require.NoError(t, f.SetReadDeadline(time.Time{}))
+	go func() { _, _ = io.WriteString(pw, "defghij\n##\n") }()
+
+	got, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "defghij", string(got))
+}
+
+func TestEOMReaderDeadline(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	f := NewFramer(pr, io.Discard)
+
+	// device stalls in the middle of the end-of-message marker
+	go func() { _, _ = io.WriteString(pw, "<ok/>]]>") }()
+
+	require.NoError(t, f.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	r, err := f.MsgReader()
+	require.NoError(t, err)
+
+	got, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Equal(t, "<ok/>", string(got))
+
+	// none of the marker was consumed so it is still found once the rest
+	// arrives.
+	require.NoError(t, f.SetReadDeadline(time.Time{}))
+	go func() { _, _ = io.WriteString(pw, "]]>next]]>]]>") }()
+
+	got, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+	require.NoError(t, r.Close())
+
+	r, err = f.MsgReader()
+	require.NoError(t, err)
+	got, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "next", string(got))
+}
+
+func TestDeadlineReaderChanged(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	r := newDeadlineReader(pr, defaultBufSize)
+	r.SetReadDeadline(time.Now().Add(time.Hour))
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 8))
+		errCh <- err
+	}()
+
+	// changing the deadline must wake up a read that is already blocked
+	time.Sleep(10 * time.Millisecond)
+	r.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("blocked read was not aborted after setting a deadline")
+	}
+
+	// an expired deadline fails right away
+	_, err := r.Read(make([]byte, 8))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestDeadlineReaderShortBuffer(t *testing.T) {
+	pr, pw := io.Pipe()
+	r := newDeadlineReader(pr, defaultBufSize)
+
+	// an aborted read is resumed with a smaller buffer than it was started
+	// with
+	r.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := r.Read(make([]byte, 8))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	r.SetReadDeadline(time.Time{})
+
+	go func() {
+		_, _ = io.WriteString(pw, "foobar")
+		pw.Close()
+	}()
+
+	p := make([]byte, 4)
+	n, err := r.Read(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "foob", string(p[:n]))
+
+	rest, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "ar", string(rest))
+}
+
+func TestDeadlineReaderDirect(t *testing.T) {
+	r := newDeadlineReader(strings.NewReader("foobar"), defaultBufSize)
+
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "foobar", string(got))
+
+	// without a deadline reads go straight to the underlying reader
+	assert.Nil(t, r.pending)
+}
+
+func TestFramerWriteDeadline(t *testing.T) {
+	// nothing ever reads from the pipe so writes block like on a half-open
+	// connection.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	f := NewFramer(strings.NewReader(""), pw)
+	require.NoError(t, f.SetWriteDeadline(time.Now().Add(20*time.Millisecond)))
+
+	w, err := f.MsgWriter()
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// larger than the write buffer so it reaches the pipe before Close
+		_, err = w.Write(bytes.Repeat([]byte("x"), 2*defaultBufSize))
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stalled write was not aborted by the deadline")
+	}
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// the stream is unusable even once the deadline is cleared
+	require.NoError(t, f.SetWriteDeadline(time.Time{}))
+	w, err = f.MsgWriter()
+	if err == nil {
+		_, err = io.WriteString(w, "<rpc/>")
+		if err == nil {
+			err = w.Close()
+		}
+	}
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
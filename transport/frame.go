@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,15 +23,36 @@ type frameReader interface {
 	io.ByteReader
 }
 
+// MessageWriter writes a single framed netconf message.  It is implemented by
+// the writers for both End-of-Message and Chunked framing so code that doesn't
+// care about the framing version can use either.
+//
+// Close terminates the current message (writing the end-of-message or
+// end-of-chunks marker and flushing) and does not close the underlying stream.
+// Writes after Close return ErrInvalidIO.
+type MessageWriter interface {
+	io.Writer
+
+	// Close ends the current message.  The underlying stream is left open
+	// for the next message.
+	Close() error
+}
+
+var (
+	_ MessageWriter = (*eomWriter)(nil)
+	_ MessageWriter = (*chunkWriter)(nil)
+)
+
 type frameWriter interface {
-	io.WriteCloser
+	MessageWriter
 	isClosed() bool
 }
 
 // Framer is a wrapper used for transports that implement the framing defined in
 // RFC6242.  This supports End-of-Message and Chucked framing methods and
 // will move from End-of-Message to Chunked framing after the `Upgrade` method
-// has been called.
+// has been called.  The read and write sides keep their own framing and can be
+// moved to Chunked framing separately with `UpgradeReader` and `UpgradeWriter`.
 //
 // This is not a transport on it's own (missing the `Close` method) and is
 // intended to be embedded into other transports.
@@ -42,17 +66,105 @@ type Framer struct {
 	curReader frameReader
 	curWriter frameWriter
 
-	upgraded bool
+	readUpgraded  bool
+	writeUpgraded bool
+	autoDetect    bool
+
+	readBufSize  int
+	writeBufSize int
+	// eomDelim replaces the end-of-message marker when set.
+	eomDelim []byte
+	// maxChunkSize limits the size of written chunks when > 0.
+	maxChunkSize int
+	// recordChunks enables keeping chunkSizes for the current message.
+	recordChunks bool
+	chunkSizes   []int
+
+	deadline      *deadlineReader
+	writeDeadline *deadlineWriter
+
+	bytesRead    atomic.Uint64
+	bytesWritten atomic.Uint64
 }
 
+// FramerOption is an optional argument to [NewFramer].
+type FramerOption interface {
+	apply(*Framer)
+}
+
+type (
+	readBufferSizeOpt  int
+	writeBufferSizeOpt int
+	eomDelimiterOpt    string
+	maxChunkSizeOpt    int
+	recordChunksOpt    struct{}
+)
+
+func (o readBufferSizeOpt) apply(f *Framer)  { f.readBufSize = int(o) }
+func (o writeBufferSizeOpt) apply(f *Framer) { f.writeBufSize = int(o) }
+func (o eomDelimiterOpt) apply(f *Framer)    { f.eomDelim = []byte(o) }
+func (o maxChunkSizeOpt) apply(f *Framer)    { f.maxChunkSize = int(o) }
+func (o recordChunksOpt) apply(f *Framer)    { f.recordChunks = true }
+
+// defaultBufSize is the size of the read and write buffers unless changed with
+// WithReadBufferSize or WithWriteBufferSize.
+const defaultBufSize = 4096
+
+// WithReadBufferSize sets the size of the buffer used to read from the
+// underlying stream (and the largest single read done on it).  Larger buffers
+// mean fewer reads (syscalls) for large messages like a big `<get-config>` at
+// the cost of memory.  Defaults to 4KiB; sizes below 16 bytes are raised to 16.
+func WithReadBufferSize(n int) FramerOption { return readBufferSizeOpt(n) }
+
+// WithWriteBufferSize sets the size of the buffer used to write to the underlying
+// stream.  Defaults to 4KiB; sizes below 16 bytes are raised to 16.
+func WithWriteBufferSize(n int) FramerOption { return writeBufferSizeOpt(n) }
+
+// WithMaxChunkSize splits writes into chunks of at most n bytes when using
+// Chunked framing.  RFC6242 allows chunks up to 4294967295 bytes but some
+// devices with small receive buffers fail on large chunks (i.e use 65535 for
+// them).  By default each write is sent as a single chunk.
+func WithMaxChunkSize(n int) FramerOption { return maxChunkSizeOpt(n) }
+
+// WithEOMDelimiter replaces the `]]>]]>` marker used by End-of-Message framing
+// for both reading and writing.
+//
+// This is NOT part of RFC6242 and no real device will understand it.  It only
+// exists for test harnesses that simulate malformed peers and interop
+// experiments.  An empty delimiter keeps the standard marker.
+func WithEOMDelimiter(delim string) FramerOption { return eomDelimiterOpt(delim) }
+
+// WithChunkSizeRecording keeps the size of every chunk read for the current
+// message so they can be inspected with [Framer.ChunkSizes].  This is for
+// debugging devices that fragment messages oddly (i.e lots of tiny chunks) and
+// is off by default.
+func WithChunkSizeRecording() FramerOption { return recordChunksOpt{} }
+
 // NewFramer return a new Framer to be used against the given io.Reader and io.Writer.
-func NewFramer(r io.Reader, w io.Writer) *Framer {
+func NewFramer(r io.Reader, w io.Writer, opts ...FramerOption) *Framer {
 	f := &Framer{
-		r:  r,
-		w:  w,
-		br: bufio.NewReader(r),
-		bw: bufio.NewWriter(w),
+		readBufSize:  defaultBufSize,
+		writeBufSize: defaultBufSize,
+	}
+	for _, opt := range opts {
+		opt.apply(f)
 	}
+	// smallest buffer allowed by bufio
+	const minBufSize = 16
+	f.readBufSize = max(f.readBufSize, minBufSize)
+	f.writeBufSize = max(f.writeBufSize, minBufSize)
+	if len(f.eomDelim) == 0 {
+		f.eomDelim = endOfMsg
+	}
+	// the rest of the delimiter is peeked from the read buffer
+	f.readBufSize = max(f.readBufSize, len(f.eomDelim))
+
+	f.deadline = newDeadlineReader(&countingReader{r: r, n: &f.bytesRead}, f.readBufSize)
+	f.r = f.deadline
+	f.writeDeadline = &deadlineWriter{w: w}
+	f.w = &countingWriter{w: f.writeDeadline, n: &f.bytesWritten}
+	f.br = bufio.NewReaderSize(f.r, f.readBufSize)
+	f.bw = bufio.NewWriterSize(f.w, f.writeBufSize)
 
 	capDir := os.Getenv("GONETCONF_FRAMED_CAPDIR")
 	if capDir != "" {
@@ -97,21 +209,116 @@ func (f *Framer) DebugCapture(in io.Writer, out io.Writer) {
 
 	if out != nil {
 		f.w = io.MultiWriter(f.w, out)
-		f.bw = bufio.NewWriter(f.w)
+		f.bw = bufio.NewWriterSize(f.w, f.writeBufSize)
 	}
 
 	if in != nil {
 		f.r = io.TeeReader(f.r, in)
-		f.br = bufio.NewReader(f.r)
+		f.br = bufio.NewReaderSize(f.r, f.readBufSize)
+	}
+}
+
+// Stats are counters for the underlying stream of a transport.
+type Stats struct {
+	// BytesRead is the total number of bytes read from the underlying
+	// stream including any framing.
+	BytesRead uint64
+
+	// BytesWritten is the total number of bytes written to the underlying
+	// stream including any framing.
+	BytesWritten uint64
+}
+
+// Stats returns the current counters for the framed stream.  These are
+// on-the-wire counts (including framing overhead) and are safe to call
+// concurrently with reads and writes.
+func (f *Framer) Stats() Stats {
+	return Stats{
+		BytesRead:    f.bytesRead.Load(),
+		BytesWritten: f.bytesWritten.Load(),
 	}
 }
 
+type countingReader struct {
+	r io.Reader
+	n *atomic.Uint64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n.Add(uint64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n.Add(uint64(n))
+	return n, err
+}
+
+// SetReadDeadline sets the deadline for reads on the underlying stream,
+// including reads that are currently blocked unless they started before any
+// deadline was set.  Once the deadline passes reads of the current message
+// return os.ErrDeadlineExceeded instead of waiting forever on a device that
+// stalls in the middle of a message.  A zero value for t disables the
+// deadline.
+//
+// Data that arrives after the deadline is not lost and reading can be resumed
+// after the deadline has been extended.
+func (f *Framer) SetReadDeadline(t time.Time) error {
+	f.deadline.SetReadDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for writes to the underlying stream
+// started after it is called.  A write still blocked once the deadline passes
+// (i.e because the connection is half-open and the send buffer is full)
+// returns os.ErrDeadlineExceeded.  A zero value for t disables the deadline.
+//
+// Unlike reads an aborted write can't be resumed: part of the message may
+// already have been sent so every write after that fails and the transport
+// should be closed.
+func (f *Framer) SetWriteDeadline(t time.Time) error {
+	f.writeDeadline.SetWriteDeadline(t)
+	return nil
+}
+
 // Upgrade will cause the Framer to switch from End-of-Message framing to
-// Chunked framing.  This is usually called after netconf exchanged the hello
-// messages.
+// Chunked framing for both reading and writing.  This is usually called after
+// netconf exchanged the hello messages.
 func (t *Framer) Upgrade() {
+	t.UpgradeReader()
+	t.UpgradeWriter()
+}
+
+// UpgradeReader switches only the read side to Chunked framing starting with
+// the next call to MsgReader.  In normal operation both sides are upgraded
+// together with [Framer.Upgrade] after the hello; this is for devices (or
+// debugging) where the framing changes at different message boundaries for
+// each direction.
+func (t *Framer) UpgradeReader() {
 	// XXX: do we need to protect against race conditions (atomic/mutex?)
-	t.upgraded = true
+	t.readUpgraded = true
+}
+
+// UpgradeWriter switches only the write side to Chunked framing starting with
+// the next call to MsgWriter.  See [Framer.UpgradeReader].
+func (t *Framer) UpgradeWriter() {
+	t.writeUpgraded = true
+}
+
+// SetAutoDetect enables detecting the framing of every message that is read
+// after the framer has been upgraded, instead of assuming Chunked framing.
+// This is a defense against devices that advertise `:base:1.1` but keep
+// sending End-of-Message framed messages.  A warning is logged for any message
+// that doesn't use the negotiated framing.
+func (t *Framer) SetAutoDetect(enabled bool) {
+	t.autoDetect = enabled
 }
 
 // MsgReader returns a new io.Reader that is good for reading exactly one netconf
@@ -120,15 +327,36 @@ func (t *Framer) Upgrade() {
 // Only one reader can be used at a time.  When this is called with an existing
 // reader then the underlying reader is advanced to the start of the next message
 // and invalidates the old reader before returning a new one.
+//
+// Before the framer has been upgraded messages that are chunk-framed anyway
+// (i.e a buggy server sending it's hello using chunked framing) are detected
+// and read as chunked messages.  After the upgrade the framing of each message
+// is only detected with [Framer.SetAutoDetect].
 func (t *Framer) MsgReader() (io.ReadCloser, error) {
-	if t.upgraded {
-		t.curReader = &chunkReader{r: t.br}
+	var sizes *[]int
+	if t.recordChunks {
+		t.chunkSizes = nil
+		sizes = &t.chunkSizes
+	}
+
+	if t.readUpgraded && !t.autoDetect {
+		t.curReader = &chunkReader{r: t.br, sizes: sizes}
 	} else {
-		t.curReader = &eomReader{r: t.br}
+		t.curReader = &sniffReader{r: t.br, chunked: t.readUpgraded, eomDelim: t.eomDelim, sizes: sizes}
 	}
 	return t.curReader, nil
 }
 
+// ChunkSizes returns the sizes of the chunks read so far of the current (or
+// last) message in the order they were read.  It is always nil without
+// [WithChunkSizeRecording] and for End-of-Message framed messages.
+func (t *Framer) ChunkSizes() []int {
+	if len(t.chunkSizes) == 0 {
+		return nil
+	}
+	return append([]int(nil), t.chunkSizes...)
+}
+
 // MsgWriter returns an io.WriterCloser that is good for writing exactly one
 // netconf message.
 //
@@ -139,57 +367,130 @@ func (t *Framer) MsgWriter() (io.WriteCloser, error) {
 		return nil, ErrExistingWriter
 	}
 
-	if t.upgraded {
-		t.curWriter = &chunkWriter{w: t.bw}
+	if t.writeUpgraded {
+		t.curWriter = &chunkWriter{w: t.bw, maxChunk: t.maxChunkSize}
 	} else {
-		t.curWriter = &eomWriter{w: t.bw}
+		t.curWriter = &eomWriter{w: t.bw, delim: t.eomDelim}
 	}
 	return t.curWriter, nil
 }
 
+// FramingVersion is one of the framing methods defined in RFC6242.
+type FramingVersion int
+
+const (
+	// EndOfMessage framing terminates each message with `]]>]]>` and is used
+	// for `:base:1.0` sessions (and the hello of every session).
+	EndOfMessage FramingVersion = iota
+
+	// Chunked framing sends each message as a series of length-prefixed
+	// chunks and is used for `:base:1.1` sessions.
+	Chunked
+)
+
+// FrameMessage returns the exact bytes a Framer puts on the wire for the
+// message `payload` using the given framing.  Chunked messages are written as
+// a single chunk.  This is meant for building test fixtures and checking the
+// output of other implementations.
+func FrameMessage(payload []byte, version FramingVersion) []byte {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+
+	var w frameWriter
+	if version == Chunked {
+		w = &chunkWriter{w: bw}
+	} else {
+		w = &eomWriter{w: bw}
+	}
+	// a chunk can't be empty so an empty message is only the end-of-chunks
+	// marker.
+	if len(payload) > 0 {
+		// writes to a bytes.Buffer can't fail
+		_, _ = w.Write(payload)
+	}
+	_ = w.Close()
+	return buf.Bytes()
+}
+
 var endOfChunks = []byte("\n##\n")
 
 type chunkReader struct {
 	r         *bufio.Reader
 	chunkLeft int
+	// eof is set once the end-of-chunks marker has been read so that
+	// further reads (or Close) don't read into the next message.
+	eof bool
+
+	// inHeader is set while a chunk header (`\n#<size>\n`) is only partially
+	// read with headerLen holding the size read so far.
+	inHeader  bool
+	headerLen int
+
+	// started is set once any of the message has been seen.  The stream
+	// ending before that is a clean io.EOF and anywhere else before the
+	// end-of-chunks marker is an io.ErrUnexpectedEOF.
+	started bool
+
+	// sizes records the size of each chunk when set.
+	sizes *[]int
 }
 
 func (r *chunkReader) readHeader() error {
-	peeked, err := r.r.Peek(4)
-	switch err {
-	case nil:
-		break
-	case io.EOF:
-		return io.ErrUnexpectedEOF
-	default:
-		return err
-	}
-
-	if _, err := r.r.Discard(2); err != nil {
-		return err
+	if r.eof {
+		return io.EOF
 	}
 
-	// make sure the preamble of `\n#` which is used for both the start of a
-	// chuck and the end-of-chunk marker is valid.
-	if peeked[0] != '\n' || peeked[1] != '#' {
-		return ErrMalformedChunk
-	}
+	if !r.inHeader {
+		peeked, err := r.r.Peek(4)
+		switch err {
+		case nil:
+			break
+		case io.EOF:
+			if len(peeked) == 0 && !r.started {
+				return io.EOF
+			}
+			return io.ErrUnexpectedEOF
+		default:
+			return err
+		}
+		r.started = true
 
-	// check to see if we are at the end of the read
-	if peeked[2] == '#' && peeked[3] == '\n' {
 		if _, err := r.r.Discard(2); err != nil {
 			return err
 		}
-		// not stricly needed but it is the responsibility of this function to
-		// update chunkLeft.
-		r.chunkLeft = 0
-		return io.EOF
+
+		// make sure the preamble of `\n#` which is used for both the start of a
+		// chuck and the end-of-chunk marker is valid.
+		if peeked[0] != '\n' || peeked[1] != '#' {
+			return ErrMalformedChunk
+		}
+
+		// check to see if we are at the end of the read
+		if peeked[2] == '#' && peeked[3] == '\n' {
+			if _, err := r.r.Discard(2); err != nil {
+				return err
+			}
+			// not stricly needed but it is the responsibility of this function to
+			// update chunkLeft.
+			r.chunkLeft = 0
+			r.eof = true
+			return io.EOF
+		}
+
+		r.inHeader = true
+		r.headerLen = 0
 	}
 
-	var n int
+	// the chunk size is accumulated in the reader so that a read that fails
+	// part way through the header (i.e a read deadline) can be retried
+	// without losing the digits already consumed.
+	const maxChunk = 4294967295
 	for {
 		c, err := r.r.ReadByte()
 		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
 			return err
 		}
 
@@ -199,15 +500,21 @@ func (r *chunkReader) readHeader() error {
 		if c < '0' || c > '9' {
 			return ErrMalformedChunk
 		}
-		n = n*10 + int(c) - '0'
+		r.headerLen = r.headerLen*10 + int(c) - '0'
+		if r.headerLen > maxChunk {
+			return ErrMalformedChunk
+		}
 	}
+	r.inHeader = false
 
-	const maxChunk = 4294967295
-	if n < 1 || n > maxChunk {
+	if r.headerLen < 1 {
 		return ErrMalformedChunk
 	}
 
-	r.chunkLeft = n
+	if r.sizes != nil {
+		*r.sizes = append(*r.sizes, r.headerLen)
+	}
+	r.chunkLeft = r.headerLen
 	return nil
 }
 
@@ -229,6 +536,9 @@ func (r *chunkReader) Read(p []byte) (int, error) {
 
 	n, err := r.r.Read(p)
 	r.chunkLeft -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
 	return n, err
 }
 
@@ -246,6 +556,9 @@ func (r *chunkReader) ReadByte() (byte, error) {
 
 	b, err := r.r.ReadByte()
 	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return 0, err
 	}
 	r.chunkLeft--
@@ -276,6 +589,9 @@ func (r *chunkReader) Close() error {
 
 		n, err := r.r.Discard(r.chunkLeft)
 		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
 			return err
 		}
 		r.chunkLeft -= n
@@ -284,6 +600,8 @@ func (r *chunkReader) Close() error {
 
 type chunkWriter struct {
 	w *bufio.Writer
+	// maxChunk is the largest chunk written when > 0.
+	maxChunk int
 }
 
 func (w *chunkWriter) Write(p []byte) (int, error) {
@@ -291,11 +609,30 @@ func (w *chunkWriter) Write(p []byte) (int, error) {
 		return 0, ErrInvalidIO
 	}
 
-	if _, err := fmt.Fprintf(w.w, "\n#%d\n", len(p)); err != nil {
-		return 0, err
-	}
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if w.maxChunk > 0 && len(chunk) > w.maxChunk {
+			chunk = chunk[:w.maxChunk]
+		}
 
-	return w.w.Write(p)
+		// build the header by hand as fmt.Fprintf allocates on every chunk
+		var hdr [24]byte
+		h := append(hdr[:0], '\n', '#')
+		h = strconv.AppendInt(h, int64(len(chunk)), 10)
+		h = append(h, '\n')
+		if _, err := w.w.Write(h); err != nil {
+			return written, err
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
 }
 
 func (w *chunkWriter) Close() error {
@@ -309,10 +646,85 @@ func (w *chunkWriter) Close() error {
 
 func (w *chunkWriter) isClosed() bool { return w.w == nil }
 
+// sniffReader detects the framing of a message from it's first bytes instead
+// of trusting the negotiated framing.  A message starting with a chunk header
+// is read as Chunked and anything else as End-of-Message.  RFC6242 requires
+// the hello to always be End-of-Message framed but some servers send it
+// chunked and others ignore the negotiated framing entirely.
+type sniffReader struct {
+	r *bufio.Reader
+	// chunked is the negotiated framing.
+	chunked  bool
+	eomDelim []byte
+	sizes    *[]int
+	cur      frameReader
+}
+
+func (r *sniffReader) reader() (frameReader, error) {
+	if r.cur != nil {
+		return r.cur, nil
+	}
+
+	// A short message (or the stream ending) is left to the negotiated
+	// framing to report.
+	peeked, err := r.r.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	chunked := r.chunked
+	if len(peeked) == 3 {
+		chunked = peeked[0] == '\n' && peeked[1] == '#' && peeked[2] >= '0' && peeked[2] <= '9'
+	}
+
+	switch {
+	case chunked && !r.chunked:
+		log.Printf("netconf: received chunk-framed message before chunked framing was negotiated")
+	case !chunked && r.chunked:
+		log.Printf("netconf: received end-of-message framed message after chunked framing was negotiated")
+	}
+
+	if chunked {
+		r.cur = &chunkReader{r: r.r, sizes: r.sizes}
+	} else {
+		r.cur = &eomReader{r: r.r, delim: r.eomDelim}
+	}
+	return r.cur, nil
+}
+
+func (r *sniffReader) Read(p []byte) (int, error) {
+	cur, err := r.reader()
+	if err != nil {
+		return 0, err
+	}
+	return cur.Read(p)
+}
+
+func (r *sniffReader) ReadByte() (byte, error) {
+	cur, err := r.reader()
+	if err != nil {
+		return 0, err
+	}
+	return cur.ReadByte()
+}
+
+func (r *sniffReader) Close() error {
+	cur, err := r.reader()
+	if err != nil {
+		return err
+	}
+	return cur.Close()
+}
+
 var endOfMsg = []byte("]]>]]>")
 
 type eomReader struct {
 	r *bufio.Reader
+	// delim is the end-of-message marker.  endOfMsg is used when nil.
+	delim []byte
+	// eof is set once the end-of-message marker has been read so that
+	// further reads (or Close) don't read into the next message.
+	eof bool
 }
 
 func (r *eomReader) Read(p []byte) (int, error) {
@@ -333,36 +745,40 @@ func (r *eomReader) ReadByte() (byte, error) {
 	if r.r == nil {
 		return 0, ErrInvalidIO
 	}
-
-	b, err := r.r.ReadByte()
-	if err != nil {
-		if err == io.EOF {
-			return b, io.ErrUnexpectedEOF
-		}
-		return b, err
+	if r.eof {
+		return 0, io.EOF
 	}
 
-	// look for the end of the message marker
-	if b == endOfMsg[0] {
-		peeked, err := r.r.Peek(len(endOfMsg) - 1)
-		if err != nil {
-			if err == io.EOF {
-				return 0, io.ErrUnexpectedEOF
-			}
-			return 0, err
-		}
+	delim := r.delim
+	if delim == nil {
+		delim = endOfMsg
+	}
 
-		// check if we are at the end of the message
-		if bytes.Equal(peeked, endOfMsg[1:]) {
-			if _, err := r.r.Discard(len(endOfMsg) - 1); err != nil {
+	// look for the end of the message marker.  Peek reads from the stream
+	// until it has the rest of the marker so a marker split across reads is
+	// still found.  Nothing is consumed until the whole marker has been
+	// peeked so a read that fails part way through it (i.e on a deadline)
+	// can be retried.
+	peeked, err := r.r.Peek(1)
+	if err == nil && peeked[0] == delim[0] {
+		peeked, err = r.r.Peek(len(delim))
+		if err == nil && bytes.Equal(peeked, delim) {
+			if _, err := r.r.Discard(len(delim)); err != nil {
 				return 0, err
 			}
 
+			r.eof = true
 			return 0, io.EOF
 		}
 	}
+	if err != nil {
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
 
-	return b, nil
+	return r.r.ReadByte()
 }
 
 // Close will read the rest of the frame and consume it including
@@ -383,6 +799,8 @@ func (r *eomReader) Close() error {
 
 type eomWriter struct {
 	w *bufio.Writer
+	// delim is the end-of-message marker.  endOfMsg is used when nil.
+	delim []byte
 }
 
 func (w *eomWriter) Write(p []byte) (int, error) {
@@ -400,7 +818,11 @@ func (w *eomWriter) Close() error {
 		return err
 	}
 
-	if _, err := w.w.Write(endOfMsg); err != nil {
+	delim := w.delim
+	if delim == nil {
+		delim = endOfMsg
+	}
+	if _, err := w.w.Write(delim); err != nil {
 		return err
 	}
 
@@ -3,8 +3,12 @@ package transport
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -70,6 +74,22 @@ var chunkedTests = []struct {
 		[]byte("\n#4294967296\n"),
 		[]byte(""),
 		ErrMalformedChunk},
+	{"missing end-of-chunks",
+		[]byte("\n#3\nfoo"),
+		[]byte("foo"),
+		io.ErrUnexpectedEOF},
+	{"eof in chunk",
+		[]byte("\n#6\nfoo"),
+		[]byte("foo"),
+		io.ErrUnexpectedEOF},
+	{"eof in end-of-chunks",
+		[]byte("\n#3\nfoo\n#"),
+		[]byte("foo"),
+		io.ErrUnexpectedEOF},
+	{"empty stream",
+		[]byte(""),
+		[]byte(""),
+		nil},
 	{"rfc example rpc", rfcChunkedRPC, rfcUnchunkedRPC, nil},
 }
 
@@ -125,9 +145,72 @@ func TestChunkReaderRead(t *testing.T) {
 	}
 }
 
+func TestChunkReaderOneByte(t *testing.T) {
+	for _, tc := range chunkedTests {
+		t.Run(tc.name, func(t *testing.T) {
+			// every underlying read returns a single byte so every header is
+			// split across reads.
+			r := &chunkReader{
+				r: bufio.NewReader(iotest.OneByteReader(bytes.NewReader(tc.input))),
+			}
+
+			got, err := io.ReadAll(r)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	r := &chunkReader{
+		r: bufio.NewReader(iotest.OneByteReader(bytes.NewReader(rfcChunkedRPC))),
+	}
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, rfcUnchunkedRPC, got)
+}
+
+// scriptedReader returns each of parts on a separate read failing with err
+// (once) in between the first and second part.
+type scriptedReader struct {
+	parts  []string
+	err    error
+	failed bool
+}
+
+func (r *scriptedReader) Read(p []byte) (int, error) {
+	if len(r.parts) == 0 {
+		return 0, io.EOF
+	}
+	if len(r.parts) == 1 && !r.failed {
+		r.failed = true
+		return 0, r.err
+	}
+	n := copy(p, r.parts[0])
+	r.parts = r.parts[1:]
+	return n, nil
+}
+
+func TestChunkReaderHeaderRetry(t *testing.T) {
+	errTransient := errors.New("transient")
+	payload := strings.Repeat("x", 100)
+	src := &scriptedReader{
+		parts: []string{"\n#10", "0\n" + payload + "\n##\n"},
+		err:   errTransient,
+	}
+	r := &chunkReader{r: bufio.NewReader(src)}
+
+	buf := make([]byte, 64)
+	_, err := r.Read(buf)
+	assert.ErrorIs(t, err, errTransient)
+
+	// the digits read before the failure are not lost
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, string(got))
+}
+
 func TestChunkWriter(t *testing.T) {
 	buf := bytes.Buffer{}
-	w := &chunkWriter{bufio.NewWriter(&buf)}
+	w := &chunkWriter{w: bufio.NewWriter(&buf)}
 
 	n, err := w.Write([]byte("foo"))
 	assert.NoError(t, err)
@@ -144,6 +227,49 @@ func TestChunkWriter(t *testing.T) {
 	assert.Equal(t, want, buf.Bytes())
 }
 
+func TestChunkWriterMaxChunkSize(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 200*1024)
+
+	var buf bytes.Buffer
+	f := NewFramer(strings.NewReader(""), &buf, WithMaxChunkSize(64*1024))
+	f.Upgrade()
+
+	w, err := f.MsgWriter()
+	assert.NoError(t, err)
+	n, err := w.Write(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, len(payload), n)
+	assert.NoError(t, w.Close())
+
+	// walk the chunks by hand to check the headers
+	var sizes []int
+	total := 0
+	rest := buf.Bytes()
+	for {
+		var size int
+		_, err := fmt.Sscanf(string(rest), "\n#%d\n", &size)
+		if err != nil {
+			break
+		}
+		hdrLen := len(fmt.Sprintf("\n#%d\n", size))
+		sizes = append(sizes, size)
+		total += size
+		rest = rest[hdrLen+size:]
+	}
+	assert.Equal(t, []int{65536, 65536, 65536, 8192}, sizes)
+	assert.Equal(t, len(payload), total)
+	assert.Equal(t, "\n##\n", string(rest))
+
+	// reads back as the original payload
+	f = NewFramer(&buf, io.Discard)
+	f.Upgrade()
+	r, err := f.MsgReader()
+	assert.NoError(t, err)
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
 func BenchmarkChunkedReadByte(b *testing.B) {
 	src := bytes.NewReader(rfcChunkedRPC)
 	readers := []struct {
@@ -247,7 +373,7 @@ func TestEOMReadByte(t *testing.T) {
 	for _, tc := range framedTests {
 		t.Run(tc.name, func(t *testing.T) {
 			r := &eomReader{
-				bufio.NewReader(bytes.NewReader(tc.input)),
+				r: bufio.NewReader(bytes.NewReader(tc.input)),
 			}
 
 			buf := make([]byte, 8192)
@@ -308,6 +434,84 @@ func TestEOMWriter(t *testing.T) {
 	assert.Equal(t, want, buf.Bytes())
 }
 
+func TestReaderCloseAfterEOF(t *testing.T) {
+	tt := []struct {
+		name      string
+		input     string
+		newReader func(*bufio.Reader) io.ReadCloser
+	}{
+		{
+			name:      "eom",
+			input:     "foo]]>]]>bar]]>]]>",
+			newReader: func(r *bufio.Reader) io.ReadCloser { return &eomReader{r: r} },
+		},
+		{
+			name:      "chunked",
+			input:     "\n#3\nfoo\n##\n\n#3\nbar\n##\n",
+			newReader: func(r *bufio.Reader) io.ReadCloser { return &chunkReader{r: r} },
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tc.input))
+
+			// closing a fully read message must not consume the next one
+			for _, want := range []string{"foo", "bar"} {
+				r := tc.newReader(br)
+				got, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, want, string(got))
+
+				// reads past the end keep returning EOF
+				_, err = r.Read(make([]byte, 1))
+				assert.ErrorIs(t, err, io.EOF)
+				assert.NoError(t, r.Close())
+			}
+		})
+	}
+}
+
+func TestMessageWriter(t *testing.T) {
+	tt := []struct {
+		name      string
+		newWriter func(*bufio.Writer) MessageWriter
+		want      string
+	}{
+		{
+			name:      "eom",
+			newWriter: func(w *bufio.Writer) MessageWriter { return &eomWriter{w: w} },
+			want:      "foo\n]]>]]>bar\n]]>]]>",
+		},
+		{
+			name:      "chunked",
+			newWriter: func(w *bufio.Writer) MessageWriter { return &chunkWriter{w: w} },
+			want:      "\n#3\nfoo\n##\n\n#3\nbar\n##\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			bw := bufio.NewWriter(&buf)
+
+			// closing a message writer ends the message but the stream
+			// can still be used for the next one.
+			for _, msg := range []string{"foo", "bar"} {
+				w := tc.newWriter(bw)
+				_, err := io.WriteString(w, msg)
+				assert.NoError(t, err)
+				assert.NoError(t, w.Close())
+
+				_, err = w.Write([]byte("baz"))
+				assert.ErrorIs(t, err, ErrInvalidIO)
+			}
+
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
+
 // force benchmarks to not use any fancy ReadFroms's or other shortcuts
 type onlyReader struct {
 	io.Reader
@@ -372,3 +576,473 @@ func BenchmarkEOMRead(b *testing.B) {
 		})
 	}
 }
+
+func TestFramerStats(t *testing.T) {
+	in := bytes.NewReader([]byte("hello]]>]]>\n#3\nfoo\n##\n"))
+	var out bytes.Buffer
+	f := NewFramer(in, &out)
+
+	r, err := f.MsgReader()
+	assert.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.NoError(t, err)
+
+	w, err := f.MsgWriter()
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "hello")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	f.Upgrade()
+
+	r, err = f.MsgReader()
+	assert.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.NoError(t, err)
+
+	w, err = f.MsgWriter()
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "foo")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, Stats{
+		BytesRead:    uint64(in.Size()),
+		BytesWritten: uint64(out.Len()),
+	}, f.Stats())
+}
+
+func TestFramerChunkedHello(t *testing.T) {
+	hello := `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"/>`
+	tt := []struct {
+		name  string
+		input string
+	}{
+		{"eom", hello + "]]>]]>"},
+		{"chunked", fmt.Sprintf("\n#%d\n%s\n##\n", len(hello), hello)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFramer(strings.NewReader(tc.input+"<rpc/>]]>]]>"), io.Discard)
+
+			r, err := f.MsgReader()
+			assert.NoError(t, err)
+			got, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, hello, string(got))
+			assert.NoError(t, r.Close())
+
+			// the next message is unaffected
+			r, err = f.MsgReader()
+			assert.NoError(t, err)
+			got, err = io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, "<rpc/>", string(got))
+		})
+	}
+}
+
+func TestFramerAutoDetect(t *testing.T) {
+	msgs := []string{"<rpc-reply/>", `<rpc-reply message-id="2"/>`, "<notification/>"}
+	// mix of end-of-message and chunked framed messages
+	input := msgs[0] + "]]>]]>" +
+		fmt.Sprintf("\n#%d\n%s\n##\n", len(msgs[1]), msgs[1]) +
+		msgs[2] + "\n]]>]]>"
+
+	for _, upgraded := range []bool{false, true} {
+		t.Run(fmt.Sprintf("upgraded=%t", upgraded), func(t *testing.T) {
+			f := NewFramer(strings.NewReader(input), io.Discard)
+			f.SetAutoDetect(true)
+			if upgraded {
+				f.Upgrade()
+			}
+
+			for _, want := range msgs {
+				r, err := f.MsgReader()
+				assert.NoError(t, err)
+				got, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, want, strings.TrimSpace(string(got)))
+				assert.NoError(t, r.Close())
+			}
+		})
+	}
+
+	// without detection an upgraded framer only accepts chunked messages
+	f := NewFramer(strings.NewReader(input), io.Discard)
+	f.Upgrade()
+	r, err := f.MsgReader()
+	assert.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, ErrMalformedChunk)
+}
+
+func TestFramerIndependentUpgrade(t *testing.T) {
+	// the peer switches to chunked framing one message later than we do
+	input := "<rpc-reply/>]]>]]>" +
+		"\n#12\n<rpc-reply/>\n##\n"
+	var out bytes.Buffer
+	f := NewFramer(strings.NewReader(input), &out)
+
+	f.UpgradeWriter()
+	w, err := f.MsgWriter()
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "<rpc/>")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "\n#6\n<rpc/>\n##\n", out.String())
+
+	// the read side is still end-of-message
+	r, err := f.MsgReader()
+	assert.NoError(t, err)
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "<rpc-reply/>", string(got))
+
+	f.UpgradeReader()
+	r, err = f.MsgReader()
+	assert.NoError(t, err)
+	got, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "<rpc-reply/>", string(got))
+}
+
+func TestFramerSmallBuffers(t *testing.T) {
+	msg := strings.Repeat("<interface><name>ge-0/0/0</name></interface>", 100)
+
+	for _, upgraded := range []bool{false, true} {
+		t.Run(fmt.Sprintf("upgraded=%t", upgraded), func(t *testing.T) {
+			var stream bytes.Buffer
+			opts := []FramerOption{WithReadBufferSize(16), WithWriteBufferSize(16)}
+
+			// write two messages larger than the buffers
+			wf := NewFramer(strings.NewReader(""), &stream, opts...)
+			rf := NewFramer(&stream, io.Discard, opts...)
+			if upgraded {
+				wf.Upgrade()
+				rf.Upgrade()
+			}
+			for i := 0; i < 2; i++ {
+				w, err := wf.MsgWriter()
+				assert.NoError(t, err)
+				_, err = io.WriteString(w, msg)
+				assert.NoError(t, err)
+				assert.NoError(t, w.Close())
+			}
+
+			for i := 0; i < 2; i++ {
+				r, err := rf.MsgReader()
+				assert.NoError(t, err)
+				got, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, msg, strings.TrimSuffix(string(got), "\n"))
+				assert.NoError(t, r.Close())
+			}
+		})
+	}
+}
+
+// shortReader returns at most n bytes from each read.
+type shortReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *shortReader) Read(p []byte) (int, error) {
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	return r.r.Read(p)
+}
+
+func TestFramerHelloShortReads(t *testing.T) {
+	// a hello from a device with hundreds of capabilities
+	var hello strings.Builder
+	hello.WriteString(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>`)
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&hello, "<capability>urn:example:yang:module-%d?module=module-%d&amp;revision=2024-01-01</capability>", i, i)
+	}
+	hello.WriteString("</capabilities><session-id>1</session-id></hello>")
+	reply := "<rpc-reply/>"
+	stream := hello.String() + "]]>]]>" + "\n#" + fmt.Sprint(len(reply)) + "\n" + reply + "\n##\n"
+
+	tt := []struct {
+		name string
+		r    func(io.Reader) io.Reader
+	}{
+		{"one byte", iotest.OneByteReader},
+		{"half", iotest.HalfReader},
+		// the marker is split between reads for most of these
+		{"2 bytes", func(r io.Reader) io.Reader { return &shortReader{r: r, n: 2} }},
+		{"5 bytes", func(r io.Reader) io.Reader { return &shortReader{r: r, n: 5} }},
+		{"7 bytes", func(r io.Reader) io.Reader { return &shortReader{r: r, n: 7} }},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFramer(tc.r(strings.NewReader(stream)), io.Discard, WithReadBufferSize(16))
+
+			r, err := f.MsgReader()
+			assert.NoError(t, err)
+			got, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, hello.String(), string(got))
+			assert.NoError(t, r.Close())
+
+			// nothing past the marker was consumed
+			f.UpgradeReader()
+			r, err = f.MsgReader()
+			assert.NoError(t, err)
+			got, err = io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, reply, string(got))
+		})
+	}
+}
+
+// readCounter counts the reads done on the underlying stream.
+type readCounter struct {
+	r     io.Reader
+	reads int
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	r.reads++
+	return r.r.Read(p)
+}
+
+func BenchmarkFramerReadBufferSize(b *testing.B) {
+	// a 4MiB get-config reply sent as 64KiB chunks
+	chunk := bytes.Repeat([]byte("x"), 64*1024)
+	var msg bytes.Buffer
+	for i := 0; i < 64; i++ {
+		fmt.Fprintf(&msg, "\n#%d\n%s", len(chunk), chunk)
+	}
+	msg.WriteString("\n##\n")
+
+	for _, size := range []int{4 * 1024, 64 * 1024, 1024 * 1024} {
+		b.Run(fmt.Sprintf("%dKiB", size/1024), func(b *testing.B) {
+			b.SetBytes(int64(msg.Len()))
+			var reads int
+			for i := 0; i < b.N; i++ {
+				src := &readCounter{r: bytes.NewReader(msg.Bytes())}
+				f := NewFramer(src, io.Discard, WithReadBufferSize(size))
+				f.Upgrade()
+
+				r, err := f.MsgReader()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, onlyReader{r}); err != nil {
+					b.Fatal(err)
+				}
+				reads += src.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+func TestFrameMessage(t *testing.T) {
+	tt := []struct {
+		name    string
+		payload string
+		version FramingVersion
+		want    string
+	}{
+		{"eom", "<rpc/>", EndOfMessage, "<rpc/>\n]]>]]>"},
+		{"eom empty", "", EndOfMessage, "\n]]>]]>"},
+		{"chunked", "<rpc/>", Chunked, "\n#6\n<rpc/>\n##\n"},
+		{"chunked large", strings.Repeat("a", 10000), Chunked, "\n#10000\n" + strings.Repeat("a", 10000) + "\n##\n"},
+		{"chunked empty", "", Chunked, "\n##\n"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := FrameMessage([]byte(tc.payload), tc.version)
+			assert.Equal(t, tc.want, string(got))
+
+			// the framed message reads back as the payload
+			if tc.payload == "" {
+				return
+			}
+			f := NewFramer(bytes.NewReader(got), io.Discard)
+			if tc.version == Chunked {
+				f.Upgrade()
+			}
+			r, err := f.MsgReader()
+			assert.NoError(t, err)
+			msg, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.payload, strings.TrimSuffix(string(msg), "\n"))
+		})
+	}
+}
+
+func TestFramerEOMDelimiter(t *testing.T) {
+	const delim = "<<END>>"
+	// the standard marker is just data with a custom delimiter
+	msgs := []string{"<rpc-reply/>", "<data>]]>]]></data>"}
+
+	var stream bytes.Buffer
+	wf := NewFramer(strings.NewReader(""), &stream, WithEOMDelimiter(delim))
+	for _, msg := range msgs {
+		w, err := wf.MsgWriter()
+		assert.NoError(t, err)
+		_, err = io.WriteString(w, msg)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+	assert.Equal(t, "<rpc-reply/>\n<<END>><data>]]>]]></data>\n<<END>>", stream.String())
+
+	rf := NewFramer(&stream, io.Discard, WithEOMDelimiter(delim))
+	for _, want := range msgs {
+		r, err := rf.MsgReader()
+		assert.NoError(t, err)
+		got, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, want, strings.TrimSuffix(string(got), "\n"))
+		assert.NoError(t, r.Close())
+	}
+
+	// a standard framer never sees the end of the message
+	f := NewFramer(strings.NewReader("<rpc-reply/>\n<<END>>"), io.Discard)
+	r, err := f.MsgReader()
+	assert.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestChunkedEOF(t *testing.T) {
+	// a complete message followed by the stream ending is a clean EOF
+	f := NewFramer(strings.NewReader("\n#3\nfoo\n##\n"), io.Discard)
+	f.Upgrade()
+
+	r, err := f.MsgReader()
+	assert.NoError(t, err)
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(got))
+	assert.NoError(t, r.Close())
+
+	r, err = f.MsgReader()
+	assert.NoError(t, err)
+	_, err = r.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+
+	// the stream ending before the end-of-chunks marker cuts the message short
+	f = NewFramer(strings.NewReader("\n#3\nfoo"), io.Discard)
+	f.Upgrade()
+
+	r, err = f.MsgReader()
+	assert.NoError(t, err)
+	got, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "foo", string(got))
+	assert.ErrorIs(t, r.Close(), io.ErrUnexpectedEOF)
+}
+
+func TestChunkSizeRecording(t *testing.T) {
+	f := NewFramer(strings.NewReader("\n#3\nfoo\n#3\nbar\n##\n"), io.Discard, WithChunkSizeRecording())
+	f.UpgradeReader()
+
+	r, err := f.MsgReader()
+	assert.NoError(t, err)
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "foobar", string(got))
+	assert.Equal(t, []int{3, 3}, f.ChunkSizes())
+
+	// recording is off by default
+	f = NewFramer(strings.NewReader("\n#3\nfoo\n#3\nbar\n##\n"), io.Discard)
+	f.UpgradeReader()
+
+	r, err = f.MsgReader()
+	assert.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Nil(t, f.ChunkSizes())
+}
+
+func FuzzChunkReader(f *testing.F) {
+	for _, tc := range chunkedTests {
+		f.Add(tc.input)
+	}
+	f.Add(rfcChunkedRPC)
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		r := &chunkReader{r: bufio.NewReader(bytes.NewReader(input))}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+
+		// a message that decoded has to survive being framed again
+		r = &chunkReader{r: bufio.NewReader(bytes.NewReader(FrameMessage(got, Chunked)))}
+		again, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("failed to read re-framed message: %v", err)
+		}
+		if !bytes.Equal(got, again) {
+			t.Fatalf("re-framed message changed: %q != %q", again, got)
+		}
+	})
+}
+
+func FuzzEOMReader(f *testing.F) {
+	for _, tc := range framedTests {
+		f.Add(tc.input)
+	}
+	f.Add(rfcEOMRPC)
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		r := &eomReader{r: bufio.NewReader(bytes.NewReader(input))}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+
+		r = &eomReader{r: bufio.NewReader(bytes.NewReader(FrameMessage(got, EndOfMessage)))}
+		again, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("failed to read re-framed message: %v", err)
+		}
+		// the writer puts a newline before the end-of-message marker
+		if want := append(got[:len(got):len(got)], '\n'); !bytes.Equal(want, again) {
+			t.Fatalf("re-framed message changed: %q != %q", again, want)
+		}
+	})
+}
+
+func FuzzFramer(f *testing.F) {
+	for _, tc := range chunkedTests {
+		f.Add(tc.input, true)
+	}
+	for _, tc := range framedTests {
+		f.Add(tc.input, false)
+	}
+	f.Add(rfcChunkedRPC, true)
+	f.Add(rfcEOMRPC, false)
+
+	// every message of the stream is read (including the framing detection
+	// of the hello) until the stream is used up or broken.
+	f.Fuzz(func(t *testing.T, input []byte, upgraded bool) {
+		fr := NewFramer(bytes.NewReader(input), io.Discard)
+		if upgraded {
+			fr.UpgradeReader()
+		}
+		for i := 0; i < 64; i++ {
+			r, err := fr.MsgReader()
+			if err != nil {
+				return
+			}
+			if _, err := io.ReadAll(r); err != nil {
+				return
+			}
+			if err := r.Close(); err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,405 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/dau71/netconf/transport"
+)
+
+// ErrUnexpectedRequest is returned when closing a message written to a replay
+// [Transport] that doesn't match any of the captured requests.
+var ErrUnexpectedRequest = errors.New("netconf: request not found in capture")
+
+var (
+	messageIDRe = regexp.MustCompile(`message-id="([^"]*)"`)
+	base11Cap   = []byte("urn:ietf:params:netconf:base:1.1")
+)
+
+// Recorder wraps a transport writing the framed bytes of every message sent
+// and received to separate writers so that the exchange can be replayed later
+// with [Load].  Chunked messages are recorded as a single chunk (see
+// [transport.FrameMessage]).
+//
+// Recorder implements `Upgrade` when the wrapped transport does so the session
+// still moves to chunked framing.
+type Recorder struct {
+	tr       transport.Transport
+	sent     io.Writer
+	received io.Writer
+
+	mu      sync.Mutex
+	framing transport.FramingVersion
+}
+
+// NewRecorder returns a new Recorder for `tr` writing the sent messages to
+// `sent` and the received ones to `received`.
+func NewRecorder(tr transport.Transport, sent, received io.Writer) *Recorder {
+	return &Recorder{
+		tr:       tr,
+		sent:     sent,
+		received: received,
+	}
+}
+
+// Upgrade upgrades the wrapped transport to chunked framing.  It is a no-op
+// if the wrapped transport doesn't support upgrading.
+func (r *Recorder) Upgrade() {
+	upgrader, ok := r.tr.(interface{ Upgrade() })
+	if !ok {
+		return
+	}
+	upgrader.Upgrade()
+
+	r.mu.Lock()
+	r.framing = transport.Chunked
+	r.mu.Unlock()
+}
+
+func (r *Recorder) record(w io.Writer, msg []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := w.Write(transport.FrameMessage(msg, r.framing)); err != nil {
+		return fmt.Errorf("failed to record message: %w", err)
+	}
+	return nil
+}
+
+// MsgReader returns the next message from the wrapped transport.  The whole
+// message is read and recorded before it is returned so a reply is in the
+// capture by the time the rpc it answers returns.
+func (r *Recorder) MsgReader() (io.ReadCloser, error) {
+	rc, err := r.tr.MsgReader()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := io.ReadAll(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if err := rc.Close(); err != nil {
+		return nil, err
+	}
+	// the framer returns an empty message at the end of the stream
+	if len(msg) > 0 {
+		if err := r.record(r.received, msg); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(bytes.NewReader(msg)), nil
+}
+
+// MsgWriter returns a writer for the next message to the wrapped transport.
+// The message is recorded once the writer is closed.
+func (r *Recorder) MsgWriter() (io.WriteCloser, error) {
+	wc, err := r.tr.MsgWriter()
+	if err != nil {
+		return nil, err
+	}
+	return &recordingWriter{r: r, wc: wc}, nil
+}
+
+// Close closes the wrapped transport.
+func (r *Recorder) Close() error { return r.tr.Close() }
+
+type recordingWriter struct {
+	r   *Recorder
+	wc  io.WriteCloser
+	buf bytes.Buffer
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	n, err := rw.wc.Write(p)
+	rw.buf.Write(p[:n])
+	return n, err
+}
+
+func (rw *recordingWriter) Close() error {
+	if err := rw.wc.Close(); err != nil {
+		return err
+	}
+	return rw.r.record(rw.r.sent, rw.buf.Bytes())
+}
+
+// readMessage reads the next message from the framer returning nil at the end
+// of the stream.
+func readMessage(f *transport.Framer) ([]byte, error) {
+	r, err := f.MsgReader()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := io.ReadAll(r)
+	if len(msg) == 0 && (err == nil || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// readMessages reads the rest of the messages from the framer.
+func readMessages(f *transport.Framer) ([][]byte, error) {
+	var msgs [][]byte
+	for {
+		msg, err := readMessage(f)
+		if err != nil {
+			return nil, err
+		}
+		if msg == nil {
+			return msgs, nil
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// ErrMessageIDSequence is wrapped by the errors returned from
+// [CheckMessageIDs].
+var ErrMessageIDSequence = errors.New("netconf: bad message-id sequence")
+
+// CheckMessageIDs reads a stream of requests captured with a [Recorder] (the
+// `sent` stream) and checks that the message-ids of the `<rpc>`s are unique and
+// increasing as the default message-id generator of a session makes them.
+// This is for conformance testing our own output.  Note that rpcs issued
+// concurrently can be written in a different order than their message-ids were
+// assigned in.
+func CheckMessageIDs(sent io.Reader) error {
+	data, err := io.ReadAll(sent)
+	if err != nil {
+		return fmt.Errorf("failed to read capture: %w", err)
+	}
+	f := transport.NewFramer(bytes.NewReader(data), io.Discard)
+
+	seen := make(map[uint64]struct{})
+	var last uint64
+	for i := 1; ; i++ {
+		msg, err := readMessage(f)
+		if err != nil {
+			return fmt.Errorf("failed to read captured message %d: %w", i, err)
+		}
+		if msg == nil {
+			return nil
+		}
+		if i == 1 && chunkedAfterHello(data) {
+			f.UpgradeReader()
+		}
+
+		id, ok, err := rpcMessageID(msg)
+		if err != nil {
+			return fmt.Errorf("%w: message %d: %w", ErrMessageIDSequence, i, err)
+		}
+		if !ok {
+			continue
+		}
+
+		if _, dup := seen[id]; dup {
+			return fmt.Errorf("%w: message %d: duplicate message-id %d", ErrMessageIDSequence, i, id)
+		}
+		if id <= last {
+			return fmt.Errorf("%w: message %d: message-id %d after %d", ErrMessageIDSequence, i, id, last)
+		}
+		seen[id] = struct{}{}
+		last = id
+	}
+}
+
+// chunkedAfterHello reports if the messages after the End-of-Message framed
+// hello at the start of a capture are chunk-framed.
+func chunkedAfterHello(capture []byte) bool {
+	_, rest, ok := bytes.Cut(capture, []byte("]]>]]>"))
+	return ok && bytes.HasPrefix(bytes.TrimLeft(rest, " \t\r\n"), []byte("#"))
+}
+
+// rpcMessageID returns the message-id of the message if it is an `<rpc>`.
+func rpcMessageID(msg []byte) (uint64, bool, error) {
+	d := xml.NewDecoder(bytes.NewReader(msg))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return 0, false, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "rpc" {
+			return 0, false, nil
+		}
+
+		for _, attr := range start.Attr {
+			if attr.Name.Local != "message-id" {
+				continue
+			}
+			id, err := strconv.ParseUint(attr.Value, 10, 64)
+			if err != nil {
+				return 0, false, fmt.Errorf("invalid message-id %q", attr.Value)
+			}
+			return id, true, nil
+		}
+		return 0, false, fmt.Errorf("rpc without a message-id")
+	}
+}
+
+type exchange struct {
+	req   []byte
+	reply []byte
+	used  bool
+}
+
+// Transport is an in-memory transport replaying an exchange captured with a
+// [Recorder].  The captured server hello is sent right away and every request
+// written gets the reply to the matching captured request.  Requests are
+// matched on their contents ignoring the message-id and the message-id of the
+// reply is replaced with the one of the request.  Notifications and other
+// messages that aren't replies are not replayed.
+type Transport struct {
+	mu        sync.Mutex
+	exchanges []*exchange
+
+	replies chan []byte
+	done    chan struct{}
+	close   sync.Once
+}
+
+// Load returns a new replay Transport from the streams captured by
+// a [Recorder].  Chunked framing is used after the hello when both captured
+// hellos advertise `:base:1.1` the same as a session does.
+func Load(sent, received io.Reader) (*Transport, error) {
+	sentFramer := transport.NewFramer(sent, io.Discard)
+	recvFramer := transport.NewFramer(received, io.Discard)
+
+	clientHello, err := readMessage(sentFramer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captured client hello: %w", err)
+	}
+	serverHello, err := readMessage(recvFramer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captured server hello: %w", err)
+	}
+	if clientHello == nil || serverHello == nil {
+		return nil, fmt.Errorf("capture is missing the hello messages")
+	}
+
+	if bytes.Contains(clientHello, base11Cap) && bytes.Contains(serverHello, base11Cap) {
+		sentFramer.UpgradeReader()
+		recvFramer.UpgradeReader()
+	}
+
+	reqs, err := readMessages(sentFramer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captured requests: %w", err)
+	}
+	replies, err := readMessages(recvFramer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captured replies: %w", err)
+	}
+
+	byID := make(map[string][]byte)
+	for _, reply := range replies {
+		if id := messageID(reply); id != "" {
+			byID[id] = reply
+		}
+	}
+
+	t := &Transport{
+		replies: make(chan []byte, len(reqs)+1),
+		done:    make(chan struct{}),
+	}
+	for _, req := range reqs {
+		if reply, ok := byID[messageID(req)]; ok {
+			t.exchanges = append(t.exchanges, &exchange{req: stripMessageID(req), reply: reply})
+		}
+	}
+
+	t.replies <- serverHello
+	return t, nil
+}
+
+func messageID(msg []byte) string {
+	m := messageIDRe.FindSubmatch(msg)
+	if m == nil {
+		return ""
+	}
+	return string(m[1])
+}
+
+// stripMessageID returns the message without the message-id for comparing
+// requests.  The whitespace End-of-Message framing adds is also removed.
+func stripMessageID(msg []byte) []byte {
+	return bytes.TrimSpace(messageIDRe.ReplaceAll(msg, nil))
+}
+
+// reply returns the captured reply for the request.
+func (t *Transport) reply(req []byte) ([]byte, error) {
+	id := messageID(req)
+	if id == "" {
+		// the client hello doesn't get a reply
+		return nil, nil
+	}
+	stripped := stripMessageID(req)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, ex := range t.exchanges {
+		if ex.used || !bytes.Equal(ex.req, stripped) {
+			continue
+		}
+		ex.used = true
+		return messageIDRe.ReplaceAll(ex.reply, []byte(`message-id="`+id+`"`)), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnexpectedRequest, req)
+}
+
+// MsgReader returns the next reply blocking until one is available or the
+// transport is closed.
+func (t *Transport) MsgReader() (io.ReadCloser, error) {
+	select {
+	case msg := <-t.replies:
+		return io.NopCloser(bytes.NewReader(msg)), nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+// MsgWriter returns a writer for a request.  The matching reply is queued when
+// the writer is closed.
+func (t *Transport) MsgWriter() (io.WriteCloser, error) {
+	select {
+	case <-t.done:
+		return nil, io.ErrClosedPipe
+	default:
+	}
+	return &replayWriter{t: t}, nil
+}
+
+// Close closes the transport.  Pending and future reads return io.EOF.
+func (t *Transport) Close() error {
+	t.close.Do(func() { close(t.done) })
+	return nil
+}
+
+type replayWriter struct {
+	t   *Transport
+	buf bytes.Buffer
+}
+
+func (w *replayWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *replayWriter) Close() error {
+	reply, err := w.t.reply(w.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if reply != nil {
+		w.t.replies <- reply
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dau71/netconf"
+	"github.com/dau71/netconf/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deviceHello = `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+    <capability>urn:ietf:params:netconf:base:1.1</capability>
+  </capabilities>
+  <session-id>7</session-id>
+</hello>`
+
+const deviceConfig = `<system xmlns="urn:example:system"><hostname>r1</hostname></system>`
+
+var msgIDRe = regexp.MustCompile(`message-id="(\d+)"`)
+
+type pipeTransport struct {
+	*transport.Framer
+	close func() error
+}
+
+func (t *pipeTransport) Close() error { return t.close() }
+
+func newPipeTransports() (client, server *pipeTransport) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	closeFn := func() error {
+		cw.Close()
+		sw.Close()
+		return nil
+	}
+
+	client = &pipeTransport{Framer: transport.NewFramer(cr, cw), close: closeFn}
+	server = &pipeTransport{Framer: transport.NewFramer(sr, sw), close: closeFn}
+	return client, server
+}
+
+func writeMsg(tr *pipeTransport, msg string) error {
+	w, err := tr.MsgWriter()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// serveDevice answers the hello and then replies to `<get-config>` with
+// deviceConfig and `<ok/>` to everything else.
+func serveDevice(tr *pipeTransport) {
+	r, err := tr.MsgReader()
+	if err != nil {
+		return
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		return
+	}
+	if writeMsg(tr, deviceHello) != nil {
+		return
+	}
+	tr.Upgrade()
+
+	for {
+		r, err := tr.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+
+		var msgID []byte
+		if m := msgIDRe.FindSubmatch(msg); m != nil {
+			msgID = m[1]
+		}
+
+		body := "<ok/>"
+		if bytes.Contains(msg, []byte("<get-config>")) {
+			body = "<data>" + deviceConfig + "</data>"
+		}
+		reply := fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s">%s</rpc-reply>`, msgID, body)
+		if writeMsg(tr, reply) != nil {
+			return
+		}
+	}
+}
+
+func TestCaptureReplay(t *testing.T) {
+	ctx := context.Background()
+
+	// capture a get-config from the device
+	client, server := newPipeTransports()
+	defer server.Close()
+	go serveDevice(server)
+
+	var sent, received bytes.Buffer
+	sess, err := netconf.Open(NewRecorder(client, &sent, &received))
+	require.NoError(t, err)
+
+	config, err := sess.GetConfig(ctx, netconf.Running)
+	require.NoError(t, err)
+	assert.Equal(t, deviceConfig, string(config))
+	// replies are recorded before the rpc they answer returns
+	assert.Contains(t, received.String(), deviceConfig)
+	require.NoError(t, sess.Close(ctx))
+
+	// the capture is the framed stream with chunked framing after the hello
+	assert.True(t, strings.HasSuffix(received.String(), "\n##\n"))
+	assert.Contains(t, received.String(), "]]>]]>\n#")
+
+	// replay it without the device
+	tr, err := Load(bytes.NewReader(sent.Bytes()), bytes.NewReader(received.Bytes()))
+	require.NoError(t, err)
+	defer tr.Close()
+
+	sess, err = netconf.Open(tr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), sess.SessionID())
+
+	config, err = sess.GetConfig(ctx, netconf.Running)
+	require.NoError(t, err)
+	assert.Equal(t, deviceConfig, string(config))
+
+	// each captured reply is only replayed once
+	_, err = sess.GetConfig(ctx, netconf.Running)
+	assert.Error(t, err)
+}
+
+func TestReplayUnexpectedRequest(t *testing.T) {
+	sent := transport.FrameMessage([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"/>`), transport.EndOfMessage)
+	received := transport.FrameMessage([]byte(deviceHello), transport.EndOfMessage)
+
+	tr, err := Load(bytes.NewReader(sent), bytes.NewReader(received))
+	require.NoError(t, err)
+
+	w, err := tr.MsgWriter()
+	require.NoError(t, err)
+	_, err = io.WriteString(w, `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><get/></rpc>`)
+	require.NoError(t, err)
+	assert.ErrorIs(t, w.Close(), ErrUnexpectedRequest)
+}
+
+func TestCheckMessageIDs(t *testing.T) {
+	ctx := context.Background()
+
+	client, server := newPipeTransports()
+	defer server.Close()
+	go serveDevice(server)
+
+	var sent bytes.Buffer
+	sess, err := netconf.Open(NewRecorder(client, &sent, io.Discard))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = sess.GetConfig(ctx, netconf.Running)
+		require.NoError(t, err)
+	}
+	require.NoError(t, sess.Close(ctx))
+	assert.NoError(t, CheckMessageIDs(&sent))
+
+	capture := func(ids ...string) []byte {
+		b := transport.FrameMessage([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"/>`), transport.EndOfMessage)
+		for _, id := range ids {
+			rpc := `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="` + id + `"><get/></rpc>`
+			b = append(b, transport.FrameMessage([]byte(rpc), transport.Chunked)...)
+		}
+		return b
+	}
+
+	tt := []struct {
+		name    string
+		capture []byte
+		wantErr string
+	}{
+		{"ok", capture("1", "2", "5"), ""},
+		{"duplicate", capture("1", "2", "2"), "message 4: duplicate message-id 2"},
+		{"out of order", capture("1", "3", "2"), "message 4: message-id 2 after 3"},
+		{"not a number", capture("1", "abc"), `message 3: invalid message-id "abc"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckMessageIDs(bytes.NewReader(tc.capture))
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrMessageIDSequence)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
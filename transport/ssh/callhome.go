@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CallHomePort is the port devices connect to for NETCONF call home over SSH
+// as assigned in [RFC8071 7].
+//
+// [RFC8071 7]: https://www.rfc-editor.org/rfc/rfc8071.html#section-7
+const CallHomePort = 4334
+
+// CallHomeListener accepts NETCONF call home connections over SSH as
+// described in [RFC8071].  The device opens the TCP connection but the roles
+// are then the same as with [Dial]: the device is the ssh server and we are
+// the ssh client.
+//
+// The device is authenticated by the HostKeyCallback of the ssh.ClientConfig
+// the same as when dialing.  It is called with the remote address of the
+// device as the hostname.
+//
+// [RFC8071]: https://www.rfc-editor.org/rfc/rfc8071.html
+type CallHomeListener struct {
+	ln     net.Listener
+	config *ssh.ClientConfig
+}
+
+// ListenCallHome listens for devices calling home on the network address
+// (i.e `:4334`, see [CallHomePort]).  `opts` are applied to `config` as with
+// [Dial].
+func ListenCallHome(network, addr string, config *ssh.ClientConfig, opts ...DialOption) (*CallHomeListener, error) {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewCallHomeListener(ln, config, opts...), nil
+}
+
+// NewCallHomeListener accepts call home connections from an existing listener.
+// The listener is closed when the CallHomeListener is closed.
+func NewCallHomeListener(ln net.Listener, config *ssh.ClientConfig, opts ...DialOption) *CallHomeListener {
+	return &CallHomeListener{
+		ln:     ln,
+		config: applyOptions(config, opts),
+	}
+}
+
+// Accept waits for the next device to connect and returns a transport to it
+// once the ssh handshake is done and the netconf subsystem is started.  `ctx`
+// only bounds the handshake; Close the listener to stop waiting for a device.
+//
+// An error from a single device (i.e a failed host key check) doesn't affect
+// the listener and Accept can be called again.  Errors from the listener
+// itself are returned as is (i.e net.ErrClosed once closed).
+//
+// When the transport is closed the connection to the device is also closed.
+func (l *CallHomeListener) Accept(ctx context.Context) (*Transport, error) {
+	conn, err := l.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	addr := conn.RemoteAddr().String()
+
+	client, err := newClient(ctx, conn, addr, l.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed ssh handshake with device %s calling home: %w", addr, err)
+	}
+
+	t, err := newTransport(client, true)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to start netconf with device %s calling home: %w", addr, err)
+	}
+	return t, nil
+}
+
+// Addr returns the address the listener is listening on.
+func (l *CallHomeListener) Addr() net.Addr { return l.ln.Addr() }
+
+// Close stops accepting devices.  Transports already returned from Accept are
+// not affected.
+func (l *CallHomeListener) Close() error { return l.ln.Close() }
@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/dau71/netconf"
+	"github.com/dau71/netconf/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+const deviceHello = `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+  </capabilities>
+  <session-id>9</session-id>
+</hello>`
+
+var msgIDRe = regexp.MustCompile(`message-id="(\d+)"`)
+
+// serveNetconf is a device answering the hello and replying `<ok/>` to every
+// rpc.
+func serveNetconf(t *testing.T, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	go func() {
+		for req := range reqs {
+			_ = req.Reply(req.Type == "subsystem" && bytes.Equal(req.Payload[4:], []byte("netconf")), nil)
+		}
+	}()
+	defer ch.Close()
+
+	f := transport.NewFramer(ch, ch)
+	for i := 0; ; i++ {
+		if i == 0 {
+			w, err := f.MsgWriter()
+			if err != nil {
+				return
+			}
+			_, _ = io.WriteString(w, deviceHello)
+			if w.Close() != nil {
+				return
+			}
+		}
+
+		r, err := f.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+		if i == 0 {
+			// the client hello
+			continue
+		}
+
+		w, err := f.MsgWriter()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, msgIDRe.FindSubmatch(msg)[1])
+		if w.Close() != nil {
+			return
+		}
+	}
+}
+
+// callHome dials the listener and runs the device side of ssh.
+func callHome(t *testing.T, addr net.Addr) {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Logf("failed to call home: %v", err)
+		return
+	}
+	serveConn(t, conn, serveNetconf)
+}
+
+func TestCallHome(t *testing.T) {
+	key, err := ssh.ParsePrivateKey([]byte(hostkey))
+	require.NoError(t, err)
+
+	ln, err := ListenCallHome("tcp", "localhost:0", &ssh.ClientConfig{
+		HostKeyCallback: ssh.FixedHostKey(key.PublicKey()),
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go callHome(t, ln.Addr())
+
+	tr, err := ln.Accept(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ssh", tr.Info().Type)
+
+	sess, err := netconf.Open(tr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), sess.SessionID())
+	require.NoError(t, sess.Lock(context.Background(), netconf.Candidate))
+	assert.NoError(t, sess.Close(context.Background()))
+
+	// accepting again after the listener is closed fails
+	require.NoError(t, ln.Close())
+	_, err = ln.Accept(context.Background())
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestCallHomeUnknownDevice(t *testing.T) {
+	errUnknown := errors.New("unknown device")
+	var calls int
+	ln, err := ListenCallHome("tcp", "localhost:0", &ssh.ClientConfig{
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			calls++
+			// only the second device is trusted
+			if calls == 1 {
+				return errUnknown
+			}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go callHome(t, ln.Addr())
+	_, err = ln.Accept(context.Background())
+	assert.ErrorIs(t, err, errUnknown)
+
+	// the listener is still usable
+	go callHome(t, ln.Addr())
+	tr, err := ln.Accept(context.Background())
+	require.NoError(t, err)
+	assert.NoError(t, tr.Close())
+}
@@ -14,6 +14,17 @@ import (
 type framer = transport.Framer //nolint:golint,unused
 
 // Transport implements RFC6242 for implementing NETCONF protocol over SSH.
+//
+// SSH payload compression (`zlib`/`zlib@openssh.com`) is not available as
+// golang.org/x/crypto/ssh only implements the `none` compression method and
+// doesn't allow it to be configured on the ssh.ClientConfig.
+//
+// Likewise the channel's initial window size (2MiB) and maximum packet size
+// (32KiB) are constants in golang.org/x/crypto/ssh with no way to override
+// them for the channels it opens, so they can't be tuned for bulk transfers.
+// For large replies on high latency links fetching the config in parts over
+// several sessions (see `Pool.GetConfigSubtrees`) avoids being limited by a
+// single channel's window.
 type Transport struct {
 	c     *ssh.Client
 	sess  *ssh.Session
@@ -27,6 +38,76 @@ type Transport struct {
 	*framer
 }
 
+// DialOption is an optional argument to [Dial].
+type DialOption interface {
+	apply(*ssh.ClientConfig)
+}
+
+type (
+	ciphersOpt           []string
+	macsOpt              []string
+	keyExchangesOpt      []string
+	hostKeyAlgorithmsOpt []string
+	clientVersionOpt     string
+)
+
+func (o ciphersOpt) apply(cfg *ssh.ClientConfig)           { cfg.Ciphers = o }
+func (o macsOpt) apply(cfg *ssh.ClientConfig)              { cfg.MACs = o }
+func (o keyExchangesOpt) apply(cfg *ssh.ClientConfig)      { cfg.KeyExchanges = o }
+func (o hostKeyAlgorithmsOpt) apply(cfg *ssh.ClientConfig) { cfg.HostKeyAlgorithms = o }
+func (o clientVersionOpt) apply(cfg *ssh.ClientConfig)     { cfg.ClientVersion = string(o) }
+
+// DefaultClientVersion is the version banner sent to the server when neither
+// the ssh.ClientConfig nor [WithClientVersion] set one.
+const DefaultClientVersion = "SSH-2.0-Go-netconf"
+
+// WithClientVersion sets the version banner sent to the server (i.e
+// `SSH-2.0-OpenSSH_9.6`) for devices that change their behavior based on the
+// client.  It must start with `SSH-2.0-`.
+func WithClientVersion(version string) DialOption { return clientVersionOpt(version) }
+
+// The algorithm options below replace the algorithms (in order of preference)
+// golang.org/x/crypto/ssh will negotiate.  They are intended for connecting to
+// legacy devices that only support algorithms disabled by default such as
+// `aes128-cbc`, `3des-cbc`, `hmac-sha1-96`, `diffie-hellman-group1-sha1` or
+// `ssh-rsa` (SHA-1) host keys.
+//
+// These algorithms are disabled for a reason: they have known weaknesses
+// that may allow an attacker on the network to decrypt, tamper with or
+// impersonate the connection.  Only enable them for the specific devices that
+// need them and keep the modern algorithms first in the list so they are still
+// preferred when available.
+
+// WithCiphers sets the allowed ciphers for the connection.
+func WithCiphers(ciphers ...string) DialOption { return ciphersOpt(ciphers) }
+
+// WithMACs sets the allowed message authentication codes for the connection.
+func WithMACs(macs ...string) DialOption { return macsOpt(macs) }
+
+// WithKeyExchanges sets the allowed key exchange algorithms for the
+// connection.
+func WithKeyExchanges(kexes ...string) DialOption { return keyExchangesOpt(kexes) }
+
+// WithHostKeyAlgorithms sets the host key algorithms accepted from the server.
+func WithHostKeyAlgorithms(algos ...string) DialOption { return hostKeyAlgorithmsOpt(algos) }
+
+// applyOptions returns a copy of the config with the options applied so that
+// the caller's config is never modified.
+func applyOptions(config *ssh.ClientConfig, opts []DialOption) *ssh.ClientConfig {
+	if len(opts) == 0 && config.ClientVersion != "" {
+		return config
+	}
+
+	cfg := *config
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+	if cfg.ClientVersion == "" {
+		cfg.ClientVersion = DefaultClientVersion
+	}
+	return &cfg
+}
+
 // Dial will connect to a ssh server and issues a transport, it's used as a
 // convenience function as essentially is the same as
 //
@@ -35,13 +116,29 @@ type Transport struct {
 //	 	t, err := NewTransport(c)
 //
 // When the transport is closed the underlying connection is also closed.
-func Dial(ctx context.Context, network, addr string, config *ssh.ClientConfig) (*Transport, error) {
+//
+// The algorithms used can be overridden with `opts` for legacy devices (see
+// [WithCiphers]) without modifying `config`.  [DefaultClientVersion] is sent
+// as the version banner unless `config` or [WithClientVersion] sets one.
+func Dial(ctx context.Context, network, addr string, config *ssh.ClientConfig, opts ...DialOption) (*Transport, error) {
+	config = applyOptions(config, opts)
+
 	d := net.Dialer{Timeout: config.Timeout}
 	conn, err := d.DialContext(ctx, network, addr)
 	if err != nil {
 		return nil, err
 	}
 
+	client, err := newClient(ctx, conn, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return newTransport(client, true)
+}
+
+// newClient does the client side of the ssh handshake on an established
+// connection.
+func newClient(ctx context.Context, conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
 	// Setup a go routine to monitor the context and close the connection.  This
 	// is needed as the underlying ssh library doesn't support contexts so this
 	// approximates a context based cancelation/timeout for the ssh handshake.
@@ -50,6 +147,7 @@ func Dial(ctx context.Context, network, addr string, config *ssh.ClientConfig) (
 	// would manage two timeouts.  One for tcp connection and one for ssh
 	// handshake and wouldn't support any other event based cancelation.
 	done := make(chan struct{})
+	defer close(done) // make sure we cleanup the context monitor routine
 	go func() {
 		select {
 		case <-ctx.Done():
@@ -69,10 +167,7 @@ func Dial(ctx context.Context, network, addr string, config *ssh.ClientConfig) (
 		}
 		return nil, err
 	}
-	close(done) // make sure we cleanup the context monitor routine
-
-	client := ssh.NewClient(sshConn, chans, reqs)
-	return newTransport(client, true)
+	return ssh.NewClient(sshConn, chans, reqs), nil
 }
 
 // NewTransport will create a new ssh transport as defined in RFC6242 for use
@@ -114,6 +209,25 @@ func newTransport(client *ssh.Client, managed bool) (*Transport, error) {
 	}, nil
 }
 
+// SendRequest sends a global request on the underlying ssh connection.  This
+// is mostly useful for sending keepalives (i.e `keepalive@openssh.com`) to
+// keep an idle session from being dropped.  It doesn't touch the netconf
+// channel and is safe to call while messages are being read or written.
+func (t *Transport) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	return t.c.SendRequest(name, wantReply, payload)
+}
+
+// Info describes the ssh connection.  AuthMethod is left empty as
+// golang.org/x/crypto/ssh doesn't report which of the configured methods
+// succeeded.
+func (t *Transport) Info() transport.Info {
+	return transport.Info{
+		Type:       "ssh",
+		RemoteAddr: t.c.RemoteAddr(),
+		Username:   t.c.User(),
+	}
+}
+
 // Close will close the underlying transport.  If the connection was created
 // with Dial then then underlying ssh.Client is closed as well.  If not only
 // the sessions is closed.
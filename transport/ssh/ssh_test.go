@@ -1,12 +1,14 @@
 package ssh
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -49,6 +51,28 @@ QXHvb1h5QQyt1p/F5eFC/f+ZEThsSSX6FIHjTazV3OxcvUxoHTG3P4RDNWY6yzo2iZke1R
 `
 
 func newTestServer(t *testing.T, handlerFn func(*testing.T, ssh.Channel, <-chan *ssh.Request)) (*testServer, error) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		nconn, err := ln.Accept()
+		if err != nil {
+			t.Logf("failed to accept new conn: %v", err)
+			return
+		}
+		serveConn(t, nconn, handlerFn)
+	}()
+
+	return &testServer{
+		addr: ln.Addr(),
+	}, nil
+}
+
+// serveConn runs the server side of ssh on nconn calling handlerFn for each
+// session channel.
+func serveConn(t *testing.T, nconn net.Conn, handlerFn func(*testing.T, ssh.Channel, <-chan *ssh.Request)) {
 	config := &ssh.ServerConfig{
 		NoClientAuth: true,
 	}
@@ -59,44 +83,27 @@ func newTestServer(t *testing.T, handlerFn func(*testing.T, ssh.Channel, <-chan
 	}
 	config.AddHostKey(key)
 
-	ln, err := net.Listen("tcp", "localhost:0")
+	_, chans, reqs, err := ssh.NewServerConn(nconn, config)
 	if err != nil {
-		return nil, err
+		t.Logf("failed to create ssh conn: %v", err)
+		return
 	}
+	go ssh.DiscardRequests(reqs)
 
-	go func() {
-		nconn, err := ln.Accept()
-		if err != nil {
-			t.Logf("failed to accept new conn: %v", err)
-			return
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
 		}
 
-		_, chans, reqs, err := ssh.NewServerConn(nconn, config)
+		ch, reqs, err := newChannel.Accept()
 		if err != nil {
-			t.Logf("failed to create ssh conn: %v", err)
+			t.Logf("failed to accept new channel: %v", err)
 			return
 		}
-		go ssh.DiscardRequests(reqs)
-
-		for newChannel := range chans {
-			if newChannel.ChannelType() != "session" {
-				_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
-				continue
-			}
-
-			ch, reqs, err := newChannel.Accept()
-			if err != nil {
-				t.Logf("failed to accept new channel: %v", err)
-				return
-			}
 
-			handlerFn(t, ch, reqs)
-		}
-	}()
-
-	return &testServer{
-		addr: ln.Addr(),
-	}, nil
+		handlerFn(t, ch, reqs)
+	}
 }
 
 func TestTransport(t *testing.T) {
@@ -151,3 +158,122 @@ func TestTransport(t *testing.T) {
 	want := out + "\n]]>]]>"
 	assert.Equal(t, want, srvIn.String())
 }
+
+func TestDialOptions(t *testing.T) {
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	got := applyOptions(config, []DialOption{
+		WithCiphers("aes128-ctr", "aes128-cbc", "3des-cbc"),
+		WithMACs("hmac-sha2-256", "hmac-sha1", "hmac-sha1-96"),
+		WithKeyExchanges("curve25519-sha256", "diffie-hellman-group1-sha1"),
+		WithHostKeyAlgorithms(ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA),
+	})
+
+	assert.Equal(t, []string{"aes128-ctr", "aes128-cbc", "3des-cbc"}, got.Config.Ciphers)
+	assert.Equal(t, []string{"hmac-sha2-256", "hmac-sha1", "hmac-sha1-96"}, got.Config.MACs)
+	assert.Equal(t, []string{"curve25519-sha256", "diffie-hellman-group1-sha1"}, got.Config.KeyExchanges)
+	assert.Equal(t, []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}, got.HostKeyAlgorithms)
+	assert.Equal(t, "admin", got.User)
+
+	// the caller's config is left alone
+	assert.Nil(t, config.Ciphers)
+	assert.Nil(t, config.MACs)
+	assert.Nil(t, config.KeyExchanges)
+	assert.Nil(t, config.HostKeyAlgorithms)
+}
+
+func TestClientVersion(t *testing.T) {
+	tt := []struct {
+		name   string
+		config string
+		opts   []DialOption
+		want   string
+	}{
+		{"default", "", nil, DefaultClientVersion},
+		{"config", "SSH-2.0-Config", nil, "SSH-2.0-Config"},
+		{"option", "SSH-2.0-Config", []DialOption{WithClientVersion("SSH-2.0-OpenSSH_9.6")}, "SSH-2.0-OpenSSH_9.6"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "localhost:0")
+			require.NoError(t, err)
+			defer ln.Close()
+
+			// records the banner and hangs up before the key exchange
+			banner := make(chan string, 1)
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				banner <- strings.TrimRight(line, "\r\n")
+			}()
+
+			config := &ssh.ClientConfig{
+				HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+				ClientVersion:   tc.config,
+			}
+			_, err = Dial(context.Background(), "tcp", ln.Addr().String(), config, tc.opts...)
+			assert.Error(t, err)
+			assert.Equal(t, tc.want, <-banner)
+			// the caller's config is left alone
+			assert.Equal(t, tc.config, config.ClientVersion)
+		})
+	}
+}
+
+func TestSendRequest(t *testing.T) {
+	server, err := newTestServer(t, func(t *testing.T, ch ssh.Channel, reqs <-chan *ssh.Request) {
+		go func() {
+			for req := range reqs {
+				_ = req.Reply(true, nil)
+			}
+		}()
+		_, _ = io.Copy(io.Discard, ch)
+	})
+	require.NoError(t, err)
+
+	config := &ssh.ClientConfig{
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	tr, err := Dial(context.Background(), "tcp", server.addr.String(), config)
+	require.NoError(t, err)
+	defer tr.Close()
+
+	// the test server rejects all global requests
+	ok, _, err := tr.SendRequest("keepalive@openssh.com", true, nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestInfo(t *testing.T) {
+	server, err := newTestServer(t, func(t *testing.T, ch ssh.Channel, reqs <-chan *ssh.Request) {
+		go func() {
+			for req := range reqs {
+				_ = req.Reply(true, nil)
+			}
+		}()
+		_, _ = io.Copy(io.Discard, ch)
+	})
+	require.NoError(t, err)
+
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	tr, err := Dial(context.Background(), "tcp", server.addr.String(), config)
+	require.NoError(t, err)
+	defer tr.Close()
+
+	info := tr.Info()
+	assert.Equal(t, "ssh", info.Type)
+	assert.Equal(t, server.addr.String(), info.RemoteAddr.String())
+	assert.Equal(t, "admin", info.Username)
+	assert.Empty(t, info.AuthMethod)
+}
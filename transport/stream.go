@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"io"
+	"sync"
+)
+
+// alias it to a private type so we can make it private when embedding
+type framer = Framer //nolint:golint,unused
+
+// Stream is a transport over an already established NETCONF byte stream such
+// as an ssh channel opened by other means or a pipe to a subprocess.  It only
+// does the framing; anything needed to set up the stream (authentication,
+// multiplexing, etc) is left to the caller.
+type Stream struct {
+	*framer
+
+	close     func() error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewStream returns a new Stream reading from `r` and writing to `w`.  `close`
+// is called (once) to tear down the stream when the transport is closed and
+// can be nil if there is nothing to do.  The options are passed to
+// [NewFramer].
+func NewStream(r io.Reader, w io.Writer, close func() error, opts ...FramerOption) *Stream {
+	return &Stream{
+		framer: NewFramer(r, w, opts...),
+		close:  close,
+	}
+}
+
+// Close closes the stream with the close function given to [NewStream].
+// Calling Close more than once returns the error from the first call.
+func (s *Stream) Close() error {
+	s.closeOnce.Do(func() {
+		if s.close != nil {
+			s.closeErr = s.close()
+		}
+	})
+	return s.closeErr
+}
@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	closeErr := errors.New("already closed")
+	var closes int
+	s := NewStream(r, w, func() error {
+		closes++
+		r.Close()
+		w.Close()
+		return closeErr
+	})
+
+	// a message written is read back over the pipe
+	mw, err := s.MsgWriter()
+	require.NoError(t, err)
+	_, err = io.WriteString(mw, "<rpc/>")
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	mr, err := s.MsgReader()
+	require.NoError(t, err)
+	got, err := io.ReadAll(mr)
+	require.NoError(t, err)
+	assert.Equal(t, "<rpc/>\n", string(got))
+
+	assert.ErrorIs(t, s.Close(), closeErr)
+	assert.ErrorIs(t, s.Close(), closeErr)
+	assert.Equal(t, 1, closes)
+
+	// a nil close function is allowed
+	assert.NoError(t, NewStream(r, w, nil).Close())
+}
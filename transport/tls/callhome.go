@@ -0,0 +1,79 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// CallHomePort is the port devices connect to for NETCONF call home over TLS
+// as assigned in [RFC8071 7].
+//
+// [RFC8071 7]: https://www.rfc-editor.org/rfc/rfc8071.html#section-7
+const CallHomePort = 4335
+
+// CallHomeListener accepts NETCONF call home connections over TLS as
+// described in [RFC8071].  The device opens the TCP connection but the roles
+// are then the same as with [Dial]: the device is the TLS server and we are the
+// TLS client.
+//
+// The device is authenticated with the tls.Config the same as when dialing.
+// As the device isn't known until it connects this usually means setting
+// VerifyConnection (or InsecureSkipVerify with VerifyPeerCertificate) to check
+// the certificate against the expected devices, or ServerName when every
+// device presents a certificate for the same name.
+//
+// [RFC8071]: https://www.rfc-editor.org/rfc/rfc8071.html
+type CallHomeListener struct {
+	ln     net.Listener
+	config *tls.Config
+	cfg    dialConfig
+}
+
+// ListenCallHome listens for devices calling home on the network address
+// (i.e `:4335`, see [CallHomePort]).  `opts` are the same as for [Dial].
+func ListenCallHome(network, addr string, config *tls.Config, opts ...DialOption) (*CallHomeListener, error) {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewCallHomeListener(ln, config, opts...), nil
+}
+
+// NewCallHomeListener accepts call home connections from an existing listener.
+// The listener is closed when the CallHomeListener is closed.
+func NewCallHomeListener(ln net.Listener, config *tls.Config, opts ...DialOption) *CallHomeListener {
+	return &CallHomeListener{
+		ln:     ln,
+		config: config,
+		cfg:    newDialConfig(opts),
+	}
+}
+
+// Accept waits for the next device to connect and returns a transport to it
+// once the TLS handshake is done.  `ctx` only bounds the handshake; Close the
+// listener to stop waiting for a device.
+//
+// An error from a single device (i.e a certificate that fails verification)
+// doesn't affect the listener and Accept can be called again.  Errors from the
+// listener itself are returned as is (i.e net.ErrClosed once closed).
+func (l *CallHomeListener) Accept(ctx context.Context) (*Transport, error) {
+	conn, err := l.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := clientHandshake(ctx, conn, l.config, l.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed tls handshake with device %s calling home: %w", conn.RemoteAddr(), err)
+	}
+	return t, nil
+}
+
+// Addr returns the address the listener is listening on.
+func (l *CallHomeListener) Addr() net.Addr { return l.ln.Addr() }
+
+// Close stops accepting devices.  Transports already returned from Accept are
+// not affected.
+func (l *CallHomeListener) Close() error { return l.ln.Close() }
@@ -0,0 +1,119 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/dau71/netconf"
+	"github.com/dau71/netconf/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deviceHello = `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+  </capabilities>
+  <session-id>9</session-id>
+</hello>`
+
+var msgIDRe = regexp.MustCompile(`message-id="(\d+)"`)
+
+// callHome dials the listener as a device with the certificate and then
+// answers the hello and replies `<ok/>` to every rpc.
+func callHome(addr net.Addr, cert tls.Certificate) {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		return
+	}
+	tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	defer tlsConn.Close()
+
+	f := transport.NewFramer(tlsConn, tlsConn)
+	w, err := f.MsgWriter()
+	if err != nil {
+		return
+	}
+	_, _ = io.WriteString(w, deviceHello)
+	if w.Close() != nil {
+		return
+	}
+
+	for i := 0; ; i++ {
+		r, err := f.MsgReader()
+		if err != nil {
+			return
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+		if i == 0 {
+			// the client hello
+			continue
+		}
+
+		w, err := f.MsgWriter()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, msgIDRe.FindSubmatch(msg)[1])
+		if w.Close() != nil {
+			return
+		}
+	}
+}
+
+func TestCallHome(t *testing.T) {
+	deviceCert := newCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "device1"},
+		DNSNames:    []string{"device1.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	otherCert := newCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "device2"},
+		DNSNames:    []string{"device2.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+
+	leaf, err := x509.ParseCertificate(deviceCert.Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	ln, err := ListenCallHome("tcp", "localhost:0", &tls.Config{
+		RootCAs:    roots,
+		ServerName: "device1.example.com",
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// a device with a certificate that isn't trusted is rejected
+	go callHome(ln.Addr(), otherCert)
+	_, err = ln.Accept(context.Background())
+	var verifyErr *tls.CertificateVerificationError
+	assert.ErrorAs(t, err, &verifyErr)
+
+	// the listener is still usable for the next device
+	go callHome(ln.Addr(), deviceCert)
+	tr, err := ln.Accept(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "tls", tr.Info().Type)
+
+	sess, err := netconf.Open(tr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), sess.SessionID())
+	require.NoError(t, sess.Lock(context.Background(), netconf.Candidate))
+	assert.NoError(t, sess.Close(context.Background()))
+
+	require.NoError(t, ln.Close())
+	_, err = ln.Accept(context.Background())
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
@@ -3,6 +3,9 @@ package tls
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"net"
 
 	"github.com/dau71/netconf/transport"
@@ -13,25 +16,177 @@ type framer = transport.Framer //nolint:golint,unused
 
 // Transport implements RFC7589 for implementing NETCONF over TLS.
 type Transport struct {
-	conn *tls.Conn
+	conn     *tls.Conn
+	username string
 	*framer
 }
 
-// Dial will connect to a server via TLS and retuns a Transport.
-func Dial(ctx context.Context, network, addr string, config *tls.Config) (*Transport, error) {
+// CertToName maps the client certificate to the NETCONF username the same way
+// the server does as described in [RFC7589 7].  The server is configured with
+// the actual mapping so this should mirror it.
+//
+// [RFC7589 7]: https://www.rfc-editor.org/rfc/rfc7589.html#section-7
+type CertToName func(cert *x509.Certificate) (string, error)
+
+// ErrNoName is returned from a [CertToName] when the certificate doesn't have
+// the field the name is mapped from.
+var ErrNoName = errors.New("netconf: certificate has no name to map to a username")
+
+// CommonName maps the subject common name (CN) of the certificate to the
+// username (`common-name` in RFC7589).  This is the default mapping.
+func CommonName(cert *x509.Certificate) (string, error) {
+	if cert.Subject.CommonName == "" {
+		return "", ErrNoName
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// SANRFC822Name maps the first rfc822Name (email) subjectAltName of the
+// certificate to the username (`san-rfc822-name` in RFC7589).
+func SANRFC822Name(cert *x509.Certificate) (string, error) {
+	if len(cert.EmailAddresses) == 0 {
+		return "", ErrNoName
+	}
+	return cert.EmailAddresses[0], nil
+}
+
+// SANDNSName maps the first dNSName subjectAltName of the certificate to the
+// username (`san-dns-name` in RFC7589).
+func SANDNSName(cert *x509.Certificate) (string, error) {
+	if len(cert.DNSNames) == 0 {
+		return "", ErrNoName
+	}
+	return cert.DNSNames[0], nil
+}
+
+// SANIPAddress maps the first iPAddress subjectAltName of the certificate to
+// the username (`san-ip-address` in RFC7589).
+func SANIPAddress(cert *x509.Certificate) (string, error) {
+	if len(cert.IPAddresses) == 0 {
+		return "", ErrNoName
+	}
+	return cert.IPAddresses[0].String(), nil
+}
+
+// SANAny maps the first subjectAltName of the certificate, in the order
+// rfc822Name, dNSName and then iPAddress, to the username (`san-any` in
+// RFC7589).
+func SANAny(cert *x509.Certificate) (string, error) {
+	for _, fn := range []CertToName{SANRFC822Name, SANDNSName, SANIPAddress} {
+		if name, err := fn(cert); err == nil {
+			return name, nil
+		}
+	}
+	return "", ErrNoName
+}
+
+// DialOption is an optional argument to [Dial].
+type DialOption interface {
+	apply(*dialConfig)
+}
+
+type dialConfig struct {
+	certToName CertToName
+}
+
+type certToNameOpt CertToName
+
+func (o certToNameOpt) apply(cfg *dialConfig) { cfg.certToName = CertToName(o) }
+
+// WithCertToName sets the mapping used to resolve the username from the
+// client certificate.  [CommonName] is used by default.
+func WithCertToName(fn CertToName) DialOption { return certToNameOpt(fn) }
+
+func newDialConfig(opts []DialOption) dialConfig {
+	cfg := dialConfig{certToName: CommonName}
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+	return cfg
+}
+
+// Dial will connect to a server via TLS and retuns a Transport.  The TLS
+// handshake is done before returning and the username is resolved from the
+// client certificate that was sent (see [Transport.Username]).
+func Dial(ctx context.Context, network, addr string, config *tls.Config, opts ...DialOption) (*Transport, error) {
+	cfg := newDialConfig(opts)
+
 	var d net.Dialer
 	conn, err := d.DialContext(ctx, network, addr)
 	if err != nil {
 		return nil, err
 	}
+	return clientHandshake(ctx, conn, config, cfg)
+}
+
+// clientHandshake does the client side of the TLS handshake on an established
+// connection resolving the username.  The connection is closed on failure.
+func clientHandshake(ctx context.Context, conn net.Conn, config *tls.Config, cfg dialConfig) (*Transport, error) {
+	// capture the certificate the client actually sends as it depends on what
+	// the server asks for.
+	var sent *tls.Certificate
+	config = config.Clone()
+	getCert := config.GetClientCertificate
+	if getCert == nil {
+		getCert = defaultClientCertificate(config.Certificates)
+	}
+	config.GetClientCertificate = func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := getCert(cri)
+		sent = cert
+		return cert, err
+	}
 
 	tlsConn := tls.Client(conn, config)
-	return NewTransport(tlsConn), nil
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t := NewTransport(tlsConn)
+	if sent != nil && len(sent.Certificate) > 0 {
+		var err error
+		t.username, err = resolveUsername(sent, cfg.certToName)
+		if err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
 
+// defaultClientCertificate selects the certificate the same way crypto/tls
+// does when GetClientCertificate is not set.
+func defaultClientCertificate(certs []tls.Certificate) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		for i := range certs {
+			if err := cri.SupportsCertificate(&certs[i]); err == nil {
+				return &certs[i], nil
+			}
+		}
+		// no acceptable certificate so send nothing
+		return new(tls.Certificate), nil
+	}
+}
+
+func resolveUsername(cert *tls.Certificate, certToName CertToName) (string, error) {
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return "", fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+	}
+
+	name, err := certToName(leaf)
+	if err != nil {
+		return "", fmt.Errorf("failed to map client certificate to a username: %w", err)
+	}
+	return name, nil
 }
 
 // NewTransport takes an already connected tls transport and returns a new
-// Transport.
+// Transport.  The username is not resolved for transports created this way.
 func NewTransport(conn *tls.Conn) *Transport {
 	return &Transport{
 		conn:   conn,
@@ -39,6 +194,27 @@ func NewTransport(conn *tls.Conn) *Transport {
 	}
 }
 
+// Username is the NETCONF username the server derives from the client
+// certificate as resolved with the [CertToName] mapping given to [Dial].  It is
+// empty if no client certificate was sent.
+func (t *Transport) Username() string {
+	return t.username
+}
+
+// Info describes the TLS connection.  AuthMethod is `x509` when a client
+// certificate was sent.
+func (t *Transport) Info() transport.Info {
+	info := transport.Info{
+		Type:       "tls",
+		RemoteAddr: t.conn.RemoteAddr(),
+		Username:   t.username,
+	}
+	if t.username != "" {
+		info.AuthMethod = "x509"
+	}
+	return info
+}
+
 // Close will close the transport and the underlying TLS connection.
 func (t *Transport) Close() error {
 	return t.conn.Close()
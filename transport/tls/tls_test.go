@@ -0,0 +1,145 @@
+package tls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCert(t *testing.T, tmpl *x509.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(1)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertToName(t *testing.T) {
+	full := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "admin"},
+		EmailAddresses: []string{"ops@example.com"},
+		DNSNames:       []string{"client.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("192.0.2.10")},
+	}
+	dnsOnly := &x509.Certificate{
+		DNSNames: []string{"client.example.com"},
+	}
+
+	tt := []struct {
+		name    string
+		fn      CertToName
+		cert    *x509.Certificate
+		want    string
+		wantErr error
+	}{
+		{"common-name", CommonName, full, "admin", nil},
+		{"common-name missing", CommonName, dnsOnly, "", ErrNoName},
+		{"san-rfc822-name", SANRFC822Name, full, "ops@example.com", nil},
+		{"san-dns-name", SANDNSName, full, "client.example.com", nil},
+		{"san-ip-address", SANIPAddress, full, "192.0.2.10", nil},
+		{"san-ip-address missing", SANIPAddress, dnsOnly, "", ErrNoName},
+		{"san-any", SANAny, full, "ops@example.com", nil},
+		{"san-any dns", SANAny, dnsOnly, "client.example.com", nil},
+		{"san-any missing", SANAny, &x509.Certificate{}, "", ErrNoName},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.fn(tc.cert)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDialUsername(t *testing.T) {
+	serverCert := newCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		DNSNames:    []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCert := newCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "admin"},
+		DNSNames:    []string{"client.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	ln, err := tls.Listen("tcp", "localhost:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	tt := []struct {
+		name  string
+		certs []tls.Certificate
+		opts  []DialOption
+		want  string
+	}{
+		{"default common name", []tls.Certificate{clientCert}, nil, "admin"},
+		{"dns name", []tls.Certificate{clientCert}, []DialOption{WithCertToName(SANDNSName)}, "client.example.com"},
+		{
+			name:  "custom",
+			certs: []tls.Certificate{clientCert},
+			opts: []DialOption{WithCertToName(func(cert *x509.Certificate) (string, error) {
+				return "nc-" + cert.Subject.CommonName, nil
+			})},
+			want: "nc-admin",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &tls.Config{
+				InsecureSkipVerify: true,
+				Certificates:       tc.certs,
+			}
+			tr, err := Dial(context.Background(), "tcp", ln.Addr().String(), config, tc.opts...)
+			require.NoError(t, err)
+			defer tr.Close()
+
+			assert.Equal(t, tc.want, tr.Username())
+
+			info := tr.Info()
+			assert.Equal(t, "tls", info.Type)
+			assert.Equal(t, "x509", info.AuthMethod)
+			assert.Equal(t, tc.want, info.Username)
+			assert.Equal(t, ln.Addr().String(), info.RemoteAddr.String())
+			// the caller's config is not modified
+			assert.Nil(t, config.GetClientCertificate)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package transport
 import (
 	"errors"
 	"io"
+	"net"
 )
 
 var (
@@ -34,3 +35,22 @@ type Transport interface {
 	// Close will close the underlying transport.
 	Close() error
 }
+
+// Info describes the connection underneath a transport.  Transports that
+// know about their connection implement an `Info() Info` method and fill in
+// the fields they can.
+type Info struct {
+	// Type is the name of the transport (i.e `ssh` or `tls`).
+	Type string
+
+	// RemoteAddr is the address of the device.
+	RemoteAddr net.Addr
+
+	// AuthMethod is how the client authenticated (i.e `x509` for a TLS client
+	// certificate).  Empty if it isn't known.
+	AuthMethod string
+
+	// Username is the NETCONF username of the session.  Empty if it isn't
+	// known.
+	Username string
+}
@@ -0,0 +1,237 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrFilterNotConvertible is returned from [SubtreeToXPath] for subtree
+// filters that use features with no xpath equivalent in the supported subset.
+var ErrFilterNotConvertible = errors.New("netconf: subtree filter cannot be converted to xpath")
+
+// XPathFilter returns an xpath [Filter] as defined in [RFC6241 8.9] selecting
+// the nodes matching `sel`.  `namespaces` maps each prefix used in `sel` to
+// it's namespace.  This requires the device to support the `:xpath`
+// capability.
+//
+// [RFC6241 8.9]: https://www.rfc-editor.org/rfc/rfc6241.html#section-8.9
+func XPathFilter(sel string, namespaces map[string]string) *Filter {
+	prefixes := make([]string, 0, len(namespaces))
+	for prefix := range namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	f := &Filter{Type: "xpath", Select: sel}
+	for _, prefix := range prefixes {
+		f.NamespaceDecls = append(f.NamespaceDecls, xml.Attr{
+			Name:  xml.Name{Local: "xmlns:" + prefix},
+			Value: namespaces[prefix],
+		})
+	}
+	return f
+}
+
+// SubtreeToXPath converts subtree filters (see [SubtreeFilter]) to an
+// equivalent [XPathFilter] for devices where only one of the filter types
+// works.  This is best-effort and only supports the simple subset of subtree
+// filters made of:
+//
+//   - containment nodes, which become steps of the path
+//   - selection nodes (empty leaves), which become the last step of a path
+//   - content match nodes (leaves with a value, i.e list keys), which become
+//     `[name='value']` predicates on their parent
+//
+// Each selection or containment sibling results in it's own path and the
+// paths are combined with `|`.  Attribute matches, mixed content and values
+// containing both kinds of quotes return [ErrFilterNotConvertible].  Prefixes
+// are generated from the namespaces (i.e `ietf-interfaces` for
+// `urn:ietf:params:xml:ns:yang:ietf-interfaces`).
+//
+// Unlike with subtree filtering a device may not return the keys of a list
+// entry selected by a content match node along with the selected leaves.
+func SubtreeToXPath(subtrees ...string) (*Filter, error) {
+	b := xpathBuilder{
+		prefixes: make(map[string]string),
+		used:     make(map[string]bool),
+	}
+
+	var paths []string
+	for _, subtree := range subtrees {
+		roots, err := parseSubtree(subtree)
+		if err != nil {
+			return nil, err
+		}
+		for _, root := range roots {
+			p, err := b.paths("", root)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, p...)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: empty filter", ErrFilterNotConvertible)
+	}
+
+	namespaces := make(map[string]string, len(b.prefixes))
+	for ns, prefix := range b.prefixes {
+		namespaces[prefix] = ns
+	}
+	return XPathFilter(strings.Join(paths, " | "), namespaces), nil
+}
+
+type subtreeNode struct {
+	name     xml.Name
+	text     string
+	children []*subtreeNode
+}
+
+// isContentMatch reports if the node is a leaf with a value to match.
+func (n *subtreeNode) isContentMatch() bool {
+	return len(n.children) == 0 && n.text != ""
+}
+
+func parseSubtree(subtree string) ([]*subtreeNode, error) {
+	var roots, stack []*subtreeNode
+
+	d := xml.NewDecoder(strings.NewReader(subtree))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid subtree filter: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			for _, attr := range tok.Attr {
+				if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+					return nil, fmt.Errorf("%w: attribute match on <%s>", ErrFilterNotConvertible, tok.Name.Local)
+				}
+			}
+
+			n := &subtreeNode{name: tok.Name}
+			if len(stack) == 0 {
+				roots = append(roots, n)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			n.text = strings.TrimSpace(n.text)
+			if n.text != "" && len(n.children) > 0 {
+				return nil, fmt.Errorf("%w: mixed content in <%s>", ErrFilterNotConvertible, n.name.Local)
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(tok)
+			}
+		}
+	}
+	return roots, nil
+}
+
+type xpathBuilder struct {
+	// prefixes maps namespaces to their generated prefix.
+	prefixes map[string]string
+	used     map[string]bool
+}
+
+// paths returns the xpath expressions selecting what the node selects in
+// the subtree filter.
+func (b *xpathBuilder) paths(parent string, n *subtreeNode) ([]string, error) {
+	step := parent + "/" + b.qname(n.name)
+	if n.isContentMatch() {
+		lit, err := xpathLiteral(n.text)
+		if err != nil {
+			return nil, err
+		}
+		return []string{step + "[.=" + lit + "]"}, nil
+	}
+
+	var selected []*subtreeNode
+	for _, child := range n.children {
+		if !child.isContentMatch() {
+			selected = append(selected, child)
+			continue
+		}
+		lit, err := xpathLiteral(child.text)
+		if err != nil {
+			return nil, err
+		}
+		step += "[" + b.qname(child.name) + "=" + lit + "]"
+	}
+
+	// without any selection nodes the whole node is selected
+	if len(selected) == 0 {
+		return []string{step}, nil
+	}
+
+	var paths []string
+	for _, child := range selected {
+		p, err := b.paths(step, child)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p...)
+	}
+	return paths, nil
+}
+
+func (b *xpathBuilder) qname(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	prefix, ok := b.prefixes[name.Space]
+	if !ok {
+		prefix = b.newPrefix(name.Space)
+		b.prefixes[name.Space] = prefix
+	}
+	return prefix + ":" + name.Local
+}
+
+// newPrefix returns an unused prefix based on the last segment of the
+// namespace.
+func (b *xpathBuilder) newPrefix(ns string) string {
+	base := ns[strings.LastIndexAny(ns, ":/")+1:]
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return -1
+	}, base)
+	if base == "" || !(base[0] >= 'a' && base[0] <= 'z' || base[0] >= 'A' && base[0] <= 'Z' || base[0] == '_') {
+		base = "ns" + base
+	}
+
+	prefix := base
+	for i := 2; b.used[prefix]; i++ {
+		prefix = fmt.Sprintf("%s%d", base, i)
+	}
+	b.used[prefix] = true
+	return prefix
+}
+
+// xpathLiteral quotes s as an xpath 1.0 string literal which has no escapes.
+func xpathLiteral(s string) (string, error) {
+	switch {
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'", nil
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`, nil
+	}
+	return "", fmt.Errorf("%w: value %q has both kinds of quotes", ErrFilterNotConvertible, s)
+}
@@ -0,0 +1,105 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXPathFilter(t *testing.T) {
+	f := XPathFilter("/sys:system/if:interfaces", map[string]string{
+		"sys": "urn:example:system",
+		"if":  "urn:ietf:params:xml:ns:yang:ietf-interfaces",
+	})
+
+	out, err := xml.Marshal(&GetConfigReq{Source: Running, Filter: f})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `<filter type="xpath" select="/sys:system/if:interfaces" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:sys="urn:example:system"></filter>`)
+}
+
+func TestSubtreeToXPath(t *testing.T) {
+	const ifNS = "urn:ietf:params:xml:ns:yang:ietf-interfaces"
+
+	tt := []struct {
+		name     string
+		subtrees []string
+		want     string
+		wantNS   map[string]string
+		wantErr  error
+	}{
+		{
+			name:     "keyed list entry leaf",
+			subtrees: []string{`<interfaces xmlns="` + ifNS + `"><interface><name>eth0</name><mtu/></interface></interfaces>`},
+			want:     "/ietf-interfaces:interfaces/ietf-interfaces:interface[ietf-interfaces:name='eth0']/ietf-interfaces:mtu",
+			wantNS:   map[string]string{"ietf-interfaces": ifNS},
+		},
+		{
+			name:     "whole list entry",
+			subtrees: []string{`<interfaces xmlns="` + ifNS + `"><interface><name>eth0</name></interface></interfaces>`},
+			want:     "/ietf-interfaces:interfaces/ietf-interfaces:interface[ietf-interfaces:name='eth0']",
+			wantNS:   map[string]string{"ietf-interfaces": ifNS},
+		},
+		{
+			name: "selection siblings and multiple subtrees",
+			subtrees: []string{
+				`<system xmlns="urn:example:system"><hostname/><ntp><server/></ntp></system>`,
+				`<system xmlns="urn:other:system"/>`,
+			},
+			want:   "/system:system/system:hostname | /system:system/system:ntp/system:server | /system2:system",
+			wantNS: map[string]string{"system": "urn:example:system", "system2": "urn:other:system"},
+		},
+		{
+			name:     "no namespace and quoted value",
+			subtrees: []string{`<users><user><name>o'brien</name></user></users>`},
+			want:     `/users/user[name="o'brien"]`,
+			wantNS:   map[string]string{},
+		},
+		{
+			name:     "content match root",
+			subtrees: []string{`<hostname xmlns="http://example.com/1.0">r1</hostname>`},
+			want:     "/ns1.0:hostname[.='r1']",
+			wantNS:   map[string]string{"ns1.0": "http://example.com/1.0"},
+		},
+		{
+			name:     "attribute match",
+			subtrees: []string{`<top xmlns:t="urn:t" xmlns="urn:t"><users t:type="admin"/></top>`},
+			wantErr:  ErrFilterNotConvertible,
+		},
+		{
+			name:     "mixed content",
+			subtrees: []string{`<top>x<users/></top>`},
+			wantErr:  ErrFilterNotConvertible,
+		},
+		{
+			name:     "both quotes",
+			subtrees: []string{`<user><name>'"</name></user>`},
+			wantErr:  ErrFilterNotConvertible,
+		},
+		{
+			name:     "empty",
+			subtrees: []string{""},
+			wantErr:  ErrFilterNotConvertible,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := SubtreeToXPath(tc.subtrees...)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "xpath", f.Type)
+			assert.Equal(t, tc.want, f.Select)
+
+			ns := make(map[string]string)
+			for _, attr := range f.NamespaceDecls {
+				ns[attr.Name.Local[len("xmlns:"):]] = attr.Value
+			}
+			assert.Equal(t, tc.wantNS, ns)
+		})
+	}
+}
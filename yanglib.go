@@ -0,0 +1,202 @@
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sync"
+)
+
+const yangLibNamespace = "urn:ietf:params:xml:ns:yang:ietf-yang-library"
+
+// YANGLibrary is the set of YANG modules implemented by a device as reported
+// by the ietf-yang-library module.  Both the original [RFC7895]
+// (`/modules-state`) and the NMDA [RFC8525] (`/yang-library`) versions are
+// decoded into this same structure.
+//
+// [RFC7895]: https://www.rfc-editor.org/rfc/rfc7895.html
+// [RFC8525]: https://www.rfc-editor.org/rfc/rfc8525.html
+type YANGLibrary struct {
+	// Revision is the revision of ietf-yang-library implemented by the device
+	// as advertised in it's capabilities (i.e `2016-06-21` for RFC7895 or
+	// `2019-01-04` for RFC8525).
+	Revision string
+
+	// ContentID identifies the current contents of the library.  This is the
+	// `module-set-id` for RFC7895 and the `content-id` for RFC8525.
+	ContentID string
+
+	Modules []YANGModule
+}
+
+// YANGModule is a single module in a [YANGLibrary].
+type YANGModule struct {
+	Name      string
+	Revision  string
+	Namespace string
+
+	// Features are the names of the features of the module supported by the
+	// device.
+	Features []string
+
+	// Deviations are the names of the modules containing deviations for this
+	// module.
+	Deviations []string
+
+	Submodules []YANGSubmodule
+
+	// ImportOnly is true when the module is only used for it's definitions
+	// and is not implemented by the device.
+	ImportOnly bool
+}
+
+// YANGSubmodule is a submodule included by a [YANGModule].
+type YANGSubmodule struct {
+	Name     string `xml:"name"`
+	Revision string `xml:"revision"`
+}
+
+// modulesState maps `/modules-state` from RFC7895.
+type modulesState struct {
+	ModuleSetID string `xml:"module-set-id"`
+	Modules     []struct {
+		Name       string   `xml:"name"`
+		Revision   string   `xml:"revision"`
+		Namespace  string   `xml:"namespace"`
+		Features   []string `xml:"feature"`
+		Deviations []struct {
+			Name string `xml:"name"`
+		} `xml:"deviation"`
+		ConformanceType string          `xml:"conformance-type"`
+		Submodules      []YANGSubmodule `xml:"submodule"`
+	} `xml:"module"`
+}
+
+func (ms *modulesState) library() *YANGLibrary {
+	lib := &YANGLibrary{ContentID: ms.ModuleSetID}
+	for _, m := range ms.Modules {
+		mod := YANGModule{
+			Name:       m.Name,
+			Revision:   m.Revision,
+			Namespace:  m.Namespace,
+			Features:   m.Features,
+			Submodules: m.Submodules,
+			ImportOnly: m.ConformanceType == "import",
+		}
+		for _, dev := range m.Deviations {
+			mod.Deviations = append(mod.Deviations, dev.Name)
+		}
+		lib.Modules = append(lib.Modules, mod)
+	}
+	return lib
+}
+
+// yangLibrary maps `/yang-library` from RFC8525.
+type yangLibrary struct {
+	ContentID  string `xml:"content-id"`
+	ModuleSets []struct {
+		Modules []struct {
+			Name       string          `xml:"name"`
+			Revision   string          `xml:"revision"`
+			Namespace  string          `xml:"namespace"`
+			Features   []string        `xml:"feature"`
+			Deviations []string        `xml:"deviation"`
+			Submodules []YANGSubmodule `xml:"submodule"`
+		} `xml:"module"`
+		ImportOnlyModules []struct {
+			Name       string          `xml:"name"`
+			Revision   string          `xml:"revision"`
+			Namespace  string          `xml:"namespace"`
+			Submodules []YANGSubmodule `xml:"submodule"`
+		} `xml:"import-only-module"`
+	} `xml:"module-set"`
+}
+
+func (yl *yangLibrary) library() *YANGLibrary {
+	lib := &YANGLibrary{ContentID: yl.ContentID}
+	for _, set := range yl.ModuleSets {
+		for _, m := range set.Modules {
+			lib.Modules = append(lib.Modules, YANGModule{
+				Name:       m.Name,
+				Revision:   m.Revision,
+				Namespace:  m.Namespace,
+				Features:   m.Features,
+				Deviations: m.Deviations,
+				Submodules: m.Submodules,
+			})
+		}
+		for _, m := range set.ImportOnlyModules {
+			lib.Modules = append(lib.Modules, YANGModule{
+				Name:       m.Name,
+				Revision:   m.Revision,
+				Namespace:  m.Namespace,
+				Submodules: m.Submodules,
+				ImportOnly: true,
+			})
+		}
+	}
+	return lib
+}
+
+type yangLibReply struct {
+	XMLName      xml.Name      `xml:"data"`
+	ModulesState *modulesState `xml:"urn:ietf:params:xml:ns:yang:ietf-yang-library modules-state"`
+	YANGLibrary  *yangLibrary  `xml:"urn:ietf:params:xml:ns:yang:ietf-yang-library yang-library"`
+}
+
+// yangLibCache holds the result of [Session.YANGLibrary].
+type yangLibCache struct {
+	mu  sync.Mutex
+	lib *YANGLibrary
+}
+
+// YANGLibrary fetches the set of YANG modules implemented by the device.  The
+// `:yang-library:1.1` capability (RFC8525) is preferred and `/yang-library` is
+// queried, otherwise `/modules-state` is queried if the device advertises the
+// `:yang-library:1.0` capability (RFC7895).
+//
+// The library is fetched once and cached for the life of the session (or until
+// the capabilities change with [Session.ReadHello]).
+func (s *Session) YANGLibrary(ctx context.Context) (*YANGLibrary, error) {
+	s.yangLib.mu.Lock()
+	defer s.yangLib.mu.Unlock()
+
+	if s.yangLib.lib != nil {
+		return s.yangLib.lib, nil
+	}
+
+	var (
+		root    string
+		version string
+		caps    = s.serverCapSet()
+	)
+	if params, ok := caps.Params(yangLibCap11); ok {
+		root, version = "yang-library", params.Get("revision")
+	} else if params, ok := caps.Params(yangLibCap10); ok {
+		root, version = "modules-state", params.Get("revision")
+	} else {
+		return nil, fmt.Errorf("device does not support the :yang-library capability")
+	}
+	req := GetReq{
+		Filter: SubtreeFilter(fmt.Sprintf(`<%s xmlns="%s"/>`, root, yangLibNamespace)),
+	}
+
+	var resp yangLibReply
+	if err := s.Call(ctx, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	var lib *YANGLibrary
+	switch {
+	case resp.YANGLibrary != nil:
+		lib = resp.YANGLibrary.library()
+	case resp.ModulesState != nil:
+		lib = resp.ModulesState.library()
+	default:
+		return nil, fmt.Errorf("device returned no %s data", root)
+	}
+	lib.Revision = version
+
+	s.yangLib.lib = lib
+	return lib, nil
+}
@@ -0,0 +1,151 @@
+package netconf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYANGLibrary(t *testing.T) {
+	tt := []struct {
+		name      string
+		caps      []string
+		reply     string
+		wantReq   string
+		want      *YANGLibrary
+		wantError string
+	}{
+		{
+			name: "rfc7895",
+			caps: []string{":yang-library:1.0?revision=2016-06-21&module-set-id=abc123"},
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>
+  <modules-state xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-library">
+    <module-set-id>abc123</module-set-id>
+    <module>
+      <name>ietf-interfaces</name>
+      <revision>2018-02-20</revision>
+      <namespace>urn:ietf:params:xml:ns:yang:ietf-interfaces</namespace>
+      <feature>arbitrary-names</feature>
+      <feature>pre-provisioning</feature>
+      <deviation><name>example-deviations</name><revision>2023-01-01</revision></deviation>
+      <conformance-type>implement</conformance-type>
+    </module>
+    <module>
+      <name>ietf-yang-types</name>
+      <revision>2013-07-15</revision>
+      <namespace>urn:ietf:params:xml:ns:yang:ietf-yang-types</namespace>
+      <conformance-type>import</conformance-type>
+      <submodule><name>ietf-yang-types-sub</name><revision>2013-07-15</revision></submodule>
+    </module>
+  </modules-state>
+</data></rpc-reply>`,
+			wantReq: `<get><filter type="subtree"><modules-state xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-library"/></filter></get>`,
+			want: &YANGLibrary{
+				Revision:  "2016-06-21",
+				ContentID: "abc123",
+				Modules: []YANGModule{
+					{
+						Name:       "ietf-interfaces",
+						Revision:   "2018-02-20",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-interfaces",
+						Features:   []string{"arbitrary-names", "pre-provisioning"},
+						Deviations: []string{"example-deviations"},
+					},
+					{
+						Name:       "ietf-yang-types",
+						Revision:   "2013-07-15",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-yang-types",
+						Submodules: []YANGSubmodule{{Name: "ietf-yang-types-sub", Revision: "2013-07-15"}},
+						ImportOnly: true,
+					},
+				},
+			},
+		},
+		{
+			name: "rfc8525",
+			caps: []string{
+				// both are advertised by some devices, the newer one wins
+				":yang-library:1.0?revision=2016-06-21&module-set-id=abc123",
+				":yang-library:1.1?revision=2019-01-04&content-id=xyz789",
+			},
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>
+  <yang-library xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-library">
+    <module-set>
+      <name>complete</name>
+      <module>
+        <name>ietf-interfaces</name>
+        <revision>2018-02-20</revision>
+        <namespace>urn:ietf:params:xml:ns:yang:ietf-interfaces</namespace>
+        <feature>if-mib</feature>
+        <deviation>example-deviations</deviation>
+      </module>
+      <import-only-module>
+        <name>ietf-inet-types</name>
+        <revision>2013-07-15</revision>
+        <namespace>urn:ietf:params:xml:ns:yang:ietf-inet-types</namespace>
+      </import-only-module>
+    </module-set>
+    <schema><name>complete</name><module-set>complete</module-set></schema>
+    <content-id>xyz789</content-id>
+  </yang-library>
+</data></rpc-reply>`,
+			wantReq: `<get><filter type="subtree"><yang-library xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-library"/></filter></get>`,
+			want: &YANGLibrary{
+				Revision:  "2019-01-04",
+				ContentID: "xyz789",
+				Modules: []YANGModule{
+					{
+						Name:       "ietf-interfaces",
+						Revision:   "2018-02-20",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-interfaces",
+						Features:   []string{"if-mib"},
+						Deviations: []string{"example-deviations"},
+					},
+					{
+						Name:       "ietf-inet-types",
+						Revision:   "2013-07-15",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-inet-types",
+						ImportOnly: true,
+					},
+				},
+			},
+		},
+		{
+			name:      "unsupported",
+			caps:      []string{":base:1.1"},
+			wantError: "does not support the :yang-library capability",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			sess := newSession(ts.transport())
+			sess.serverCaps = newCapabilitySet(tc.caps...)
+			go sess.recv()
+
+			if tc.wantError != "" {
+				_, err := sess.YANGLibrary(context.Background())
+				assert.ErrorContains(t, err, tc.wantError)
+				return
+			}
+
+			ts.queueRespString(tc.reply)
+
+			got, err := sess.YANGLibrary(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+
+			sentMsg, err := ts.popReqString()
+			require.NoError(t, err)
+			assert.Contains(t, sentMsg, tc.wantReq)
+
+			// second call is served from the cache without hitting the device
+			cached, err := sess.YANGLibrary(context.Background())
+			require.NoError(t, err)
+			assert.Same(t, got, cached)
+		})
+	}
+}